@@ -0,0 +1,143 @@
+package qtcwrap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Allowlist lists reviewed output tags that Audit findings may be
+// filtered by.
+//
+// An allowlist file holds one entry per line in the form
+//
+//	<template>:<func> <output tag>
+//
+// such as "views/page.qtpl:Page {%s= p.Body %}". Template paths are
+// relative to the directory of the allowlist file. Entries do not include
+// line numbers, so they survive unrelated template edits, and allow every
+// identical output tag of the func. Empty lines and lines starting with
+// "#" are ignored.
+type Allowlist struct {
+	// entries holds the allowed output tags, keyed by allowlistKey.
+	entries map[string]bool
+}
+
+// LoadAllowlist reads an allowlist file. A missing file yields an empty
+// allowlist, so CI can run the audit before anything was reviewed.
+//
+// Example:
+//
+//	allowlist, err := LoadAllowlist(".qtcwrap-audit")
+//	if err != nil {
+//	    fmt.Printf("Cannot load allowlist: %v\n", err)
+//	    return
+//	}
+//	report = report.Filter(allowlist)
+func LoadAllowlist(path string) (*Allowlist, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- the allowlist path is chosen by the caller
+	if os.IsNotExist(err) {
+		return &Allowlist{entries: make(map[string]bool)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read allowlist: %w", err)
+	}
+	return parseAllowlist(data, filepath.Dir(path), path)
+}
+
+// parseAllowlist parses the contents of an allowlist file whose template
+// paths are relative to dir.
+func parseAllowlist(data []byte, dir, name string) (*Allowlist, error) {
+	allowlist := &Allowlist{entries: make(map[string]bool)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		location, site, ok := strings.Cut(entry, " {%")
+		sep := strings.LastIndex(location, ":")
+		if !ok || sep <= 0 || sep == len(location)-1 || !strings.HasSuffix(site, "%}") {
+			return nil, fmt.Errorf("%s:%d: invalid allowlist entry %q", name, line, entry)
+		}
+		file := location[:sep]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, filepath.FromSlash(file))
+		}
+		key, err := allowlistKey(file, location[sep+1:], "{%"+site)
+		if err != nil {
+			return nil, err
+		}
+		allowlist.entries[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read allowlist: %w", err)
+	}
+	return allowlist, nil
+}
+
+// allowlistKey returns the key of an output tag of a template func. Paths
+// are made absolute and whitespace in the tag is normalized, so entries
+// match findings regardless of the working directory and of formatting.
+func allowlistKey(file, fn, site string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve template path %s: %w", file, err)
+	}
+	return abs + ":" + fn + " " + strings.Join(strings.Fields(site), " "), nil
+}
+
+// Allows reports whether the finding was reviewed. A nil allowlist allows
+// nothing.
+func (a *Allowlist) Allows(finding AuditFinding) bool {
+	if a == nil {
+		return false
+	}
+	key, err := allowlistKey(finding.Position.File, finding.Func, finding.Site())
+	return err == nil && a.entries[key]
+}
+
+// WriteAllowlist writes an allowlist entry for every finding, with
+// template paths relative to dir, the directory of the allowlist file. It
+// is meant to record the findings of an existing template tree as
+// reviewed, so CI only fails for new ones.
+//
+// Example:
+//
+//	f, _ := os.Create(".qtcwrap-audit")
+//	defer f.Close()
+//	_ = report.WriteAllowlist(f, ".")
+func (r *AuditReport) WriteAllowlist(w io.Writer, dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("cannot resolve allowlist directory %s: %w", dir, err)
+	}
+
+	seen := make(map[string]bool)
+	var b strings.Builder
+	b.WriteString("# Output tags reviewed by qtcwrap audit, one per line: <template>:<func> <output tag>\n")
+	for _, finding := range r.Findings {
+		file, err := filepath.Abs(finding.Position.File)
+		if err != nil {
+			return fmt.Errorf("cannot resolve template path %s: %w", finding.Position.File, err)
+		}
+		if rel, err := filepath.Rel(absDir, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		entry := file + ":" + finding.Func + " " + finding.Site()
+		if !seen[entry] {
+			seen[entry] = true
+			b.WriteString(entry + "\n")
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("cannot write allowlist: %w", err)
+	}
+	return nil
+}
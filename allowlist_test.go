@@ -0,0 +1,99 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, viewsDir, "page.qtpl")
+	path := filepath.Join(dir, ".qtcwrap-audit")
+	content := "# reviewed\n\nviews/page.qtpl:Page {%s=   p.Body %}\nviews/page.qtpl:BasePage.Title {%= Header() %}\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	allowlist, err := LoadAllowlist(path)
+	if err != nil {
+		t.Fatalf("LoadAllowlist failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		finding  AuditFinding
+		expected bool
+	}{
+		{"Allowed", AuditFinding{Position: Position{File: page, Line: 9}, Func: "Page", Tag: "s=", Expr: "p.Body"}, true},
+		{"Method", AuditFinding{Position: Position{File: page, Line: 20}, Func: "BasePage.Title", Tag: "=", Expr: "Header()"}, true},
+		{"OtherFunc", AuditFinding{Position: Position{File: page, Line: 9}, Func: "Other", Tag: "s=", Expr: "p.Body"}, false},
+		{"OtherExpr", AuditFinding{Position: Position{File: page, Line: 9}, Func: "Page", Tag: "s=", Expr: "p.Title"}, false},
+		{"OtherFile", AuditFinding{Position: Position{File: filepath.Join(dir, "page.qtpl"), Line: 9}, Func: "Page", Tag: "s=", Expr: "p.Body"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := allowlist.Allows(tt.finding); allowed != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, allowed)
+			}
+		})
+	}
+
+	var nilAllowlist *Allowlist
+	if nilAllowlist.Allows(tests[0].finding) {
+		t.Error("Expected a nil allowlist to allow nothing")
+	}
+}
+
+func TestLoadAllowlistErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	allowlist, err := LoadAllowlist(filepath.Join(dir, "missing"))
+	if err != nil || allowlist == nil {
+		t.Errorf("Expected an empty allowlist for a missing file, got %v", err)
+	}
+
+	for _, entry := range []string{"page.qtpl {%s= x %}", "page.qtpl:Page", "page.qtpl: {%s= x %}", "page.qtpl:Page {%s= x"} {
+		path := filepath.Join(dir, "allowlist")
+		if err := os.WriteFile(path, []byte(entry+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadAllowlist(path)
+		assertValidationError(t, err, "allowlist:1: invalid allowlist entry", true)
+	}
+}
+
+func TestWriteAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplate(t, dir, "views/page.qtpl", auditTemplate)
+
+	report, err := Audit(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteAllowlist(&buf, dir); err != nil {
+		t.Fatalf("WriteAllowlist failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\nviews/page.qtpl:Page {%s= item %}\n") {
+		t.Errorf("Expected relative entries, got:\n%s", buf.String())
+	}
+	if strings.Count(buf.String(), "{%s title %}") != 1 {
+		t.Errorf("Expected identical output tags to be listed once, got:\n%s", buf.String())
+	}
+
+	path := filepath.Join(dir, ".qtcwrap-audit")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	allowlist, err := LoadAllowlist(path)
+	if err != nil {
+		t.Fatalf("LoadAllowlist failed: %v", err)
+	}
+	if remaining := report.Filter(allowlist); len(remaining.Findings) != 0 || remaining.Check() != nil {
+		t.Errorf("Expected all findings to be allowed, got %+v", remaining.Findings)
+	}
+}
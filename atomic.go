@@ -0,0 +1,143 @@
+package qtcwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// pendingSuffix is appended to generated files while they are being written.
+const pendingSuffix = ".qtcwrap-tmp"
+
+// replacedSuffix is appended to existing generated files while the files
+// replacing them are swapped into place.
+const replacedSuffix = ".qtcwrap-old"
+
+// pendingFile is a generated file waiting to be swapped into place.
+type pendingFile struct {
+	// path is the final location of the file.
+	path string
+
+	// data is the file content.
+	data []byte
+}
+
+// compileAtomic compiles templates in place with all-or-nothing semantics.
+//
+// The templates are compiled in a temporary copy of the tree. Only when every
+// template compiles successfully are the generated files swapped into place
+// next to their templates; on failure the existing generated code is left
+// untouched.
+func compileAtomic(ctx context.Context, config Config) (*Result, error) {
+	return compileStaged(ctx, config, templateRoot(config), false)
+}
+
+// commitFiles writes all pending files and swaps them into place.
+//
+// Every file is first written next to its destination under a temporary
+// name. The files are renamed into place only once all of them were written,
+// so a failure while writing leaves the existing files untouched.
+//
+// Existing files are moved aside before being replaced and are deleted once
+// every file is in place. When a rename fails, the files already swapped are
+// removed and the moved files are restored, so the output tree is never left
+// half updated.
+func commitFiles(files []pendingFile) error {
+	written := make([]string, 0, len(files))
+	cleanup := func() {
+		for _, path := range written {
+			_ = os.Remove(path)
+		}
+	}
+
+	for _, file := range files {
+		dir := filepath.Dir(file.path)
+		if err := os.MkdirAll(dir, outputDirPerm); err != nil {
+			cleanup()
+			return fmt.Errorf("cannot create output directory %s: %w", dir, err)
+		}
+
+		tmp := file.path + pendingSuffix
+		// #nosec G306 -- generated Go sources are meant to be readable like any other source file
+		if err := os.WriteFile(tmp, file.data, generatedFilePerm); err != nil {
+			cleanup()
+			return fmt.Errorf("cannot write %s: %w", tmp, err)
+		}
+		written = append(written, tmp)
+	}
+
+	swapped := make([]swappedFile, 0, len(files))
+	for _, file := range files {
+		swap, err := swapFile(file.path)
+		if err != nil {
+			cleanup()
+			return errors.Join(err, restoreFiles(swapped))
+		}
+		swapped = append(swapped, swap)
+	}
+
+	var errs []error
+	for _, swap := range swapped {
+		if swap.replaced {
+			if err := os.Remove(swap.path + replacedSuffix); err != nil {
+				errs = append(errs, fmt.Errorf("cannot remove replaced file %s: %w", swap.path+replacedSuffix, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// swappedFile is a file renamed into place by commitFiles.
+type swappedFile struct {
+	// path is the location of the file.
+	path string
+
+	// replaced reports whether an existing file was moved aside to
+	// path+replacedSuffix.
+	replaced bool
+}
+
+// swapFile moves the existing file at path aside, if there is one, and
+// renames the pending file into its place. On failure the moved file is
+// put back.
+func swapFile(path string) (swappedFile, error) {
+	swap := swappedFile{path: path}
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err := os.Rename(path, path+replacedSuffix); err != nil {
+			return swap, fmt.Errorf("cannot move %s aside: %w", path, err)
+		}
+		swap.replaced = true
+	}
+
+	if err := os.Rename(path+pendingSuffix, path); err != nil {
+		err = fmt.Errorf("cannot move %s into place: %w", path, err)
+		if swap.replaced {
+			if restoreErr := os.Rename(path+replacedSuffix, path); restoreErr != nil {
+				err = errors.Join(err, fmt.Errorf("cannot restore %s: %w", path, restoreErr))
+			}
+		}
+		return swap, err
+	}
+	return swap, nil
+}
+
+// restoreFiles undoes swapped files in reverse order: files that replaced
+// an existing file are overwritten by it again, and new files are removed.
+func restoreFiles(swapped []swappedFile) error {
+	var errs []error
+	for i := len(swapped) - 1; i >= 0; i-- {
+		swap := swapped[i]
+		var err error
+		if swap.replaced {
+			err = os.Rename(swap.path+replacedSuffix, swap.path)
+		} else {
+			err = os.Remove(swap.path)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot restore %s: %w", swap.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
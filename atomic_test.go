@@ -0,0 +1,183 @@
+package qtcwrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	// Atomic compilation test constants.
+	staleGeneratedCode = "// stale generated code\n"
+	brokenTemplate     = "{% func Broken( %}"
+)
+
+func TestCommitFiles(t *testing.T) {
+	t.Run("WritesAllFiles", func(t *testing.T) {
+		tempDir := createTempTestDir(t)
+		defer cleanupTempDir(t, tempDir)
+
+		writeTestTemplate(t, tempDir, "a.qtpl.go", staleGeneratedCode)
+		files := []pendingFile{
+			{path: filepath.Join(tempDir, "a.qtpl.go"), data: []byte("package a\n")},
+			{path: filepath.Join(tempDir, "sub", "b.qtpl.go"), data: []byte("package sub\n")},
+		}
+		if err := commitFiles(files); err != nil {
+			t.Fatalf("commitFiles failed: %v", err)
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file.path)
+			if err != nil {
+				t.Fatalf(readGeneratedErr, err)
+			}
+			if string(data) != string(file.data) {
+				t.Errorf("Expected %s to contain %q, got %q", file.path, file.data, data)
+			}
+			for _, suffix := range []string{pendingSuffix, replacedSuffix} {
+				if _, err := os.Stat(file.path + suffix); !os.IsNotExist(err) {
+					t.Errorf("Expected temporary file %s to be removed", file.path+suffix)
+				}
+			}
+		}
+	})
+
+	t.Run("FailureLeavesFilesUntouched", func(t *testing.T) {
+		tempDir := createTempTestDir(t)
+		defer cleanupTempDir(t, tempDir)
+
+		existing := writeTestTemplate(t, tempDir, "a.qtpl.go", staleGeneratedCode)
+		blocker := writeTestTemplate(t, tempDir, "blocker", testContent)
+
+		files := []pendingFile{
+			{path: existing, data: []byte("package a\n")},
+			{path: filepath.Join(blocker, "b.qtpl.go"), data: []byte("package b\n")},
+		}
+		if err := commitFiles(files); err == nil {
+			t.Fatal("Expected error when a target directory cannot be created")
+		}
+
+		data, err := os.ReadFile(existing)
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		if string(data) != staleGeneratedCode {
+			t.Errorf("Expected existing file to stay untouched, got %q", data)
+		}
+		if _, err := os.Stat(existing + pendingSuffix); !os.IsNotExist(err) {
+			t.Error("Expected temporary files to be cleaned up")
+		}
+	})
+
+	t.Run("RenameFailureRestoresFiles", func(t *testing.T) {
+		tempDir := createTempTestDir(t)
+		defer cleanupTempDir(t, tempDir)
+
+		existing := writeTestTemplate(t, tempDir, "a.qtpl.go", staleGeneratedCode)
+		added := filepath.Join(tempDir, "b.qtpl.go")
+		// A non-empty directory cannot be replaced by a file, so the last
+		// rename fails after the first two files were swapped.
+		blocker := filepath.Join(tempDir, "c.qtpl.go")
+		writeTestTemplate(t, blocker, "keep", testContent)
+
+		files := []pendingFile{
+			{path: existing, data: []byte("package a\n")},
+			{path: added, data: []byte("package a\n")},
+			{path: blocker, data: []byte("package a\n")},
+		}
+		if err := commitFiles(files); err == nil {
+			t.Fatal("Expected error when a file cannot be moved into place")
+		}
+
+		data, err := os.ReadFile(existing)
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		if string(data) != staleGeneratedCode {
+			t.Errorf("Expected existing file to be restored, got %q", data)
+		}
+		for _, path := range []string{added, existing + replacedSuffix, existing + pendingSuffix, blocker + pendingSuffix} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed", path)
+			}
+		}
+	})
+}
+
+func TestCompileAtomicFailure(t *testing.T) {
+	requireQtc(t)
+
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	// qtc compiles files in name order, so a_good.qtpl is compiled before
+	// z_broken.qtpl fails.
+	writeTestTemplate(t, tempDir, "a_good.qtpl", helloTemplate)
+	writeTestTemplate(t, tempDir, "z_broken.qtpl", brokenTemplate)
+	generated := writeTestTemplate(t, tempDir, "a_good.qtpl.go", staleGeneratedCode)
+
+	if _, err := Compile(Config{Dir: tempDir, Atomic: true}); err == nil {
+		t.Fatal("Expected compilation error")
+	}
+
+	data, err := os.ReadFile(generated)
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+	if string(data) != staleGeneratedCode {
+		t.Errorf("Expected existing generated code to stay untouched, got %q", data)
+	}
+}
+
+func TestCompileAtomicMatchesInPlace(t *testing.T) {
+	requireQtc(t)
+
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	srcDir := filepath.Join(tempDir, templatesDir)
+	writeTestTemplate(t, srcDir, "hello.qtpl", helloTemplate)
+	writeTestTemplate(t, srcDir, "sub/other.qtpl", helloTemplate)
+
+	for _, skipLineComments := range []bool{true, false} {
+		config := Config{Dir: srcDir, SkipLineComments: skipLineComments}
+
+		if _, err := Compile(config); err != nil {
+			t.Fatalf("In-place compilation failed: %v", err)
+		}
+		expected := readGeneratedFiles(t, srcDir)
+
+		config.Atomic = true
+		result, err := Compile(config)
+		if err != nil {
+			t.Fatalf("Atomic compilation failed: %v", err)
+		}
+		if len(result.Generated) != len(expected) {
+			t.Fatalf("Expected %d generated files, got %v", len(expected), result.Generated)
+		}
+
+		for path, code := range readGeneratedFiles(t, srcDir) {
+			if code != expected[path] {
+				t.Errorf("Atomic output for %s differs from in-place output (skipLineComments=%t)", path, skipLineComments)
+			}
+		}
+	}
+}
+
+// readGeneratedFiles returns the content of all generated Go files below dir.
+func readGeneratedFiles(t *testing.T, dir string) map[string]string {
+	files, err := FindTemplateFiles(dir, goExt)
+	if err != nil {
+		t.Fatalf(findTemplateFilesErr, err)
+	}
+
+	generated := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		generated[file] = string(data)
+	}
+	return generated
+}
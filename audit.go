@@ -0,0 +1,451 @@
+package qtcwrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// AuditFinding is an output tag that may write unsafe HTML.
+type AuditFinding struct {
+	// Position is the template position of the output tag.
+	Position Position `json:"position"`
+
+	// Func is the template func writing the value, such as "Page" or
+	// "BasePage.Title" for methods.
+	Func string `json:"func"`
+
+	// Tag is the name of the output tag, such as "s=".
+	Tag string `json:"tag"`
+
+	// Expr is the Go expression written by the tag.
+	Expr string `json:"expr"`
+
+	// Context is the HTML context the value is written in.
+	Context OutputContext `json:"context"`
+
+	// Params lists the parameters of the template func, including its
+	// receiver, that the value is derived from. It is empty for values
+	// that do not come from the caller.
+	Params []string `json:"params,omitempty"`
+
+	// Rule is RuleRawOutput or RuleOutputContext.
+	Rule string `json:"rule"`
+
+	// Severity classifies the finding.
+	Severity Severity `json:"severity"`
+
+	// Message describes the risk.
+	Message string `json:"message"`
+}
+
+// FromParam reports whether the value is derived from a parameter of the
+// template func, so its safety depends on the callers.
+func (f AuditFinding) FromParam() bool {
+	return len(f.Params) > 0
+}
+
+// Site returns the output tag as written in the template, such as
+// "{%s= p.Body %}".
+func (f AuditFinding) Site() string {
+	return "{%" + f.Tag + " " + f.Expr + " %}"
+}
+
+// AuditReport holds the findings of a security audit.
+type AuditReport struct {
+	// Findings lists the findings in template and position order.
+	Findings []AuditFinding `json:"findings"`
+}
+
+// outputEscaping describes how an output tag escapes the value it writes.
+type outputEscaping int
+
+const (
+	// escapeNone writes the value as is, as {%s= %} does.
+	escapeNone outputEscaping = iota
+
+	// escapeCall writes the output of a template func as is, as {%= %}
+	// does.
+	escapeCall
+
+	// escapeHTML escapes HTML special characters, as {%s %} does.
+	escapeHTML
+
+	// escapeJSON escapes the value as a JSON string without quotes, as
+	// {%j= %} does.
+	escapeJSON
+
+	// escapeQuotedJSON writes the value as a quoted JSON string, as {%q= %}
+	// does.
+	escapeQuotedJSON
+
+	// escapeJSONHTML escapes the value as a JSON string without quotes and
+	// then escapes HTML, as {%j %} does.
+	escapeJSONHTML
+
+	// escapeQuotedJSONHTML writes the value as a quoted JSON string and
+	// then escapes HTML, as {%q %} does.
+	escapeQuotedJSONHTML
+
+	// escapeURL URL-encodes the value, as {%u %} does.
+	escapeURL
+
+	// escapeNumber writes a number, as {%d %} does.
+	escapeNumber
+)
+
+// tagEscaping maps the output tags to the escaping quicktemplate applies.
+var tagEscaping = map[string]outputEscaping{
+	"s": escapeHTML, "v": escapeHTML, "z": escapeHTML, "sz": escapeHTML, "=h": escapeHTML,
+	"s=": escapeNone, "v=": escapeNone, "z=": escapeNone, "sz=": escapeNone,
+	"=":  escapeCall,
+	"j=": escapeJSON, "jz=": escapeJSON, "=j": escapeJSON,
+	"q=": escapeQuotedJSON, "qz=": escapeQuotedJSON, "=q": escapeQuotedJSON,
+	"j": escapeJSONHTML, "jz": escapeJSONHTML, "=jh": escapeJSONHTML,
+	"q": escapeQuotedJSONHTML, "qz": escapeQuotedJSONHTML, "=qh": escapeQuotedJSONHTML,
+	"u": escapeURL, "uz": escapeURL, "u=": escapeURL, "uz=": escapeURL, "=u": escapeURL, "=uh": escapeURL,
+	"d": escapeNumber, "dl": escapeNumber, "dul": escapeNumber, "f": escapeNumber,
+	"d=": escapeNumber, "dl=": escapeNumber, "dul=": escapeNumber, "f=": escapeNumber,
+}
+
+// auditOutput returns the rule, severity and message of a value written
+// with the given escaping in the given context, or an empty rule if the
+// escaping suits the context.
+func auditOutput(escaping outputEscaping, context OutputContext) (string, Severity, string) {
+	scriptContext := context == ContextScript || context == ContextScriptString
+	switch escaping {
+	case escapeNone:
+		return RuleRawOutput, SeverityError, "value is written without escaping"
+	case escapeCall:
+		return RuleRawOutput, SeverityWarning, "output of the template func is written without escaping"
+	case escapeHTML:
+		switch context {
+		case ContextScript, ContextScriptString, ContextEventHandler:
+			return RuleOutputContext, SeverityError, "HTML escaping does not protect JavaScript; use {%q= %} or {%j= %} in scripts and {%q %} or {%j %} in event handlers"
+		case ContextTag, ContextUnquotedAttribute:
+			return RuleOutputContext, SeverityError, "HTML escaping does not prevent adding attributes; write the value inside a quoted attribute"
+		}
+	case escapeJSON, escapeQuotedJSON:
+		if context == ContextScript && escaping == escapeJSON {
+			return RuleOutputContext, SeverityError, "unquoted JSON string in script code; use {%q= %} or write it inside a string literal"
+		}
+		if !scriptContext {
+			return RuleRawOutput, SeverityError, "JSON escaping does not escape HTML; use {%j %} or {%q %} outside scripts"
+		}
+	case escapeJSONHTML, escapeQuotedJSONHTML:
+		switch {
+		case context == ContextScript && escaping == escapeJSONHTML:
+			return RuleOutputContext, SeverityError, "unquoted JSON string in script code; use {%q= %} or write it inside a string literal"
+		case scriptContext:
+			return RuleOutputContext, SeverityWarning, "HTML escaping is not decoded in scripts and corrupts the value; use {%j= %} or {%q= %}"
+		case context == ContextTag || context == ContextUnquotedAttribute:
+			return RuleOutputContext, SeverityError, "JSON string outside a quoted attribute can add attributes; write the value inside a quoted attribute"
+		case context != ContextEventHandler:
+			return RuleOutputContext, SeverityWarning, "JSON string outside a script or event handler; use {%s %}"
+		}
+	case escapeURL:
+		if context != ContextAttribute && context != ContextUnquotedAttribute {
+			return RuleOutputContext, SeverityWarning, "URL-encoded value outside an attribute value"
+		}
+	}
+	return "", "", ""
+}
+
+// Audit scans the templates selected by config for output tags that may
+// write unsafe HTML.
+//
+// Every raw output, such as {%s= %}, is reported, except for numbers and
+// JSON strings written in scripts with {%j= %} or {%q= %}, which is how
+// values are meant to be passed to JavaScript. Escaped outputs are
+// reported when the escaping does not suit the HTML context, such as
+// {%s %} inside <script> or {%j %} outside scripts and event handlers.
+//
+// Each finding lists the parameters of the template func its value is
+// derived from, following assignments in for, if, switch and code tags, so
+// reviewers can tell values controlled by callers from constants. The
+// templates are only scanned, so neither qtc nor compilation is needed.
+//
+// Example:
+//
+//	report, err := Audit(Config{Dir: "templates"})
+//	if err != nil {
+//	    fmt.Printf("Cannot audit templates: %v\n", err)
+//	    return
+//	}
+//	allowlist, _ := LoadAllowlist("templates/.qtcwrap-audit")
+//	if err := report.Filter(allowlist).Check(); err != nil {
+//	    fmt.Println(err)
+//	}
+func Audit(config Config) (*AuditReport, error) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{}
+	for _, template := range templates {
+		src, err := os.ReadFile(template) // #nosec G304 -- templates are selected by the caller's configuration
+		if err != nil {
+			return nil, fmt.Errorf("cannot read template %s: %w", template, err)
+		}
+		tags, err := scanTags(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan template %s: %w", template, err)
+		}
+		report.Findings = append(report.Findings, auditTags(template, tags)...)
+	}
+	return report, nil
+}
+
+// auditTags returns the findings of the tags of a template.
+func auditTags(template string, tags []templateTag) []AuditFinding {
+	var findings []AuditFinding
+	var fn string
+	var params paramOrigins
+	var html *htmlContext
+	for _, tag := range tags {
+		switch {
+		case tag.name == "func":
+			fn, params = funcParams(tag.value)
+			html = newHTMLContext()
+			continue
+		case tag.name == "endfunc":
+			fn, params, html = "", nil, nil
+			continue
+		case html == nil:
+			continue
+		}
+
+		html.advance(tag.text)
+		switch tag.name {
+		case "for", "if", "elseif", "switch", "code":
+			params.assign(tag)
+		}
+
+		escaping, ok := tagEscaping[tag.name]
+		if !ok {
+			continue
+		}
+		context := html.output()
+		rule, severity, message := auditOutput(escaping, context)
+		if rule == "" {
+			continue
+		}
+		findings = append(findings, AuditFinding{
+			Position: Position{File: template, Line: tag.line},
+			Func:     fn,
+			Tag:      tag.name,
+			Expr:     tag.value,
+			Context:  context,
+			Params:   params.of(tag.value),
+			Rule:     rule,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+	return findings
+}
+
+// paramOrigins maps the variables of a template func to the parameters
+// their values are derived from.
+type paramOrigins map[string][]string
+
+// funcParams returns the name of the template func declared by a func tag
+// and the origins of its parameters and receiver.
+func funcParams(decl string) (string, paramOrigins) {
+	params := make(paramOrigins)
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p\nfunc "+decl+" {}", 0)
+	if err != nil || len(file.Decls) == 0 {
+		name, _, _ := strings.Cut(decl, "(")
+		return strings.TrimSpace(name), params
+	}
+
+	fn, ok := file.Decls[0].(*ast.FuncDecl)
+	if !ok {
+		return "", params
+	}
+	name := fn.Name.Name
+	fields := fn.Type.Params.List
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := fn.Recv.List[0]
+		name = strings.TrimPrefix(receiverTypeName(recv.Type), "*") + "." + name
+		fields = append(fields, recv)
+	}
+	for _, field := range fields {
+		for _, ident := range field.Names {
+			params[ident.Name] = []string{ident.Name}
+		}
+	}
+	return name, params
+}
+
+// receiverTypeName returns the type name of a receiver, such as
+// "*BasePage" for "(p *BasePage)".
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	}
+	return ""
+}
+
+// assign records the variables declared or assigned by a for, if,
+// elseif, switch or code tag. Variables get the origins of the values
+// assigned to them; scopes are not tracked.
+func (p paramOrigins) assign(tag templateTag) {
+	code := parseTagCode(token.NewFileSet(), tag)
+	if code == nil {
+		return
+	}
+
+	ast.Inspect(code, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			origins := p.exprs(n.Rhs...)
+			for _, lhs := range n.Lhs {
+				p.set(lhs, origins)
+			}
+		case *ast.RangeStmt:
+			origins := p.exprs(n.X)
+			p.set(n.Key, origins)
+			p.set(n.Value, origins)
+		case *ast.ValueSpec:
+			origins := p.exprs(n.Values...)
+			for _, name := range n.Names {
+				p.set(name, origins)
+			}
+		}
+		return true
+	})
+}
+
+// set records the origins of the variable assigned by expr, if any.
+func (p paramOrigins) set(expr ast.Expr, origins []string) {
+	if ident, ok := expr.(*ast.Ident); ok && ident.Name != "_" {
+		p[ident.Name] = origins
+	}
+}
+
+// of returns the parameters the Go expression is derived from.
+func (p paramOrigins) of(expr string) []string {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil
+	}
+	return p.exprs(parsed)
+}
+
+// exprs returns the parameters the expressions are derived from, sorted
+// and without duplicates.
+func (p paramOrigins) exprs(exprs ...ast.Expr) []string {
+	seen := make(map[string]bool)
+	var origins []string
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				// Only the operand can refer to a variable, not the selected
+				// field or method.
+				ast.Inspect(n.X, func(n ast.Node) bool {
+					return p.collect(n, seen, &origins)
+				})
+				return false
+			default:
+				return p.collect(n, seen, &origins)
+			}
+		})
+	}
+	sort.Strings(origins)
+	return origins
+}
+
+// collect adds the origins of an identifier to origins.
+func (p paramOrigins) collect(n ast.Node, seen map[string]bool, origins *[]string) bool {
+	if _, ok := n.(*ast.SelectorExpr); ok {
+		return true
+	}
+	ident, ok := n.(*ast.Ident)
+	if !ok {
+		return true
+	}
+	for _, origin := range p[ident.Name] {
+		if !seen[origin] {
+			seen[origin] = true
+			*origins = append(*origins, origin)
+		}
+	}
+	return true
+}
+
+// Filter returns the report without the findings allowed by the
+// allowlist. A nil allowlist allows nothing.
+func (r *AuditReport) Filter(allowlist *Allowlist) *AuditReport {
+	filtered := &AuditReport{}
+	for _, finding := range r.Findings {
+		if !allowlist.Allows(finding) {
+			filtered.Findings = append(filtered.Findings, finding)
+		}
+	}
+	return filtered
+}
+
+// Diagnostics returns the findings as diagnostics, so they can be written
+// as SARIF or JUnit with Report.
+func (r *AuditReport) Diagnostics() []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(r.Findings))
+	for _, finding := range r.Findings {
+		message := fmt.Sprintf("%s in %s: %s", finding.Site(), finding.Context, finding.Message)
+		if finding.FromParam() {
+			message += fmt.Sprintf(" (derived from parameter %s)", strings.Join(finding.Params, ", "))
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     finding.Position.File,
+			Line:     finding.Position.Line,
+			Rule:     finding.Rule,
+			Severity: finding.Severity,
+			Message:  message,
+		})
+	}
+	return diagnostics
+}
+
+// Check returns a *CheckError with the diagnostics of all findings if any
+// finding is an error, or nil if there are only warnings. Filter the
+// report with an allowlist first to accept reviewed call sites.
+//
+// Example:
+//
+//	if err := report.Filter(allowlist).Check(); err != nil {
+//	    fmt.Println(err)
+//	    os.Exit(1)
+//	}
+func (r *AuditReport) Check() error {
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			return &CheckError{Diagnostics: r.Diagnostics()}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the findings as an indented JSON document.
+func (r *AuditReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("cannot write audit report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// auditTemplate is a template with findings of every kind.
+const auditTemplate = `{% import "strings" %}
+
+{% func Page(title string, items []string) %}
+<script>
+	var title = {%q= title %};
+	var raw = {%j= title %};
+	var escaped = {%s title %};
+</script>
+<h1 onclick="show({%q title %})">{%s= strings.ToUpper(title) %}</h1>
+<a href={%s title %} title="{%s title %}">{%d len(items) %}</a>
+{% for _, item := range items %}
+	<li>{%s= item %}</li>
+{% endfor %}
+{% code note := "<b>static</b>" %}
+{%s= note %}
+{%= Footer() %}
+{% endfunc %}
+
+{% func (p *BasePage) Footer() %}<a href="?q={%u p.Query %}">{%u p.Query %}</a>{% endfunc %}
+`
+
+// auditSite identifies a finding in tests.
+type auditSite struct {
+	line     int
+	site     string
+	context  OutputContext
+	rule     string
+	severity Severity
+	params   []string
+}
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplate(t, dir, "page.qtpl", auditTemplate)
+
+	report, err := Audit(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+
+	expected := []auditSite{
+		{6, "{%j= title %}", ContextScript, RuleOutputContext, SeverityError, []string{"title"}},
+		{7, "{%s title %}", ContextScript, RuleOutputContext, SeverityError, []string{"title"}},
+		{9, "{%s= strings.ToUpper(title) %}", ContextText, RuleRawOutput, SeverityError, []string{"title"}},
+		{10, "{%s title %}", ContextUnquotedAttribute, RuleOutputContext, SeverityError, []string{"title"}},
+		{12, "{%s= item %}", ContextText, RuleRawOutput, SeverityError, []string{"items"}},
+		{15, "{%s= note %}", ContextText, RuleRawOutput, SeverityError, nil},
+		{16, "{%= Footer() %}", ContextText, RuleRawOutput, SeverityWarning, nil},
+		{19, "{%u p.Query %}", ContextText, RuleOutputContext, SeverityWarning, []string{"p"}},
+	}
+	if len(report.Findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %+v", len(expected), report.Findings)
+	}
+	for i, want := range expected {
+		finding := report.Findings[i]
+		if finding.Position.Line != want.line || finding.Site() != want.site || finding.Context != want.context ||
+			finding.Rule != want.rule || finding.Severity != want.severity || !slices.Equal(finding.Params, want.params) {
+			t.Errorf("Finding %d: expected %+v, got %+v", i, want, finding)
+		}
+		if finding.FromParam() != (len(want.params) > 0) {
+			t.Errorf("Finding %d: unexpected FromParam %v", i, finding.FromParam())
+		}
+	}
+	if report.Findings[0].Func != "Page" || report.Findings[7].Func != "BasePage.Footer" {
+		t.Errorf("Unexpected funcs %q and %q", report.Findings[0].Func, report.Findings[7].Func)
+	}
+}
+
+func TestAuditOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		context  OutputContext
+		rule     string
+		severity Severity
+	}{
+		{"EscapedText", "s", ContextText, "", ""},
+		{"EscapedAttribute", "s", ContextAttribute, "", ""},
+		{"EscapedEventHandler", "s", ContextEventHandler, RuleOutputContext, SeverityError},
+		{"EscapedTag", "v", ContextTag, RuleOutputContext, SeverityError},
+		{"RawInScript", "s=", ContextScript, RuleRawOutput, SeverityError},
+		{"EscapedCall", "=h", ContextText, "", ""},
+		{"QuotedJSONInScript", "q=", ContextScript, "", ""},
+		{"JSONInScriptString", "j=", ContextScriptString, "", ""},
+		{"JSONInAttribute", "j=", ContextAttribute, RuleRawOutput, SeverityError},
+		{"EscapedJSONInEventHandler", "j", ContextEventHandler, "", ""},
+		{"EscapedJSONInScript", "q", ContextScript, RuleOutputContext, SeverityWarning},
+		{"EscapedJSONInScriptCode", "j", ContextScript, RuleOutputContext, SeverityError},
+		{"EscapedJSONUnquotedAttribute", "q", ContextUnquotedAttribute, RuleOutputContext, SeverityError},
+		{"URLInAttribute", "u", ContextAttribute, "", ""},
+		{"URLInScript", "u", ContextScript, RuleOutputContext, SeverityWarning},
+		{"RawNumber", "d=", ContextScript, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, severity, _ := auditOutput(tagEscaping[tt.tag], tt.context)
+			if rule != tt.rule || severity != tt.severity {
+				t.Errorf("Expected %q/%q, got %q/%q", tt.rule, tt.severity, rule, severity)
+			}
+		})
+	}
+}
+
+func TestParamOrigins(t *testing.T) {
+	tests := []struct {
+		name     string
+		decl     string
+		assigns  [][2]string
+		expr     string
+		fn       string
+		expected []string
+	}{
+		{"Param", "Page(title string)", nil, "title", "Page", []string{"title"}},
+		{"Field", "Page(p Page)", nil, "p.Title", "Page", []string{"p"}},
+		{"SelectorName", "Page(Title string, p Page)", nil, "p.Title", "Page", []string{"p"}},
+		{"Constant", "Page(title string)", nil, `"static"`, "Page", nil},
+		{"Receiver", "(b *BasePage) Body()", nil, "b.Body()", "BasePage.Body", []string{"b"}},
+		{"Generic", "(b List[T]) Item(i int)", nil, "b.At(i)", "List.Item", []string{"b", "i"}},
+		{"Range", "List(items []string)", [][2]string{{"for", "_, item := range items"}}, "item", "List", []string{"items"}},
+		{"IfInit", "Page(p Page)", [][2]string{{"if", `v := p.Get("x"); v != ""`}}, "v", "Page", []string{"p"}},
+		{"Code", "Page(a, b string)", [][2]string{{"code", "x := a + b\nvar y = x"}}, "y", "Page", []string{"a", "b"}},
+		{"Reassigned", "Page(a string)", [][2]string{{"code", `a := "static"`}}, "a", "Page", nil},
+		{"InvalidExpr", "Page(a string)", nil, "a +", "Page", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, params := funcParams(tt.decl)
+			for _, assign := range tt.assigns {
+				params.assign(templateTag{name: assign[0], value: assign[1]})
+			}
+			if fn != tt.fn {
+				t.Errorf("Expected func %q, got %q", tt.fn, fn)
+			}
+			if origins := params.of(tt.expr); !slices.Equal(origins, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, origins)
+			}
+		})
+	}
+}
+
+func TestAuditReportCheck(t *testing.T) {
+	warning := AuditFinding{Position: Position{File: "a.qtpl", Line: 3}, Func: "A", Tag: "=", Expr: "B()", Context: ContextText, Rule: RuleRawOutput, Severity: SeverityWarning, Message: "raw"}
+	failure := AuditFinding{Position: Position{File: "a.qtpl", Line: 5}, Func: "A", Tag: "s=", Expr: "p.Body", Context: ContextText, Params: []string{"p"}, Rule: RuleRawOutput, Severity: SeverityError, Message: "raw"}
+
+	if err := (&AuditReport{Findings: []AuditFinding{warning}}).Check(); err != nil {
+		t.Errorf("Expected warnings to pass, got %v", err)
+	}
+
+	err := (&AuditReport{Findings: []AuditFinding{warning, failure}}).Check()
+	var checkErr *CheckError
+	if !errors.As(err, &checkErr) || len(checkErr.Diagnostics) != 2 {
+		t.Fatalf("Expected a *CheckError with both findings, got %v", err)
+	}
+	expected := "a.qtpl:5: {%s= p.Body %} in text: raw (derived from parameter p)"
+	if checkErr.Diagnostics[1].String() != expected {
+		t.Errorf("Expected %q, got %q", expected, checkErr.Diagnostics[1].String())
+	}
+}
+
+func TestAuditReportWriteJSON(t *testing.T) {
+	report := &AuditReport{Findings: []AuditFinding{{Position: Position{File: "a.qtpl", Line: 5}, Func: "A", Tag: "s=", Expr: "p.Body", Context: ContextUnquotedAttribute, Params: []string{"p"}, Rule: RuleRawOutput, Severity: SeverityError}}}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"context": "unquoted attribute"`) {
+		t.Errorf("Expected the context in the JSON report, got %s", buf.String())
+	}
+	var decoded AuditReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(decoded.Findings) != 1 || decoded.Findings[0].Site() != "{%s= p.Body %}" {
+		t.Errorf("Unexpected findings %+v", decoded.Findings)
+	}
+}
+
+func TestAuditErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Audit(Config{Dir: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+
+	writeTestTemplate(t, dir, "broken.qtpl", "{% func A() %}{%s x ")
+	if _, err := Audit(Config{Dir: dir}); err == nil || !strings.Contains(err.Error(), "unterminated tag") {
+		t.Errorf("Expected an unterminated tag error, got %v", err)
+	}
+}
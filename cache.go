@@ -0,0 +1,299 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheKeyVersion changes whenever the layout of cache keys changes.
+	cacheKeyVersion = "qtcwrap-cache-v1"
+
+	// quicktemplateModule is the module path of quicktemplate.
+	quicktemplateModule = "github.com/valyala/quicktemplate"
+
+	// cacheFilePerm is the permission used for cache entries.
+	cacheFilePerm = 0o600
+)
+
+// compileCached compiles templates through the build cache in
+// config.CacheDir.
+//
+// Every template is looked up by a key derived from its content and path,
+// the compiler version and the compiler arguments. When all templates are
+// found, the cached generated files are restored without running the
+// compiler; files whose content is unchanged are not rewritten. Otherwise
+// the templates are compiled as usual and the generated files are stored in
+// the cache. With Coverage, the instrumented files are cached, so restored
+// files are final and not instrumented again.
+func compileCached(ctx context.Context, config Config) (*Result, error) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := compilerVersion(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(templates))
+	for i, template := range templates {
+		if keys[i], err = cacheKey(config, version, template); err != nil {
+			return nil, err
+		}
+	}
+
+	pending := make([]pendingFile, 0, len(templates))
+	for i, template := range templates {
+		data, err := os.ReadFile(cachePath(config.CacheDir, keys[i]))
+		if err != nil {
+			break
+		}
+		pending = append(pending, pendingFile{path: generatedPath(config, template), data: data})
+	}
+
+	if len(templates) > 0 && len(pending) == len(templates) {
+		return restoreCached(templates, pending)
+	}
+
+	result, err := compileInstrumented(ctx, config)
+	if err != nil {
+		return result, err
+	}
+	for i, generated := range result.Generated {
+		if err := storeCached(config.CacheDir, keys[i], generated); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// restoreCached installs cached generated files. Files that already hold
+// the cached content are left untouched.
+func restoreCached(templates []string, cached []pendingFile) (*Result, error) {
+	result := &Result{Templates: templates}
+	changed := make([]pendingFile, 0, len(cached))
+	for _, file := range cached {
+		result.Generated = append(result.Generated, file.path)
+		result.Cached = append(result.Cached, file.path)
+
+		current, err := os.ReadFile(file.path)
+		if err == nil && bytes.Equal(current, file.data) {
+			continue
+		}
+		changed = append(changed, file)
+	}
+
+	if err := commitFiles(changed); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// storeCached copies a generated file into the cache. The entry is written
+// under a temporary name first, so concurrent readers never observe a
+// partial entry.
+func storeCached(cacheDir, key, generated string) error {
+	data, err := os.ReadFile(generated)
+	if err != nil {
+		return fmt.Errorf("cannot read generated file %s: %w", generated, err)
+	}
+
+	entry := cachePath(cacheDir, key)
+	if err := os.MkdirAll(filepath.Dir(entry), outputDirPerm); err != nil {
+		return fmt.Errorf("cannot create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(entry), key+"-*"+pendingSuffix)
+	if err != nil {
+		return fmt.Errorf("cannot create cache entry: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("cannot write cache entry: %w", err)
+	}
+	if err := tmp.Chmod(cacheFilePerm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("cannot write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), entry); err != nil {
+		return fmt.Errorf("cannot store cache entry: %w", err)
+	}
+	return nil
+}
+
+// cachePath returns the location of a cache entry. Entries are spread over
+// subdirectories named after the first two characters of their key, like
+// GOCACHE does.
+func cachePath(cacheDir, key string) string {
+	return filepath.Join(cacheDir, key[:2], key)
+}
+
+// cacheKey derives the cache key of a template.
+//
+// The key covers everything the generated code depends on: the template
+// content, the template path as passed to the compiler (it appears in line
+// comments and determines the package name), the target path, the compiler
+// version and the compiler arguments. With Coverage, the key also covers the
+// name the instrumented code registers the template with.
+func cacheKey(config Config, version, template string) (string, error) {
+	content, err := os.ReadFile(template)
+	if err != nil {
+		return "", fmt.Errorf("cannot read template %s: %w", template, err)
+	}
+	contentHash := sha256.Sum256(content)
+
+	absTemplate, err := filepath.Abs(template)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s: %w", template, err)
+	}
+
+	h := sha256.New()
+	fields := []string{
+		cacheKeyVersion,
+		version,
+		strings.Join(buildArgs(config), "\x00"),
+		template,
+		filepath.Base(filepath.Dir(absTemplate)),
+		generatedPath(config, template),
+		hex.EncodeToString(contentHash[:]),
+	}
+	if config.Coverage {
+		name, err := coverTemplateName(template)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, "coverage", name)
+	}
+	for _, field := range fields {
+		_, _ = io.WriteString(h, field)
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// generatedPath returns where the code generated for template ends up.
+func generatedPath(config Config, template string) string {
+	if config.OutputDir == "" {
+		return template + ".go"
+	}
+
+	rel, err := filepath.Rel(templateRoot(config), template)
+	if err != nil {
+		rel = filepath.Base(template)
+	}
+	return filepath.Join(config.OutputDir, rel+".go")
+}
+
+// qtcBinaryID identifies a qtc binary file, so its version is only
+// determined again after the binary is replaced.
+type qtcBinaryID struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// qtcVersions memoizes the compiler versions of qtc binaries.
+var qtcVersions sync.Map // qtcBinaryID -> string
+
+// compilerVersion identifies the compiler used by a backend.
+//
+// The exec backend is identified by the version of the configured qtc
+// binary, or by a hash of the binary when it does not report a semantic
+// version. The version is determined once per binary path, size and
+// modification time, so cache hits do not run qtc. With a Runner installed
+// in ctx, no qtc binary is involved and the type of the Runner identifies
+// the compiler. The embedded backend is identified by the quicktemplate
+// version built into the running program.
+func compilerVersion(ctx context.Context, config Config) (string, error) {
+	if config.Backend == EmbeddedBackend {
+		return "embedded " + embeddedVersion(), nil
+	}
+	if runner, ok := ctx.Value(runnerKey{}).(Runner); ok && runner != nil {
+		return fmt.Sprintf("runner %T", runner), nil
+	}
+
+	binary := qtcBinary(config)
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return "", validateQtcTool(binary)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read qtc binary: %w", err)
+	}
+	id := qtcBinaryID{path: path, size: info.Size(), modTime: info.ModTime()}
+	if version, ok := qtcVersions.Load(id); ok {
+		return version.(string), nil
+	}
+
+	version, err := binaryVersion(path)
+	if err != nil {
+		return "", err
+	}
+	qtcVersions.Store(id, version)
+	return version, nil
+}
+
+// binaryVersion determines the compiler version of the qtc binary at path.
+func binaryVersion(path string) (string, error) {
+	// Development builds report no usable version and are told apart by
+	// their content instead
+	if version, err := qtcVersion(path); err == nil {
+		if _, err := ParseVersion(version); err == nil {
+			return "qtc " + version, nil
+		}
+	}
+
+	f, err := os.Open(path) // #nosec G304 -- path is the configured qtc binary
+	if err != nil {
+		return "", fmt.Errorf("cannot read qtc binary: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("cannot read qtc binary: %w", err)
+	}
+	return "qtc sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// embeddedVersion returns the quicktemplate version the running program
+// was built with, or "unknown" if it is not recorded.
+func embeddedVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != quicktemplateModule {
+			continue
+		}
+		if dep.Replace != nil {
+			return dep.Replace.Path + "@" + dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return "unknown"
+}
@@ -0,0 +1,211 @@
+package qtcwrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valksor/go-qtcwrap/internal/fakeqtc"
+)
+
+const (
+	// Cache test constants.
+	cacheDirName = "cache"
+)
+
+func TestCompileCached(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	template := writeTestTemplate(t, root, "views/page.qtpl", helloTemplate)
+	config := Config{Dir: filepath.Join(root, viewsDir), SkipLineComments: true, Backend: EmbeddedBackend, CacheDir: filepath.Join(root, cacheDirName)}
+
+	result, err := Compile(config)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if len(result.Cached) != 0 {
+		t.Errorf("Expected a cold cache, got %v", result.Cached)
+	}
+	original := readGeneratedFiles(t, config.Dir)
+
+	if err := os.Remove(template + ".go"); err != nil {
+		t.Fatalf("Failed to remove generated file: %v", err)
+	}
+	result, err = Compile(config)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if len(result.Cached) != 1 || result.Cached[0] != template+".go" {
+		t.Fatalf("Expected generated file to be restored from the cache, got %v", result.Cached)
+	}
+	if restored := readGeneratedFiles(t, config.Dir); restored[template+".go"] != original[template+".go"] {
+		t.Error("Expected restored file to match the compiled file")
+	}
+
+	t.Run("TemplateChanged", func(t *testing.T) {
+		writeTestTemplate(t, root, "views/page.qtpl", strings.Replace(helloTemplate, "Hello", "Bye", 1))
+		result, err := Compile(config)
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		if len(result.Cached) != 0 {
+			t.Errorf("Expected a changed template to be recompiled, got %v", result.Cached)
+		}
+	})
+
+	t.Run("OptionsChanged", func(t *testing.T) {
+		withComments := config
+		withComments.SkipLineComments = false
+		result, err := Compile(withComments)
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		if len(result.Cached) != 0 {
+			t.Errorf("Expected different options to miss the cache, got %v", result.Cached)
+		}
+	})
+}
+
+func TestCompileCachedPartialHit(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, "views/a.qtpl", helloTemplate)
+	config := Config{Dir: filepath.Join(root, viewsDir), SkipLineComments: true, Backend: EmbeddedBackend, CacheDir: filepath.Join(root, cacheDirName)}
+	if _, err := Compile(config); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	writeTestTemplate(t, root, "views/b.qtpl", helloTemplate)
+	result, err := Compile(config)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if len(result.Cached) != 0 || len(result.Generated) != 2 {
+		t.Errorf("Expected a full compilation on a partial hit, got %+v", result)
+	}
+
+	result, err = Compile(config)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if len(result.Cached) != 2 {
+		t.Errorf("Expected both templates to be cached, got %v", result.Cached)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	template := writeTestTemplate(t, root, testQtplFile, helloTemplate)
+	config := Config{File: template, SkipLineComments: true}
+
+	base, err := cacheKey(config, "v1", template)
+	if err != nil {
+		t.Fatalf("cacheKey failed: %v", err)
+	}
+
+	other := config
+	other.OutputDir = filepath.Join(root, genDir)
+	variants := []struct {
+		name    string
+		config  Config
+		version string
+	}{
+		{"Version", config, "v2"},
+		{"Arguments", Config{File: template}, "v1"},
+		{"OutputDir", other, "v1"},
+	}
+
+	for _, tt := range variants {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := cacheKey(tt.config, tt.version, template)
+			if err != nil {
+				t.Fatalf("cacheKey failed: %v", err)
+			}
+			if key == base {
+				t.Error("Expected a different cache key")
+			}
+		})
+	}
+
+	if again, _ := cacheKey(config, "v1", template); again != base {
+		t.Error("Expected cache keys to be stable")
+	}
+}
+
+func TestCompilerVersion(t *testing.T) {
+	version, err := compilerVersion(context.Background(), Config{Backend: EmbeddedBackend})
+	if err != nil || !strings.HasPrefix(version, "embedded ") {
+		t.Errorf("Unexpected embedded version %q: %v", version, err)
+	}
+
+	runner := RunnerFunc(func(ctx context.Context, args []string) error { return nil })
+	version, err = compilerVersion(withRunner(context.Background(), runner), Config{Qtc: "/nonexistent/qtc"})
+	if err != nil || version != "runner qtcwrap.RunnerFunc" {
+		t.Errorf("Expected the runner to identify the compiler, got %q: %v", version, err)
+	}
+
+	requireQtc(t)
+	version, err = compilerVersion(context.Background(), Config{Backend: ExecBackend})
+	if err != nil || !strings.HasPrefix(version, "qtc ") {
+		t.Errorf("Unexpected qtc version %q: %v", version, err)
+	}
+}
+
+func TestCompilerVersionMemoized(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+	fake := fakeqtc.Build(t, fakeqtc.Script{Version: "v1.8.0"})
+	config := Config{Qtc: fake.Path}
+
+	for range 2 {
+		version, err := compilerVersion(context.Background(), config)
+		if err != nil || version != "qtc v1.8.0" {
+			t.Fatalf("Unexpected qtc version %q: %v", version, err)
+		}
+	}
+	if calls := fake.Calls(t); len(calls) != 1 {
+		t.Errorf("Expected qtc -version to run once, got %v", calls)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(fake.Path, later, later); err != nil {
+		t.Fatalf("Failed to touch the fake qtc: %v", err)
+	}
+	if _, err := compilerVersion(context.Background(), config); err != nil {
+		t.Fatalf("compilerVersion failed: %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 2 {
+		t.Errorf("Expected a replaced binary to be asked again, got %v", calls)
+	}
+}
+
+func TestCompileCachedWithRunner(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	root := t.TempDir()
+	dir := filepath.Join(root, templatesDir)
+	template := writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	var calls int
+	runner := RunnerFunc(func(ctx context.Context, args []string) error {
+		calls++
+		return os.WriteFile(template+goExt, []byte("package templates\n"), 0o600)
+	})
+	compiler := New(FromConfig(Config{Dir: dir, SkipLineComments: true, CacheDir: filepath.Join(root, cacheDirName)}), WithRunner(runner))
+
+	for range 2 {
+		if _, err := compiler.Compile(context.Background()); err != nil {
+			t.Fatalf("Compile failed without qtc in PATH: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the second compilation to hit the cache, got %d runner calls", calls)
+	}
+}
@@ -0,0 +1,231 @@
+package qtcwrap
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severity classifies diagnostics.
+type Severity string
+
+const (
+	// SeverityError marks diagnostics that fail the compilation.
+	SeverityError Severity = "error"
+
+	// SeverityWarning marks diagnostics that are reported but do not fail
+	// the compilation.
+	SeverityWarning Severity = "warning"
+)
+
+const (
+	// RuleTypeCheck identifies diagnostics reported by the post-build check.
+	RuleTypeCheck = "typecheck"
+
+	// RuleCompile identifies template errors reported by the compiler.
+	RuleCompile = "compile"
+
+	// RuleComplexity identifies templates exceeding a complexity threshold,
+	// as reported by Stats.Check.
+	RuleComplexity = "complexity"
+
+	// RuleRawOutput identifies values written without escaping, as
+	// reported by Audit.
+	RuleRawOutput = "raw-output"
+
+	// RuleOutputContext identifies values whose escaping does not suit the
+	// HTML context they are written in, as reported by Audit.
+	RuleOutputContext = "output-context"
+
+	// RuleUntranslated identifies template text that is not wrapped for
+	// translation, as reported by Catalog.Diagnostics.
+	RuleUntranslated = "untranslated"
+)
+
+// Diagnostic describes a problem found in a template.
+//
+// Positions refer to the template whenever the problem could be mapped back
+// to it, and to the generated Go file otherwise.
+type Diagnostic struct {
+	// File is the path of the file the problem was found in.
+	File string `json:"file"`
+
+	// Line is the 1-based line number, or zero if unknown.
+	Line int `json:"line"`
+
+	// Column is the 1-based column, or zero if unknown.
+	Column int `json:"column,omitempty"`
+
+	// Rule identifies the check that reported the problem.
+	Rule string `json:"rule"`
+
+	// Severity classifies the problem.
+	Severity Severity `json:"severity"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// String returns the diagnostic in the usual "file:line:column: message"
+// form used by the Go toolchain.
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	b.WriteString(d.File)
+	if d.Line > 0 {
+		fmt.Fprintf(&b, ":%d", d.Line)
+		if d.Column > 0 {
+			fmt.Fprintf(&b, ":%d", d.Column)
+		}
+	}
+	b.WriteString(": ")
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// CheckError reports diagnostics that failed a compilation.
+type CheckError struct {
+	// Diagnostics holds the problems that were found.
+	Diagnostics []Diagnostic
+}
+
+// Error implements the error interface.
+func (e *CheckError) Error() string {
+	lines := make([]string, 0, len(e.Diagnostics)+1)
+	lines = append(lines, fmt.Sprintf("%d problem(s) found", len(e.Diagnostics)))
+	for _, diagnostic := range e.Diagnostics {
+		lines = append(lines, diagnostic.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// postBuildCheck type-checks the packages that received generated code and
+// maps the errors back to template positions.
+//
+// Each package directory is checked as a whole, together with its
+// hand-written Go files, since generated code usually refers to them.
+// Imports are resolved from source using the Go module of the package.
+func postBuildCheck(result *Result, skipLineComments bool) ([]Diagnostic, error) {
+	var sourceMaps []*SourceMap
+	dirs := make(map[string]bool)
+	for i, generated := range result.Generated {
+		dirs[filepath.Dir(generated)] = true
+
+		if skipLineComments && i < len(result.Templates) {
+			sourceMap, err := BuildSourceMap(result.Templates[i], generated, true)
+			if err != nil {
+				return nil, err
+			}
+			sourceMaps = append(sourceMaps, sourceMap)
+		}
+	}
+	maps := NewSourceMaps(sourceMaps...)
+
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+
+	var diagnostics []Diagnostic
+	for _, dir := range sorted {
+		found, err := typeCheckDir(dir, maps)
+		if err != nil {
+			return diagnostics, err
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+	return diagnostics, nil
+}
+
+// typeCheckDir type-checks the Go package in dir and returns its errors as
+// diagnostics, translated to template positions with maps.
+func typeCheckDir(dir string, maps *SourceMaps) ([]Diagnostic, error) {
+	fset := token.NewFileSet()
+	files, err := parsePackageDir(fset, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	var diagnostics []Diagnostic
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			var typeErr types.Error
+			if errors.As(err, &typeErr) {
+				diagnostics = append(diagnostics, typeCheckDiagnostic(fset, typeErr, maps))
+			}
+		},
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %w", dir, err)
+	}
+	// Type errors are collected by conf.Error; the returned error is the
+	// first of them.
+	_, _ = conf.Check(absDir, fset, files, nil)
+	return diagnostics, nil
+}
+
+// parsePackageDir parses the non-test Go files in dir.
+func parsePackageDir(fset *token.FileSet, dir string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read package directory %s: %w", dir, err)
+	}
+
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", filepath.Join(dir, name), err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// typeCheckDiagnostic converts a type error into a diagnostic.
+//
+// Positions inside generated files with line comments are already
+// template positions; other positions are translated with the source maps
+// when possible. Columns are dropped for translated positions, since they
+// refer to generated code.
+func typeCheckDiagnostic(fset *token.FileSet, err types.Error, maps *SourceMaps) Diagnostic {
+	diagnostic := Diagnostic{Rule: RuleTypeCheck, Severity: SeverityError, Message: err.Msg}
+
+	adjusted := fset.Position(err.Pos)
+	raw := fset.PositionFor(err.Pos, false)
+
+	switch {
+	case adjusted.Filename != raw.Filename:
+		diagnostic.File = adjusted.Filename
+		diagnostic.Line = adjusted.Line
+	default:
+		if pos, ok := maps.Position(raw.Filename, raw.Line); ok {
+			diagnostic.File = pos.File
+			diagnostic.Line = pos.Line
+		} else {
+			diagnostic.File = raw.Filename
+			diagnostic.Line = raw.Line
+			diagnostic.Column = raw.Column
+		}
+	}
+	return diagnostic
+}
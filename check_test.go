@@ -0,0 +1,103 @@
+package qtcwrap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// Post-build check test constants.
+	testModuleGoMod = "module example.com/site\n\ngo 1.24\n\n" +
+		"require (\n\tgithub.com/valyala/bytebufferpool v1.0.0 // indirect\n\tgithub.com/valyala/quicktemplate v1.8.0\n)\n"
+	badExprTemplate  = "Page templates.\n\n{% func Page(title string) %}\n\t<h1>{%s title %}</h1>\n\t<p>{%s undefinedVar %}</p>\n{% endfunc %}\n"
+	goodExprTemplate = "{% func Page(title string) %}<h1>{%s strings.ToUpper(title) %}</h1>{% endfunc %}\n"
+)
+
+// createTestModule creates a Go module that can build generated templates and
+// returns its root directory.
+func createTestModule(t *testing.T) string {
+	goSum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatalf("Failed to read go.sum: %v", err)
+	}
+
+	root := createTempTestDir(t)
+	t.Cleanup(func() {
+		cleanupTempDir(t, root)
+	})
+
+	writeTestTemplate(t, root, "go.mod", testModuleGoMod)
+	writeTestTemplate(t, root, "go.sum", string(goSum))
+	return root
+}
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		name       string
+		diagnostic Diagnostic
+		expected   string
+	}{
+		{"Full", Diagnostic{File: "a.qtpl", Line: 3, Column: 5, Message: "bad"}, "a.qtpl:3:5: bad"},
+		{"NoColumn", Diagnostic{File: "a.qtpl", Line: 3, Message: "bad"}, "a.qtpl:3: bad"},
+		{"NoLine", Diagnostic{File: "a.qtpl", Column: 5, Message: "bad"}, "a.qtpl: bad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.diagnostic.String(); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPostBuildCheck(t *testing.T) {
+	root := createTestModule(t)
+	template := writeTestTemplate(t, root, filepath.Join("views", "page.qtpl"), badExprTemplate)
+
+	for _, skipLineComments := range []bool{true, false} {
+		config := Config{File: template, SkipLineComments: skipLineComments, Backend: EmbeddedBackend, PostBuildCheck: true}
+
+		result, err := Compile(config)
+		var checkErr *CheckError
+		if !errors.As(err, &checkErr) {
+			t.Fatalf("Expected *CheckError, got %v", err)
+		}
+		if len(result.Diagnostics) != 1 {
+			t.Fatalf("Expected 1 diagnostic, got %v", result.Diagnostics)
+		}
+
+		diagnostic := result.Diagnostics[0]
+		if diagnostic.File != template || diagnostic.Line != 5 {
+			t.Errorf("Expected diagnostic at %s:5, got %s (skipLineComments=%t)", template, diagnostic, skipLineComments)
+		}
+		if diagnostic.Rule != RuleTypeCheck || diagnostic.Severity != SeverityError {
+			t.Errorf("Unexpected rule or severity: %+v", diagnostic)
+		}
+		if !strings.Contains(diagnostic.Message, "undefinedVar") {
+			t.Errorf("Expected message to mention undefinedVar, got %q", diagnostic.Message)
+		}
+		if !strings.Contains(err.Error(), template+":5: ") {
+			t.Errorf("Expected error to contain the template position, got %q", err.Error())
+		}
+	}
+}
+
+func TestPostBuildCheckSuccess(t *testing.T) {
+	root := createTestModule(t)
+	viewsDir := filepath.Join(root, "views")
+	writeTestTemplate(t, viewsDir, "page.qtpl", "{% import \"strings\" %}\n"+goodExprTemplate)
+	writeTestTemplate(t, viewsDir, "helpers.go", "package views\n\nfunc siteName() string { return \"site\" }\n")
+	writeTestTemplate(t, viewsDir, "footer.qtpl", "{% func Footer() %}{%s siteName() %}{% endfunc %}\n")
+
+	result, err := Compile(Config{Dir: viewsDir, SkipLineComments: true, Backend: EmbeddedBackend, PostBuildCheck: true})
+	if err != nil {
+		t.Fatalf("Expected generated package to type-check, got: %v", err)
+	}
+	if len(result.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", result.Diagnostics)
+	}
+}
@@ -0,0 +1,553 @@
+// Command qtcwrap compiles QuickTemplate files using the qtcwrap package.
+//
+// Usage:
+//
+//	qtcwrap [flags]            compile templates as described by the flags
+//	qtcwrap generate [root]    run all qtcwrap directives below root
+//	qtcwrap preview [flags]    serve rendered templates with live reload
+//	qtcwrap stats [flags]      report template size and complexity metrics
+//	qtcwrap audit [flags]      report output tags that may write unsafe HTML
+//	qtcwrap extract [flags]    extract translatable strings into a catalog
+//	qtcwrap cover [flags] profile...
+//	                           report template coverage of instrumented code
+//
+// The flags mirror the fields of qtcwrap.Config; run "qtcwrap -h" for the
+// full list. The command is meant to be used from go:generate directives:
+//
+//	//go:generate qtcwrap -dir=templates
+//
+// "qtcwrap generate" finds all such directives, as well as
+// "qtcwrap:generate" marker lines inside templates, and runs them as one
+// batched, deduplicated compilation.
+//
+// With -json, compilation events are written to stdout as one JSON object
+// per line, like "go test -json", for IDEs and CI dashboards. -sarif and
+// -junit write reports for code scanning and test tabs of CI systems.
+//
+// QTCWRAP_* environment variables, such as QTCWRAP_SKIP_LINE_COMMENTS=false
+// or QTCWRAP_QTC=/opt/bin/qtc, override the flags and directives; see
+// qtcwrap.EnvPrefix.
+//
+// "qtcwrap preview" builds a local web server that renders every template
+// func with sample data from JSON fixtures and reloads on every edit; run
+// "qtcwrap preview -h" for its flags.
+//
+// "qtcwrap stats" writes per-template metrics as CSV or JSON and exits with
+// a non-zero status when a -max-* threshold is exceeded, so CI can stop
+// templates from growing too complex; run "qtcwrap stats -h" for its flags.
+//
+// "qtcwrap audit" lists raw outputs and output tags escaped for the wrong
+// HTML context, and exits with a non-zero status for findings that are
+// not in the -allowlist file; -write-allowlist records the current
+// findings as reviewed.
+//
+// "qtcwrap extract" writes the strings passed to translation funcs, such as
+// T("..."), as a gettext .pot or JSON catalog and reports text that is not
+// wrapped for translation; with -check it exits with a non-zero status when
+// there is any.
+//
+// "qtcwrap cover" merges the profiles written by code compiled with
+// -coverage, such as the QTCWRAP_COVERDIR directory of a test run, and
+// prints the percentage of executed lines per template; -html writes the
+// template sources with executed and missed lines highlighted and -o
+// writes the merged profile.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/valksor/go-qtcwrap"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command and returns the process exit code.
+func run(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "generate":
+			return runGenerate(args[1:])
+		case "preview":
+			return runPreview(args[1:])
+		case "stats":
+			return runStats(args[1:])
+		case "audit":
+			return runAudit(args[1:])
+		case "extract":
+			return runExtract(args[1:])
+		case "cover":
+			return runCover(args[1:])
+		}
+	}
+	return runCompile(args)
+}
+
+// runCompile compiles templates as described by the command-line flags.
+func runCompile(args []string) int {
+	args, output, err := cutOutputFlags(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printUsage()
+		return 2
+	}
+	config, err := qtcwrap.ParseArgs(args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage()
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printUsage()
+		return 2
+	}
+
+	var result *qtcwrap.Result
+	if output.json {
+		result, err = qtcwrap.CompileWithEvents(config, qtcwrap.JSONEvents(os.Stdout))
+	} else {
+		result, err = qtcwrap.Compile(config)
+		if result != nil {
+			for _, override := range result.EnvOverrides {
+				fmt.Fprintf(os.Stderr, "[qtcwrap env] %s = %q (set by %s)\n", override.Field, override.Value, override.Var)
+			}
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(os.Stderr, "[qtc warning suppressed] %s\n", warning)
+			}
+			for _, attempt := range result.Attempts {
+				if attempt.Backoff > 0 {
+					fmt.Fprintf(os.Stderr, "[qtc retry] attempt %d failed, retrying in %s: %v\n", attempt.Number, attempt.Backoff, attempt.Err)
+				}
+			}
+			if config.DryRun {
+				qtcwrap.PrintDryRun(os.Stdout, result)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	report := qtcwrap.Report{Result: result, Err: err}
+	if reportErr := writeReports(report, output); reportErr != nil {
+		fmt.Fprintln(os.Stderr, reportErr)
+		return 1
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// outputFlags holds the flags selecting output formats. They are not part
+// of qtcwrap.Config, so they are handled by the command itself.
+type outputFlags struct {
+	// json writes compilation events to stdout as JSON lines.
+	json bool
+
+	// sarif and junit are the files receiving reports, if any.
+	sarif string
+	junit string
+}
+
+// cutOutputFlags removes the output format flags from the compile
+// arguments. It fails when -sarif or -junit is given without a path.
+func cutOutputFlags(args []string) ([]string, outputFlags, error) {
+	var output outputFlags
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if !strings.HasPrefix(arg, "-") {
+			name = ""
+		}
+		switch name {
+		case "json":
+			output.json = !hasValue || value == "true"
+		case "sarif", "junit":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, output, fmt.Errorf("flag needs an argument: -%s", name)
+				}
+				i++
+				value = args[i]
+			}
+			if name == "sarif" {
+				output.sarif = value
+			} else {
+				output.junit = value
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, output, nil
+}
+
+// writeReports writes the SARIF and JUnit reports selected by the output
+// flags.
+func writeReports(report qtcwrap.Report, output outputFlags) error {
+	reports := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{output.sarif, report.WriteSARIF},
+		{output.junit, report.WriteJUnit},
+	}
+
+	for _, r := range reports {
+		if r.path == "" {
+			continue
+		}
+		f, err := os.Create(r.path) // #nosec G304 -- the report path is chosen by the user running the command
+		if err != nil {
+			return fmt.Errorf("cannot create report: %w", err)
+		}
+		if err := r.write(f); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("cannot write report %s: %w", r.path, err)
+		}
+	}
+	return nil
+}
+
+// runGenerate runs all qtcwrap directives below the given root directory.
+func runGenerate(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: qtcwrap generate [root]")
+		return 2
+	}
+	root := "."
+	if len(args) == 1 {
+		root = args[0]
+	}
+
+	report, err := qtcwrap.Generate(root)
+	if report != nil {
+		for _, pkg := range report.Packages {
+			fmt.Printf("regenerated %s\n", pkg)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runPreview serves rendered templates until interrupted.
+func runPreview(args []string) int {
+	var config qtcwrap.PreviewConfig
+	flags := flag.NewFlagSet("qtcwrap preview", flag.ContinueOnError)
+	flags.StringVar(&config.Dir, "dir", ".", "directory with template files to preview")
+	flags.StringVar(&config.Ext, "ext", "", "comma-separated extensions of template files (default .qtpl)")
+	flags.StringVar(&config.Addr, "addr", qtcwrap.DefaultPreviewAddr, "address to listen on")
+	flags.StringVar(&config.Fixtures, "fixtures", "", "directory with JSON fixtures named <Func>.json (default -dir)")
+	flags.DurationVar(&config.Interval, "interval", qtcwrap.DefaultWatchInterval, "template polling interval")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: qtcwrap preview [flags]")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := qtcwrap.Preview(ctx, config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runStats writes template metrics and checks them against thresholds.
+func runStats(args []string) int {
+	config := qtcwrap.Config{SkipLineComments: true}
+	var thresholds qtcwrap.Thresholds
+	var format string
+	flags := flag.NewFlagSet("qtcwrap stats", flag.ContinueOnError)
+	flags.StringVar(&config.Dir, "dir", ".", "directory with template files to measure")
+	flags.StringVar(&config.Ext, "ext", "", "comma-separated extensions of template files (default .qtpl)")
+	flags.StringVar(&format, "format", "csv", "output format: csv or json")
+	flags.IntVar(&thresholds.MaxLines, "max-lines", 0, "maximum lines per template (0 means unlimited)")
+	flags.IntVar(&thresholds.MaxFuncs, "max-funcs", 0, "maximum funcs per template (0 means unlimited)")
+	flags.IntVar(&thresholds.MaxOutputTags, "max-output-tags", 0, "maximum output tags per template (0 means unlimited)")
+	flags.IntVar(&thresholds.MaxRawOutputs, "max-raw-outputs", 0, "maximum unescaped output tags per template (0 means unlimited)")
+	flags.IntVar(&thresholds.MaxDepth, "max-depth", 0, "maximum control-flow nesting per template (0 means unlimited)")
+	flags.IntVar(&thresholds.MaxGeneratedBytes, "max-generated-bytes", 0, "maximum generated code size per template (0 means unlimited)")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 0 || (format != "csv" && format != "json") {
+		fmt.Fprintln(os.Stderr, "usage: qtcwrap stats [-format=csv|json] [flags]")
+		return 2
+	}
+
+	stats, err := qtcwrap.CollectStats(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	write := stats.WriteCSV
+	if format == "json" {
+		write = stats.WriteJSON
+	}
+	if err := write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := stats.Check(thresholds); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runAudit reports output tags that may write unsafe HTML.
+func runAudit(args []string) int {
+	var config qtcwrap.Config
+	var output outputFlags
+	var allowlistPath, format string
+	var writeAllowlist bool
+	flags := flag.NewFlagSet("qtcwrap audit", flag.ContinueOnError)
+	flags.StringVar(&config.Dir, "dir", ".", "directory with template files to audit")
+	flags.StringVar(&config.Ext, "ext", "", "comma-separated extensions of template files (default .qtpl)")
+	flags.StringVar(&allowlistPath, "allowlist", "", "file listing reviewed output tags that are not reported")
+	flags.BoolVar(&writeAllowlist, "write-allowlist", false, "write all findings to the -allowlist file instead of reporting them")
+	flags.StringVar(&format, "format", "text", "output format: text or json")
+	flags.StringVar(&output.sarif, "sarif", "", "write a SARIF 2.1.0 report of the findings")
+	flags.StringVar(&output.junit, "junit", "", "write a JUnit XML report of the findings")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 0 || (format != "text" && format != "json") || (writeAllowlist && allowlistPath == "") {
+		fmt.Fprintln(os.Stderr, "usage: qtcwrap audit [-allowlist file [-write-allowlist]] [-format=text|json] [flags]")
+		return 2
+	}
+
+	report, err := qtcwrap.Audit(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if writeAllowlist {
+		return writeAuditAllowlist(report, allowlistPath)
+	}
+	if allowlistPath != "" {
+		allowlist, err := qtcwrap.LoadAllowlist(allowlistPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		report = report.Filter(allowlist)
+	}
+
+	if format == "json" {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		for _, diagnostic := range report.Diagnostics() {
+			fmt.Printf("%s: %s\n", diagnostic.Severity, diagnostic)
+		}
+	}
+
+	err = report.Check()
+	result := &qtcwrap.Result{Diagnostics: report.Diagnostics()}
+	if reportErr := writeReports(qtcwrap.Report{Result: result, Err: err}, output); reportErr != nil {
+		fmt.Fprintln(os.Stderr, reportErr)
+		return 1
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// writeAuditAllowlist records all audit findings as reviewed.
+func writeAuditAllowlist(report *qtcwrap.AuditReport, path string) int {
+	f, err := os.Create(path) // #nosec G304 -- the allowlist path is chosen by the user running the command
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot create allowlist: %v\n", err)
+		return 1
+	}
+	if err := report.WriteAllowlist(f, filepath.Dir(path)); err != nil {
+		_ = f.Close()
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write allowlist %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "recorded %d finding(s) in %s\n", len(report.Findings), path)
+	return 0
+}
+
+// runExtract writes the translatable strings of templates as a catalog.
+func runExtract(args []string) int {
+	var config qtcwrap.Config
+	var output outputFlags
+	var funcs, format, out string
+	var check bool
+	flags := flag.NewFlagSet("qtcwrap extract", flag.ContinueOnError)
+	flags.StringVar(&config.Dir, "dir", ".", "directory with template files to extract strings from")
+	flags.StringVar(&config.Ext, "ext", "", "comma-separated extensions of template files (default .qtpl)")
+	flags.StringVar(&funcs, "func", qtcwrap.DefaultTranslationFunc, "comma-separated translation funcs, such as T or i18n.T")
+	flags.StringVar(&format, "format", "pot", "catalog format: pot or json")
+	flags.StringVar(&out, "o", "", "file receiving the catalog (default stdout)")
+	flags.BoolVar(&check, "check", false, "exit with a non-zero status if any text is not wrapped for translation")
+	flags.StringVar(&output.sarif, "sarif", "", "write a SARIF 2.1.0 report of text not wrapped for translation")
+	flags.StringVar(&output.junit, "junit", "", "write a JUnit XML report of text not wrapped for translation")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 0 || (format != "pot" && format != "json") {
+		fmt.Fprintln(os.Stderr, "usage: qtcwrap extract [-func=T] [-format=pot|json] [-o file] [flags]")
+		return 2
+	}
+
+	catalog, err := qtcwrap.ExtractMessages(config, strings.Split(funcs, ",")...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	write := catalog.WritePOT
+	if format == "json" {
+		write = catalog.WriteJSON
+	}
+	if out == "" {
+		err = write(os.Stdout)
+	} else {
+		err = writeFile(out, write)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	diagnostics := catalog.Diagnostics()
+	for _, diagnostic := range diagnostics {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", diagnostic.Severity, diagnostic)
+	}
+	if err := writeReports(qtcwrap.Report{Result: &qtcwrap.Result{Diagnostics: diagnostics}}, output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if check && len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runCover reports the template coverage recorded in profiles.
+func runCover(args []string) int {
+	var htmlOut, profileOut, root string
+	flags := flag.NewFlagSet("qtcwrap cover", flag.ContinueOnError)
+	flags.StringVar(&htmlOut, "html", "", "write an HTML report of the template sources to this file")
+	flags.StringVar(&profileOut, "o", "", "write the merged coverage profile to this file")
+	flags.StringVar(&root, "root", ".", "directory inside the module the templates belong to")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: qtcwrap cover [-html file] [-o file] [-root dir] profile-or-dir...")
+		return 2
+	}
+
+	report, err := qtcwrap.ReadCoverage(flags.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := report.WriteSummary(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if htmlOut != "" {
+		if err := writeFile(htmlOut, func(w io.Writer) error { return report.WriteHTML(w, root) }); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if profileOut != "" {
+		if err := writeFile(profileOut, report.WriteProfile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path) // #nosec G304 -- the output path is chosen by the user running the command
+	if err != nil {
+		return fmt.Errorf("cannot create %s: %w", path, err)
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	return nil
+}
+
+// printUsage prints the command usage and flags to stderr.
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: qtcwrap [flags]")
+	fmt.Fprintln(os.Stderr, "       qtcwrap generate [root]")
+	fmt.Fprintln(os.Stderr, "       qtcwrap preview [flags]")
+	fmt.Fprintln(os.Stderr, "       qtcwrap stats [flags]")
+	fmt.Fprintln(os.Stderr, "       qtcwrap audit [flags]")
+	fmt.Fprintln(os.Stderr, "       qtcwrap extract [flags]")
+	fmt.Fprintln(os.Stderr, "       qtcwrap cover [flags] profile...")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "  -json")
+	fmt.Fprintln(os.Stderr, "    \twrite compilation events to stdout as JSON lines")
+	fmt.Fprintln(os.Stderr, "  -junit file")
+	fmt.Fprintln(os.Stderr, "    \twrite a JUnit XML report of compiled templates and diagnostics")
+	fmt.Fprintln(os.Stderr, "  -sarif file")
+	fmt.Fprintln(os.Stderr, "    \twrite a SARIF 2.1.0 report of diagnostics")
+	qtcwrap.PrintFlags(os.Stderr)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Flags are overridden by QTCWRAP_* environment variables, such as QTCWRAP_DIR.")
+}
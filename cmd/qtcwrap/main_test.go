@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCutOutputFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		rest     []string
+		output   outputFlags
+		hasError bool
+	}{
+		{"None", []string{"-dir=templates"}, []string{"-dir=templates"}, outputFlags{}, false},
+		{"JSON", []string{"-json", "-dir=templates"}, []string{"-dir=templates"}, outputFlags{json: true}, false},
+		{"JSONFalse", []string{"--json=false"}, []string{}, outputFlags{}, false},
+		{"SARIFValue", []string{"-sarif=qtc.sarif", "-dir=templates"}, []string{"-dir=templates"}, outputFlags{sarif: "qtc.sarif"}, false},
+		{"SARIFSeparateValue", []string{"-sarif", "qtc.sarif", "-dir=templates"}, []string{"-dir=templates"}, outputFlags{sarif: "qtc.sarif"}, false},
+		{"JUnitSeparateValue", []string{"-junit", "qtc.xml"}, []string{}, outputFlags{junit: "qtc.xml"}, false},
+		{"AfterTerminator", []string{"--", "-json"}, []string{"--", "-json"}, outputFlags{}, false},
+		{"MissingValue", []string{"-dir=templates", "-sarif"}, nil, outputFlags{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, output, err := cutOutputFlags(tt.args)
+			if tt.hasError {
+				if err == nil {
+					t.Fatalf("Expected an error for %v", tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cutOutputFlags failed: %v", err)
+			}
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("Expected arguments %v, got %v", tt.rest, rest)
+			}
+			if output != tt.output {
+				t.Errorf("Expected output flags %+v, got %+v", tt.output, output)
+			}
+		})
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"UnknownSubcommand", []string{"bogus"}, 2},
+		{"UnknownFlag", []string{"-nosuchflag"}, 2},
+		{"MissingReportPath", []string{"-sarif"}, 2},
+		{"Help", []string{"-h"}, 0},
+		{"SubcommandUnknownFlag", []string{"stats", "-nosuchflag"}, 2},
+		{"GenerateTooManyArgs", []string{"generate", "a", "b"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := run(tt.args); code != tt.expected {
+				t.Errorf("Expected exit code %d for %v, got %d", tt.expected, tt.args, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package qtcwrap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Compiler compiles templates with a fixed configuration.
+//
+// A Compiler is built with New and functional options, or with NewCompiler
+// from a Config. It is safe for concurrent use and can be reused for any
+// number of compilations. Compilations writing to overlapping directories,
+// such as the same template directory, or a directory and one of its
+// subdirectories, are serialized: within the process by locks shared by
+// all compilers, and across processes, such as parallel go generate runs,
+// by advisory file locks in the per-user qtcwrap-locks directory of
+// os.UserCacheDir. Compilations of disjoint directories run in parallel.
+// The package-level Compile takes the same locks.
+//
+// Example:
+//
+//	compiler := New(WithDir("templates"))
+//	var wg sync.WaitGroup
+//	for i := 0; i < 2; i++ {
+//	    wg.Add(1)
+//	    go func() {
+//	        defer wg.Done()
+//	        // The second compilation waits for the first one
+//	        if _, err := compiler.Compile(ctx); err != nil {
+//	            fmt.Printf("Compilation failed: %v\n", err)
+//	        }
+//	    }()
+//	}
+//	wg.Wait()
+type Compiler struct {
+	config  Config
+	files   []string
+	runner  Runner
+	logger  Logger
+	timeout time.Duration
+
+	// overrides lists the environment variables applied to config.
+	overrides []EnvOverride
+
+	// err reports an invalid environment override. It is returned by
+	// every operation.
+	err error
+}
+
+// Option configures a Compiler built by New.
+type Option func(*Compiler)
+
+// New returns a Compiler configured by opts.
+//
+// Without options, the Compiler uses the defaults of GetDefaultConfig: it
+// compiles all templates in the current directory with the qtc binary and
+// skips line comments. Options are applied in order, so later options
+// override earlier ones. QTCWRAP_* environment variables override the
+// options, see EnvPrefix; an invalid value is reported by every operation
+// of the Compiler.
+//
+// Example:
+//
+//	compiler := New(
+//	    WithDir("templates"),
+//	    WithExt(".qtpl", ".qtxt"),
+//	    WithLogger(log.Default()),
+//	    WithTimeout(time.Minute),
+//	)
+//	result, err := compiler.Compile(context.Background())
+func New(opts ...Option) *Compiler {
+	c := &Compiler{config: defaultConfig()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.config, c.overrides, c.err = applyEnv(c.config, true)
+	return c
+}
+
+// defaultConfig returns the configuration of a Compiler without options.
+func defaultConfig() Config {
+	return Config{Dir: ".", SkipLineComments: true}
+}
+
+// NewCompiler returns a Compiler compiling the templates selected by
+// config. It is equivalent to New(FromConfig(config)).
+func NewCompiler(config Config) *Compiler {
+	return New(FromConfig(config))
+}
+
+// FromConfig replaces the whole configuration of the Compiler with config.
+// Options given after FromConfig adjust the replaced configuration.
+func FromConfig(config Config) Option {
+	return func(c *Compiler) {
+		c.config = config
+	}
+}
+
+// WithDir sets the directory that is searched for templates, recursively.
+func WithDir(dir string) Option {
+	return func(c *Compiler) {
+		c.config.Dir = dir
+	}
+}
+
+// WithFiles restricts the Compiler to the given template files.
+//
+// Every file is compiled on its own, as in single file mode, and the
+// results are merged in the given order. Dir and Ext are ignored.
+func WithFiles(files ...string) Option {
+	return func(c *Compiler) {
+		c.files = append([]string(nil), files...)
+	}
+}
+
+// WithExt sets the extensions of the templates searched for in the
+// directory, such as WithExt(".qtpl", ".qtxt"). Without it, qtc's default
+// extension "qtpl" is used.
+func WithExt(exts ...string) Option {
+	return func(c *Compiler) {
+		c.config.Ext = strings.Join(exts, extSeparator)
+	}
+}
+
+// WithSkipLineComments sets whether //line comments are left out of the
+// generated code.
+func WithSkipLineComments(skip bool) Option {
+	return func(c *Compiler) {
+		c.config.SkipLineComments = skip
+	}
+}
+
+// WithRunner makes the exec backend run qtc through runner instead of
+// starting the configured qtc binary.
+func WithRunner(runner Runner) Option {
+	return func(c *Compiler) {
+		c.runner = runner
+	}
+}
+
+// WithLogger makes the Compiler log suppressed warnings, retries and
+// removed files to logger. Without it, nothing is logged.
+func WithLogger(logger Logger) Option {
+	return func(c *Compiler) {
+		c.logger = logger
+	}
+}
+
+// WithTimeout limits every Compile, Check and Clean call, and every
+// compilation started by Watch, to timeout. A timeout that is not positive
+// disables the limit.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Compiler) {
+		c.timeout = timeout
+	}
+}
+
+// Config returns the configuration of the compiler, with the environment
+// applied. Files selected with WithFiles are not part of it.
+func (c *Compiler) Config() Config {
+	return c.config
+}
+
+// Compile compiles the templates like the package-level Compile. While a
+// compilation of an overlapping directory is in progress, it waits until
+// that compilation finishes or ctx is done.
+//
+// With WithFiles, every file is compiled even if an earlier one fails; the
+// failures are joined into the returned error. With PostBuildCheck, the
+// affected packages are type-checked once all files are generated.
+func (c *Compiler) Compile(ctx context.Context) (*Result, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+
+	var result *Result
+	var err error
+	if len(c.files) == 0 {
+		result, err = compileContext(ctx, c.config)
+	} else {
+		result, err = compileEach(ctx, c.configs())
+	}
+	if result != nil {
+		result.EnvOverrides = c.overrides
+	}
+	c.logResult(result)
+	return result, err
+}
+
+// Check parses the templates without generating any files and reports the
+// template errors found in Result.Diagnostics.
+//
+// Templates are parsed in-process with the parser of the embedded backend,
+// whichever backend is configured. A *CheckError listing the diagnostics
+// is returned if any template is invalid.
+//
+// Example:
+//
+//	if _, err := New(WithDir("templates")).Check(ctx); err != nil {
+//	    fmt.Println(err)
+//	}
+func (c *Compiler) Check(ctx context.Context) (*Result, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+
+	result := &Result{EnvOverrides: c.overrides}
+	for _, config := range c.configs() {
+		if err := ValidateConfig(config); err != nil {
+			return result, err
+		}
+		templates, err := configTemplates(config)
+		if err != nil {
+			return result, err
+		}
+
+		for _, template := range templates {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			result.Templates = append(result.Templates, template)
+			if _, err := generateCode(template, config.SkipLineComments); err != nil {
+				diagnostics := compileDiagnostics(err)
+				if len(diagnostics) == 0 {
+					return result, err
+				}
+				result.Diagnostics = append(result.Diagnostics, diagnostics...)
+			}
+		}
+	}
+
+	if len(result.Diagnostics) > 0 {
+		return result, &CheckError{Diagnostics: result.Diagnostics}
+	}
+	return result, nil
+}
+
+// Watch compiles the templates and recompiles them whenever a template is
+// added, removed or modified, until ctx is done. It behaves like the
+// package-level Watch.
+func (c *Compiler) Watch(ctx context.Context, interval time.Duration, onCompile func(*Result, error)) error {
+	if c.err != nil {
+		return c.err
+	}
+	return watch(ctx, interval, c.templates, func() (*Result, error) {
+		return c.Compile(ctx)
+	}, onCompile)
+}
+
+// Clean removes the files generated for the templates: the generated Go
+// files, their source maps and temporary files left behind by qtc. It
+// returns the removed files. Templates and the build cache are left
+// untouched.
+//
+// Clean takes the same locks as Compile, so it does not interfere with a
+// running compilation.
+//
+// Example:
+//
+//	removed, err := New(WithDir("templates")).Clean(ctx)
+//	if err != nil {
+//	    fmt.Printf("Cleaning failed: %v\n", err)
+//	}
+//	fmt.Printf("Removed %d files\n", len(removed))
+func (c *Compiler) Clean(ctx context.Context) ([]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+
+	var removed []string
+	for _, config := range c.configs() {
+		files, err := cleanConfig(ctx, config)
+		removed = append(removed, files...)
+		if err != nil {
+			return removed, err
+		}
+	}
+	for _, file := range removed {
+		c.logf("removed %s", file)
+	}
+	return removed, nil
+}
+
+// cleanConfig removes the files generated for the templates selected by
+// config while holding the compilation locks.
+func cleanConfig(ctx context.Context, config Config) ([]string, error) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockDirs(ctx, compileDirs(config))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var removed []string
+	for _, template := range templates {
+		generated := generatedPath(config, template)
+		for _, file := range []string{generated, generated + sourceMapExt, template + ".go.tmp"} {
+			err := os.Remove(file)
+			switch {
+			case err == nil:
+				removed = append(removed, file)
+			case !os.IsNotExist(err):
+				return removed, fmt.Errorf("cannot remove %s: %w", file, err)
+			}
+		}
+	}
+	return removed, nil
+}
+
+// configs returns the configurations compiled by the Compiler: its own
+// configuration, or one single file configuration per file given to
+// WithFiles.
+func (c *Compiler) configs() []Config {
+	if len(c.files) == 0 {
+		return []Config{c.config}
+	}
+
+	configs := make([]Config, 0, len(c.files))
+	for _, file := range c.files {
+		config := c.config
+		config.File = file
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// templates lists the templates selected by the Compiler.
+func (c *Compiler) templates() ([]string, error) {
+	var templates []string
+	for _, config := range c.configs() {
+		selected, err := configTemplates(config)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, selected...)
+	}
+	return templates, nil
+}
+
+// context derives the context of a single operation from ctx, applying the
+// timeout and runner of the Compiler.
+func (c *Compiler) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.runner != nil {
+		ctx = withRunner(ctx, c.runner)
+	}
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// logResult logs the environment overrides, suppressed warnings and
+// retries of a compilation.
+func (c *Compiler) logResult(result *Result) {
+	if result == nil {
+		return
+	}
+	for _, override := range result.EnvOverrides {
+		c.logf("[qtcwrap env] %s = %q (set by %s)", override.Field, override.Value, override.Var)
+	}
+	for _, warning := range result.Warnings {
+		c.logf("[qtc warning suppressed] %s", warning)
+	}
+	for _, attempt := range result.Attempts {
+		if attempt.Backoff > 0 {
+			c.logf("[qtc retry] attempt %d failed, retrying in %s: %v", attempt.Number, attempt.Backoff, attempt.Err)
+		}
+	}
+}
+
+// logf logs a message if the Compiler has a Logger.
+func (c *Compiler) logf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
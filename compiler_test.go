@@ -0,0 +1,284 @@
+package qtcwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompilerConfig(t *testing.T) {
+	config := Config{Dir: templatesDir, SkipLineComments: true}
+	if got := NewCompiler(config).Config(); got != config {
+		t.Errorf("Expected %+v, got %+v", config, got)
+	}
+}
+
+func TestCompilerConcurrentCompile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	for _, name := range []string{"a.qtpl", "nested/b.qtpl", "other/c.qtpl"} {
+		writeTestTemplate(t, dir, name, helloTemplate)
+	}
+
+	// Overlapping compilations of the tree and a nested directory, and a
+	// disjoint one
+	compilers := []*Compiler{
+		NewCompiler(Config{Dir: dir, Backend: EmbeddedBackend}),
+		NewCompiler(Config{Dir: filepath.Join(dir, "nested"), Backend: EmbeddedBackend}),
+		NewCompiler(Config{Dir: filepath.Join(dir, "other"), Backend: EmbeddedBackend, Atomic: true}),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*len(compilers))
+	for i := 0; i < 4; i++ {
+		for _, compiler := range compilers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := compiler.Compile(context.Background())
+				errs <- err
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Concurrent compilation failed: %v", err)
+		}
+	}
+
+	for _, name := range []string{"a.qtpl.go", "nested/b.qtpl.go", "other/c.qtpl.go"} {
+		code, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		if strings.Count(string(code), "func StreamHello(") != 1 {
+			t.Errorf("Expected intact generated code in %s, got %s", name, code)
+		}
+	}
+}
+
+func TestCompilerCompileCanceled(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	unlock, err := lockDirs(context.Background(), []string{dir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTestTimeout)
+	defer cancel()
+	if _, err := NewCompiler(Config{Dir: dir, Backend: EmbeddedBackend}).Compile(ctx); err == nil {
+		t.Fatal("Expected compilation to wait for the lock until canceled")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.qtpl.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be compiled, got %v", err)
+	}
+}
+
+// logRecorder is a Logger recording the logged messages.
+type logRecorder struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *logRecorder) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected Config
+	}{
+		{"Defaults", nil, GetDefaultConfig()},
+		{
+			name:     "Options",
+			opts:     []Option{WithDir(templatesDir), WithExt(qtplExt), WithSkipLineComments(false)},
+			expected: Config{Dir: templatesDir, Ext: qtplExt},
+		},
+		{
+			name:     "FromConfigThenOptions",
+			opts:     []Option{FromConfig(Config{Dir: templatesDir, Atomic: true}), WithSkipLineComments(true)},
+			expected: Config{Dir: templatesDir, Atomic: true, SkipLineComments: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.opts...).Config(); got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompilerWithRunner(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	template := writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	var calls [][]string
+	runner := RunnerFunc(func(ctx context.Context, args []string) error {
+		calls = append(calls, args)
+		return nil
+	})
+
+	result, err := New(WithDir(dir), WithRunner(runner)).Compile(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(calls) != 1 || strings.Join(calls[0], " ") != "-dir="+dir+" "+skipCommentsArg {
+		t.Errorf("Expected the runner to be called with the qtc arguments, got %v", calls)
+	}
+	if len(result.Generated) != 1 || result.Generated[0] != template+goExt {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestCompilerWithLogger(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	runner := RunnerFunc(func(ctx context.Context, args []string) error {
+		return &QtcError{Args: args, Stderr: temporaryStderr, Err: errors.New("exit status 1")}
+	})
+	logger := &logRecorder{}
+
+	if _, err := New(WithDir(dir), WithRunner(runner), WithLogger(logger)).Compile(context.Background()); err != nil {
+		t.Fatalf("Expected the temporary file warning to be suppressed, got %v", err)
+	}
+	if len(logger.messages) != 1 || !strings.HasPrefix(logger.messages[0], "[qtc warning suppressed]") {
+		t.Errorf("Expected the suppressed warning to be logged, got %q", logger.messages)
+	}
+}
+
+func TestCompilerWithTimeout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	runner := RunnerFunc(func(ctx context.Context, args []string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	_, err := New(WithDir(dir), WithRunner(runner), WithTimeout(lockTestTimeout)).Compile(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the compilation to time out, got %v", err)
+	}
+}
+
+func TestCompilerWithFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	a := writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+	broken := writeTestTemplate(t, dir, "broken.qtpl", brokenTemplate)
+	c := writeTestTemplate(t, dir, "nested/c.qtpl", helloTemplate)
+	writeTestTemplate(t, dir, "skipped.qtpl", helloTemplate)
+
+	compiler := New(FromConfig(Config{Backend: EmbeddedBackend}), WithFiles(a, broken, c))
+	result, err := compiler.Compile(context.Background())
+	if err == nil {
+		t.Fatal("Expected error for broken template")
+	}
+	if strings.Join(result.Templates, "|") != strings.Join([]string{a, broken, c}, "|") {
+		t.Errorf("Expected every file to be compiled, got %v", result.Templates)
+	}
+	if strings.Join(result.Generated, "|") != strings.Join([]string{a + goExt, c + goExt}, "|") {
+		t.Errorf("Expected the valid files to be generated despite the failure, got %v", result.Generated)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "skipped.qtpl.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected unlisted templates not to be compiled, got %v", err)
+	}
+}
+
+func TestCompilerWithFilesPostBuildCheck(t *testing.T) {
+	root := createTestModule(t)
+	a := writeTestTemplate(t, root, "views/a.qtpl", callerTemplate)
+	b := writeTestTemplate(t, root, "views/b.qtpl", calleeTemplate)
+
+	compiler := New(FromConfig(Config{SkipLineComments: true, Backend: EmbeddedBackend, PostBuildCheck: true}), WithFiles(a, b))
+	result, err := compiler.Compile(context.Background())
+	if err != nil {
+		t.Fatalf("Expected files calling each other to type-check, got: %v", err)
+	}
+	if len(result.Generated) != 2 || len(result.Diagnostics) != 0 {
+		t.Errorf("Expected both files generated without diagnostics, got %v and %v", result.Generated, result.Diagnostics)
+	}
+}
+
+func TestCompilerCheck(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	compiler := New(WithDir(dir))
+	result, err := compiler.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Templates) != 1 || len(result.Generated) != 0 {
+		t.Errorf("Expected one template to be checked without generating code, got %+v", result)
+	}
+
+	broken := writeTestTemplate(t, dir, "broken.qtpl", emptyIfTemplate)
+	result, err = compiler.Check(context.Background())
+	var checkErr *CheckError
+	if !errors.As(err, &checkErr) {
+		t.Fatalf("Expected *CheckError, got %v", err)
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].File != broken || result.Diagnostics[0].Line != 3 {
+		t.Errorf("Unexpected diagnostics: %+v", result.Diagnostics)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), goExt) {
+			t.Errorf("Expected Check not to write files, found %s", entry.Name())
+		}
+	}
+}
+
+func TestCompilerClean(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	template := writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+	writeTestTemplate(t, dir, "handwritten.go", "package templates\n")
+
+	logger := &logRecorder{}
+	compiler := New(FromConfig(Config{Dir: dir, Backend: EmbeddedBackend, SourceMaps: true}), WithLogger(logger))
+	if _, err := compiler.Compile(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	removed, err := compiler.Clean(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{template + goExt, template + goExt + sourceMapExt}
+	if strings.Join(removed, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v to be removed, got %v", expected, removed)
+	}
+	if len(logger.messages) != len(expected) {
+		t.Errorf("Expected every removed file to be logged, got %q", logger.messages)
+	}
+	for _, file := range []string{template, filepath.Join(dir, "handwritten.go")} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", file, err)
+		}
+	}
+
+	if removed, err := compiler.Clean(context.Background()); err != nil || len(removed) != 0 {
+		t.Errorf("Expected nothing left to clean, got %v, %v", removed, err)
+	}
+}
@@ -0,0 +1,350 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CoverPackage is the import path of the runtime package counting the
+// template blocks executed by code compiled with Config.Coverage.
+const CoverPackage = "github.com/valksor/go-qtcwrap/qtcwrapcover"
+
+// coverImportName is the name instrumented code imports CoverPackage as.
+const coverImportName = "qtcwrapcover"
+
+// coverBlock is a run of consecutive template lines counted together.
+type coverBlock struct {
+	startLine, endLine int
+}
+
+// coverInsert is code inserted into a generated file.
+type coverInsert struct {
+	// offset is the byte offset the code is inserted at.
+	offset int
+
+	// text is the inserted code.
+	text string
+}
+
+// coverInstrumenter injects coverage counters into a generated file.
+type coverInstrumenter struct {
+	fset *token.FileSet
+
+	// counters is the name of the counters variable.
+	counters string
+
+	// lines holds the template line of each generated line.
+	lines []int
+
+	// blocks lists the counted blocks in counter order.
+	blocks []coverBlock
+
+	// inserts lists the counter calls to insert.
+	inserts []coverInsert
+}
+
+// instrumentCoverage injects coverage counters into every file generated
+// for result.
+func instrumentCoverage(result *Result, skipLineComments bool) error {
+	for i, template := range result.Templates {
+		if i >= len(result.Generated) {
+			break
+		}
+		if err := instrumentFile(template, result.Generated[i], skipLineComments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instrumentFile injects coverage counters into the file generated for a
+// template with the given skipLineComments setting.
+func instrumentFile(template, generated string, skipLineComments bool) error {
+	code, err := os.ReadFile(generated) // #nosec G304 -- generated files are derived from the caller's configuration
+	if err != nil {
+		return fmt.Errorf("cannot read generated file %s: %w", generated, err)
+	}
+
+	var lines []int
+	if skipLineComments {
+		sourceMap, err := BuildSourceMap(template, generated, true)
+		if err != nil {
+			return err
+		}
+		lines = sourceMap.Lines
+	} else if lines, err = mapGeneratedLines(code, false); err != nil {
+		return fmt.Errorf("cannot map generated code for %s: %w", template, err)
+	}
+
+	name, err := coverTemplateName(template)
+	if err != nil {
+		return err
+	}
+	instrumented, err := instrumentCode(name, generated, code, lines)
+	if err != nil {
+		return err
+	}
+	// #nosec G306 -- generated Go sources are meant to be readable like any other source file
+	if err := os.WriteFile(generated, instrumented, generatedFilePerm); err != nil {
+		return fmt.Errorf("cannot write generated file %s: %w", generated, err)
+	}
+	return nil
+}
+
+// coverTemplateName returns the name a template is registered with: its
+// import path, such as "example.com/app/templates/home.qtpl", inside a
+// module, and its absolute slash-separated path otherwise.
+func coverTemplateName(template string) (string, error) {
+	abs, err := filepath.Abs(template)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve template path %s: %w", template, err)
+	}
+
+	modFile, err := findGoMod(filepath.Dir(abs))
+	if err != nil {
+		return filepath.ToSlash(abs), nil
+	}
+	module, err := readModule(filepath.Dir(modFile))
+	if err != nil {
+		return "", err
+	}
+	importPath, err := packageImportPath(module, filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	return importPath + "/" + filepath.Base(abs), nil
+}
+
+// instrumentCode returns generated code with a counter call at the start of
+// every block of its Stream funcs: func bodies, if and else branches, loop
+// bodies and switch cases. lines holds the template line of each generated
+// line.
+//
+// Counters are inserted without adding or removing lines, so line comments
+// and source maps of the generated file stay valid. The import of
+// CoverPackage is added to the package clause line, and the registration
+// of the template blocks is appended to the file.
+func instrumentCode(template, generated string, code []byte, lines []int) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, generated, code, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse generated file %s: %w", generated, err)
+	}
+	count := bytes.Count(code, []byte("\n"))
+	if len(code) > 0 && code[len(code)-1] != '\n' {
+		count++
+	}
+	if count != len(lines) {
+		return nil, fmt.Errorf("cannot map generated file %s: it has %d lines, its template compiles to %d", generated, count, len(lines))
+	}
+
+	c := &coverInstrumenter{fset: fset, counters: coverCountersName(generated), lines: lines}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil && isStreamFunc(fn) {
+			c.block(fn.Body.List, fn.Body.Lbrace, fn.Pos())
+		}
+	}
+	if len(c.blocks) == 0 {
+		return code, nil
+	}
+
+	inserts := append(c.inserts, coverInsert{
+		offset: fset.PositionFor(file.Name.End(), false).Offset,
+		text:   "; import " + coverImportName + " " + strconv.Quote(CoverPackage),
+	})
+	sort.Slice(inserts, func(i, j int) bool { return inserts[i].offset > inserts[j].offset })
+
+	out := append([]byte(nil), code...)
+	for _, insert := range inserts {
+		out = append(out[:insert.offset], append([]byte(insert.text), out[insert.offset:]...)...)
+	}
+
+	var b strings.Builder
+	b.WriteString("\nvar " + c.counters + " = " + coverImportName + ".Register(" + strconv.Quote(template) + ", []" + coverImportName + ".Block{")
+	for i, block := range c.blocks {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "{StartLine: %d, EndLine: %d}", block.startLine, block.endLine)
+	}
+	b.WriteString("})\n")
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	return append(out, b.String()...), nil
+}
+
+// isStreamFunc reports whether fn is the Stream func of a template func,
+// whose first parameter is the *quicktemplate.Writer qtc names qw422016.
+func isStreamFunc(fn *ast.FuncDecl) bool {
+	if fn.Type.Params == nil || len(fn.Type.Params.List) == 0 {
+		return false
+	}
+	param := fn.Type.Params.List[0]
+	if len(param.Names) == 0 || !strings.HasPrefix(param.Names[0].Name, "qw") {
+		return false
+	}
+	star, ok := param.Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Writer"
+}
+
+// coverCountersName returns the name of the counters variable of a
+// generated file, such as "qtcwrapCover_home_qtpl" for "home.qtpl.go".
+func coverCountersName(generated string) string {
+	base := strings.TrimSuffix(filepath.Base(generated), ".go")
+	return "qtcwrapCover_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, base)
+}
+
+// block counts the template lines of stmts, which start after the byte at
+// pos, and of the headers at extra positions, and inserts a counter call
+// after pos. Nested blocks get counters of their own; compound statements
+// contribute their header line to the enclosing block.
+func (c *coverInstrumenter) block(stmts []ast.Stmt, pos token.Pos, extra ...token.Pos) {
+	templateLines := make(map[int]bool)
+	for _, p := range extra {
+		c.addLine(templateLines, p)
+	}
+
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.IfStmt:
+			c.addLine(templateLines, s.Pos())
+			c.ifStmt(s)
+		case *ast.ForStmt:
+			c.addLine(templateLines, s.Pos())
+			c.block(s.Body.List, s.Body.Lbrace)
+		case *ast.RangeStmt:
+			c.addLine(templateLines, s.Pos())
+			c.block(s.Body.List, s.Body.Lbrace)
+		case *ast.SwitchStmt:
+			c.addLine(templateLines, s.Pos())
+			c.clauses(s.Body)
+		case *ast.TypeSwitchStmt:
+			c.addLine(templateLines, s.Pos())
+			c.clauses(s.Body)
+		case *ast.SelectStmt:
+			c.addLine(templateLines, s.Pos())
+			c.clauses(s.Body)
+		case *ast.BlockStmt:
+			c.block(s.List, s.Lbrace)
+		default:
+			c.addStmt(templateLines, stmt)
+		}
+	}
+
+	if len(templateLines) == 0 {
+		return
+	}
+	sorted := make([]int, 0, len(templateLines))
+	for line := range templateLines {
+		sorted = append(sorted, line)
+	}
+	sort.Ints(sorted)
+
+	first := len(c.blocks)
+	for _, line := range sorted {
+		if last := len(c.blocks) - 1; last >= first && c.blocks[last].endLine == line-1 {
+			c.blocks[last].endLine = line
+		} else {
+			c.blocks = append(c.blocks, coverBlock{startLine: line, endLine: line})
+		}
+	}
+	c.inserts = append(c.inserts, coverInsert{
+		offset: c.fset.PositionFor(pos, false).Offset + 1,
+		text:   fmt.Sprintf("%s.Hit(%d, %d);", c.counters, first, len(c.blocks)-1),
+	})
+}
+
+// ifStmt instruments the branches of an if statement. The conditions of
+// else-if branches are not counted.
+func (c *coverInstrumenter) ifStmt(s *ast.IfStmt) {
+	c.block(s.Body.List, s.Body.Lbrace)
+	switch e := s.Else.(type) {
+	case *ast.BlockStmt:
+		c.block(e.List, e.Lbrace)
+	case *ast.IfStmt:
+		c.ifStmt(e)
+	}
+}
+
+// clauses instruments the cases of a switch or select statement.
+func (c *coverInstrumenter) clauses(body *ast.BlockStmt) {
+	for _, stmt := range body.List {
+		switch clause := stmt.(type) {
+		case *ast.CaseClause:
+			c.block(clause.Body, clause.Colon, clause.Pos())
+		case *ast.CommClause:
+			c.block(clause.Body, clause.Colon, clause.Pos())
+		}
+	}
+}
+
+// addStmt adds the template lines of a simple statement. Template text
+// only counts on the lines where it is not blank, so the indentation
+// before a tag does not attribute the tag's line to the preceding block.
+func (c *coverInstrumenter) addStmt(templateLines map[int]bool, stmt ast.Stmt) {
+	if text, ok := textWrite(stmt); ok {
+		line := c.fset.PositionFor(text.Pos(), false).Line
+		value := strings.TrimPrefix(text.Value, "`")
+		value = strings.TrimSuffix(value, "`")
+		for i, part := range strings.Split(value, "\n") {
+			if strings.TrimSpace(part) != "" {
+				c.addGeneratedLine(templateLines, line+i)
+			}
+		}
+		return
+	}
+
+	start, end := c.fset.PositionFor(stmt.Pos(), false).Line, c.fset.PositionFor(stmt.End(), false).Line
+	for line := start; line <= end; line++ {
+		c.addGeneratedLine(templateLines, line)
+	}
+}
+
+// textWrite returns the raw string literal written by a statement writing
+// template text, such as qw422016.N().S(`<p>`).
+func textWrite(stmt ast.Stmt) (*ast.BasicLit, bool) {
+	expr, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return nil, false
+	}
+	call, ok := expr.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return nil, false
+	}
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING || !strings.HasPrefix(lit.Value, "`") {
+		return nil, false
+	}
+	return lit, true
+}
+
+// addLine adds the template line of a position in generated code.
+func (c *coverInstrumenter) addLine(templateLines map[int]bool, pos token.Pos) {
+	c.addGeneratedLine(templateLines, c.fset.PositionFor(pos, false).Line)
+}
+
+// addGeneratedLine adds the template line of a generated line, if it has
+// one.
+func (c *coverInstrumenter) addGeneratedLine(templateLines map[int]bool, line int) {
+	if line >= 1 && line <= len(c.lines) && c.lines[line-1] != 0 {
+		templateLines[c.lines[line-1]] = true
+	}
+}
@@ -0,0 +1,222 @@
+package qtcwrap
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// controlCoverBlocks are the blocks registered for the corpus control
+// template.
+const controlCoverBlocks = `[]qtcwrapcover.Block{{StartLine: 7, EndLine: 7}, {StartLine: 9, EndLine: 9}, {StartLine: 13, EndLine: 13}, ` +
+	`{StartLine: 13, EndLine: 14}, {StartLine: 11, EndLine: 12}, {StartLine: 16, EndLine: 16}, {StartLine: 19, EndLine: 20}, ` +
+	`{StartLine: 21, EndLine: 22}, {StartLine: 23, EndLine: 24}, {StartLine: 5, EndLine: 6}, {StartLine: 18, EndLine: 18}}`
+
+func TestInstrumentCode(t *testing.T) {
+	code := []byte("package a\n\nfunc StreamA(qw422016 *qt422016.Writer, ok bool) {\n\tqw422016.N().S(`\n\t<p>`)\n\tif ok {\n\t\tqw422016.N().S(`yes`)\n\t} else {\n\t\tqw422016.N().S(`  \n`)\n\t}\n}\n\nfunc WriteA(qq422016 qtio422016.Writer, ok bool) {\n\tStreamA(nil, ok)\n}\n")
+	lines := []int{1, 1, 1, 1, 2, 2, 3, 4, 5, 6, 7, 7, 8, 8, 8, 8}
+
+	out, err := instrumentCode("example.com/a/a.qtpl", "a.qtpl.go", code, lines)
+	if err != nil {
+		t.Fatalf("instrumentCode failed: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "a.qtpl.go", out, 0); err != nil {
+		t.Fatalf("Instrumented code does not parse: %v\n%s", err, out)
+	}
+
+	got := strings.Split(string(out), "\n")
+	expected := map[int]string{
+		1:  `package a; import qtcwrapcover "github.com/valksor/go-qtcwrap/qtcwrapcover"`,
+		3:  "func StreamA(qw422016 *qt422016.Writer, ok bool) {qtcwrapCover_a_qtpl.Hit(1, 1);",
+		6:  "\tif ok {qtcwrapCover_a_qtpl.Hit(0, 0);",
+		8:  "\t} else {",
+		14: "func WriteA(qq422016 qtio422016.Writer, ok bool) {",
+		18: `var qtcwrapCover_a_qtpl = qtcwrapcover.Register("example.com/a/a.qtpl", []qtcwrapcover.Block{{StartLine: 3, EndLine: 3}, {StartLine: 1, EndLine: 2}})`,
+	}
+	for line, text := range expected {
+		if line > len(got) || got[line-1] != text {
+			t.Errorf("Expected line %d to be %q, got:\n%s", line, text, out)
+		}
+	}
+}
+
+func TestInstrumentCodeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		lines    []int
+		expected string
+	}{
+		{"Syntax", "package a\nfunc {\n", []int{1, 2}, "cannot parse generated file"},
+		{"LineCount", "package a\n", []int{1, 2, 3}, "its template compiles to 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := instrumentCode("a.qtpl", "a.qtpl.go", []byte(tt.code), tt.lines)
+			assertValidationError(t, err, tt.expected, true)
+		})
+	}
+}
+
+func TestInstrumentCodeWithoutFuncs(t *testing.T) {
+	code := []byte("package a\n\nvar x = 1\n")
+	out, err := instrumentCode("a.qtpl", "a.qtpl.go", code, []int{1, 1, 1})
+	if err != nil {
+		t.Fatalf("instrumentCode failed: %v", err)
+	}
+	if string(out) != string(code) {
+		t.Errorf("Expected code without template funcs to be unchanged, got:\n%s", out)
+	}
+}
+
+func TestCompileWithCoverage(t *testing.T) {
+	tests := []struct {
+		name             string
+		skipLineComments bool
+	}{
+		{"WithoutLineComments", true},
+		{"WithLineComments", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, goModFile), []byte("module example.com/app\n"), 0o600); err != nil {
+				t.Fatalf("Cannot write go.mod: %v", err)
+			}
+			src, err := os.ReadFile(filepath.Join(corpusDir, controlTemplate))
+			if err != nil {
+				t.Fatalf("Cannot read template: %v", err)
+			}
+			writeTestTemplate(t, dir, filepath.Join("views", controlTemplate), string(src))
+
+			config := Config{Dir: filepath.Join(dir, "views"), SkipLineComments: tt.skipLineComments, Backend: EmbeddedBackend}
+			if _, err := Compile(config); err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+			generated := filepath.Join(dir, "views", controlTemplate+goExt)
+			plain, err := os.ReadFile(generated)
+			if err != nil {
+				t.Fatalf(readGeneratedErr, err)
+			}
+
+			config.Coverage = true
+			config.SourceMaps = true
+			if _, err := Compile(config); err != nil {
+				t.Fatalf("Compile with coverage failed: %v", err)
+			}
+			instrumented, err := os.ReadFile(generated)
+			if err != nil {
+				t.Fatalf(readGeneratedErr, err)
+			}
+
+			register := `var qtcwrapCover_control_qtpl = qtcwrapcover.Register("example.com/app/views/control.qtpl", ` + controlCoverBlocks + ")"
+			if !strings.Contains(string(instrumented), register) {
+				t.Errorf("Expected generated code to register %s, got:\n%s", register, instrumented)
+			}
+			if got, want := strings.Count(string(instrumented), "\n"), strings.Count(string(plain), "\n")+2; got != want {
+				t.Errorf("Expected instrumentation to only append the registration, got %d lines instead of %d", got, want)
+			}
+			plainLines, instrumentedLines := strings.Split(string(plain), "\n"), strings.Split(string(instrumented), "\n")
+			for i, line := range plainLines {
+				if strings.Contains(line, itemsExpr) && !strings.Contains(instrumentedLines[i], itemsExpr) {
+					t.Errorf("Expected line %d with %s to keep its place, got %q", i+1, itemsExpr, instrumentedLines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCoverTemplateName(t *testing.T) {
+	dir := t.TempDir()
+	module := filepath.Join(dir, "app")
+	if err := os.MkdirAll(filepath.Join(module, "views"), 0o700); err != nil {
+		t.Fatalf("Cannot create module: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(module, goModFile), []byte("module example.com/app\n"), 0o600); err != nil {
+		t.Fatalf("Cannot write go.mod: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"ModuleRoot", filepath.Join(module, "home.qtpl"), "example.com/app/home.qtpl"},
+		{"Package", filepath.Join(module, "views", "page.qtpl"), "example.com/app/views/page.qtpl"},
+		{"OutsideModule", filepath.Join(dir, "page.qtpl"), filepath.ToSlash(filepath.Join(dir, "page.qtpl"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := coverTemplateName(tt.template)
+			if err != nil {
+				t.Fatalf("coverTemplateName failed: %v", err)
+			}
+			if name != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestCompileWithCoverageCached(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, goModFile), []byte("module example.com/app\n"), 0o600); err != nil {
+		t.Fatalf("Cannot write go.mod: %v", err)
+	}
+	template := writeTestTemplate(t, dir, filepath.Join("views", "home.qtpl"), "{% func Home(ok bool) %}\n{% if ok %}yes{% endif %}\n{% endfunc %}\n")
+	generated := template + goExt
+	config := Config{Dir: filepath.Join(dir, "views"), SkipLineComments: true, Backend: EmbeddedBackend, Coverage: true, CacheDir: filepath.Join(dir, cacheDirName)}
+
+	if _, err := Compile(config); err != nil {
+		t.Fatalf("Compile with coverage failed: %v", err)
+	}
+	instrumented, err := os.ReadFile(generated)
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+	if !strings.Contains(string(instrumented), "qtcwrapcover.Register(") {
+		t.Fatalf("Expected instrumented code, got:\n%s", instrumented)
+	}
+	if info, err := os.Stat(generated); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != generatedFilePerm) {
+		t.Errorf("Expected instrumented file with mode %o, got %v, %v", generatedFilePerm, info.Mode(), err)
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(generated, old, old); err != nil {
+		t.Fatalf("Cannot touch generated file: %v", err)
+	}
+	result, err := Compile(config)
+	if err != nil {
+		t.Fatalf("Cached compile with coverage failed: %v", err)
+	}
+	if len(result.Cached) != 1 {
+		t.Fatalf("Expected the instrumented file to be restored from the cache, got %v", result.Cached)
+	}
+	restored, err := os.ReadFile(generated)
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+	if string(restored) != string(instrumented) {
+		t.Errorf("Expected the cached file to be instrumented once, got:\n%s", restored)
+	}
+	if info, err := os.Stat(generated); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("Expected an up-to-date instrumented file not to be rewritten, got %v, %v", info.ModTime(), err)
+	}
+
+	config.Coverage = false
+	result, err = Compile(config)
+	if err != nil {
+		t.Fatalf("Compile without coverage failed: %v", err)
+	}
+	if len(result.Cached) != 0 {
+		t.Errorf("Expected plain and instrumented code to be cached apart, got %v", result.Cached)
+	}
+}
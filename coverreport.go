@@ -0,0 +1,312 @@
+package qtcwrap
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverProfileLine matches a block line of a coverage profile, such as
+// "example.com/app/home.qtpl:3.1,6.1 3 12".
+var coverProfileLine = regexp.MustCompile(`^(.+):(\d+)\.(\d+),(\d+)\.(\d+) (\d+) (\d+)$`)
+
+// CoverageBlock is a run of template lines with its execution count.
+type CoverageBlock struct {
+	// StartLine and EndLine are the first and last template line of the
+	// block, both inclusive.
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+
+	// Count is the number of executions of the block.
+	Count int64 `json:"count"`
+}
+
+// TemplateCoverage holds the coverage of one template.
+type TemplateCoverage struct {
+	// Template is the template name recorded by the instrumented code: its
+	// import path, such as "example.com/app/templates/home.qtpl", or its
+	// absolute path for templates outside a module.
+	Template string `json:"template"`
+
+	// Blocks lists the blocks of the template, ordered by line.
+	Blocks []CoverageBlock `json:"blocks"`
+}
+
+// LineCounts returns the execution count of every template line that is
+// part of a block. A line in several blocks, such as a line holding both
+// an if tag and its body, has the highest of their counts.
+func (t *TemplateCoverage) LineCounts() map[int]int64 {
+	counts := make(map[int]int64)
+	for _, block := range t.Blocks {
+		for line := block.StartLine; line <= block.EndLine; line++ {
+			if count, ok := counts[line]; !ok || block.Count > count {
+				counts[line] = block.Count
+			}
+		}
+	}
+	return counts
+}
+
+// Lines returns the number of executed template lines and of template
+// lines that are part of a block.
+func (t *TemplateCoverage) Lines() (covered, total int) {
+	for _, count := range t.LineCounts() {
+		total++
+		if count > 0 {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+// Percent returns the percentage of executed template lines.
+func (t *TemplateCoverage) Percent() float64 {
+	return coveragePercent(t.Lines())
+}
+
+// CoverageReport holds template coverage merged from the profiles written
+// by the qtcwrapcover package.
+type CoverageReport struct {
+	// Templates lists the covered templates, sorted by name.
+	Templates []TemplateCoverage `json:"templates"`
+}
+
+// ReadCoverage reads and merges coverage profiles written by the
+// qtcwrapcover package. Every path is either a profile file or a directory
+// whose files are all profiles, such as the QTCWRAP_COVERDIR directory of
+// a test run. The counts of blocks found in several profiles are added up.
+//
+// Example:
+//
+//	report, err := ReadCoverage("cover")
+//	if err != nil {
+//	    fmt.Printf("Cannot read template coverage: %v\n", err)
+//	    return
+//	}
+//	f, _ := os.Create("cover.html")
+//	defer f.Close()
+//	_ = report.WriteHTML(f, ".")
+func ReadCoverage(paths ...string) (*CoverageReport, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read coverage profile: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read coverage directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	counts := make(map[string]map[[2]int]int64)
+	for _, file := range files {
+		if err := readCoverProfile(file, counts); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &CoverageReport{}
+	for template, blocks := range counts {
+		coverage := TemplateCoverage{Template: template}
+		for lines, count := range blocks {
+			coverage.Blocks = append(coverage.Blocks, CoverageBlock{StartLine: lines[0], EndLine: lines[1], Count: count})
+		}
+		sort.Slice(coverage.Blocks, func(i, j int) bool {
+			a, b := coverage.Blocks[i], coverage.Blocks[j]
+			if a.StartLine != b.StartLine {
+				return a.StartLine < b.StartLine
+			}
+			return a.EndLine < b.EndLine
+		})
+		report.Templates = append(report.Templates, coverage)
+	}
+	sort.Slice(report.Templates, func(i, j int) bool {
+		return report.Templates[i].Template < report.Templates[j].Template
+	})
+	return report, nil
+}
+
+// readCoverProfile adds the block counts of a profile file to counts,
+// keyed by template and by first and last line.
+func readCoverProfile(path string, counts map[string]map[[2]int]int64) error {
+	f, err := os.Open(path) // #nosec G304 -- profile paths are chosen by the caller
+	if err != nil {
+		return fmt.Errorf("cannot read coverage profile: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || (line == 1 && strings.HasPrefix(text, "mode: ")) {
+			continue
+		}
+		match := coverProfileLine.FindStringSubmatch(text)
+		if match == nil {
+			return fmt.Errorf("%s:%d: invalid coverage profile line %q", path, line, text)
+		}
+
+		startLine, _ := strconv.Atoi(match[2])
+		endLine, _ := strconv.Atoi(match[4])
+		endColumn, _ := strconv.Atoi(match[5])
+		count, err := strconv.ParseInt(match[7], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid count: %w", path, line, err)
+		}
+		if endColumn == 1 && endLine > startLine {
+			endLine--
+		}
+
+		blocks := counts[match[1]]
+		if blocks == nil {
+			blocks = make(map[[2]int]int64)
+			counts[match[1]] = blocks
+		}
+		blocks[[2]int{startLine, endLine}] += count
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read coverage profile %s: %w", path, err)
+	}
+	return nil
+}
+
+// Percent returns the percentage of executed template lines across all
+// templates.
+func (r *CoverageReport) Percent() float64 {
+	var covered, total int
+	for i := range r.Templates {
+		c, t := r.Templates[i].Lines()
+		covered += c
+		total += t
+	}
+	return coveragePercent(covered, total)
+}
+
+// WriteProfile writes the merged coverage as a profile in the format
+// written by the qtcwrapcover package.
+func (r *CoverageReport) WriteProfile(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("mode: count\n")
+	for _, template := range r.Templates {
+		for _, block := range template.Blocks {
+			fmt.Fprintf(&b, "%s:%d.1,%d.1 %d %d\n", template.Template, block.StartLine, block.EndLine+1, block.EndLine-block.StartLine+1, block.Count)
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("cannot write coverage profile: %w", err)
+	}
+	return nil
+}
+
+// WriteSummary writes the percentage of executed lines of every template
+// and in total, one tab-separated line each, like "go tool cover -func".
+func (r *CoverageReport) WriteSummary(w io.Writer) error {
+	var b strings.Builder
+	for i := range r.Templates {
+		fmt.Fprintf(&b, "%s\t%.1f%%\n", r.Templates[i].Template, r.Templates[i].Percent())
+	}
+	fmt.Fprintf(&b, "total\t%.1f%%\n", r.Percent())
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("cannot write coverage summary: %w", err)
+	}
+	return nil
+}
+
+// WriteHTML writes an HTML page showing the source of every template with
+// executed lines in green, lines that never ran in red and lines outside
+// any block in gray. Hovering a line shows its execution count.
+//
+// Template names are resolved against the module containing root: import
+// paths of that module are mapped to its directory, absolute paths are
+// used as they are and other names are taken relative to root.
+func (r *CoverageReport) WriteHTML(w io.Writer, root string) error {
+	var module *Module
+	if modFile, err := findGoMod(root); err == nil {
+		m, err := readModule(filepath.Dir(modFile))
+		if err != nil {
+			return err
+		}
+		module = &m
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Template coverage</title>\n")
+	b.WriteString("<style>\nbody { font-family: sans-serif; }\npre { background: #222; color: #888; padding: 8px; }\n")
+	b.WriteString(".covered { color: #2ecc40; }\n.uncovered { color: #ff4136; }\n.line { display: inline-block; width: 4em; color: #666; }\n</style>\n</head>\n<body>\n")
+	fmt.Fprintf(&b, "<h1>Template coverage: %.1f%%</h1>\n<ul>\n", r.Percent())
+	for i := range r.Templates {
+		fmt.Fprintf(&b, "<li><a href=\"#template%d\">%s</a> %.1f%%</li>\n", i, html.EscapeString(r.Templates[i].Template), r.Templates[i].Percent())
+	}
+	b.WriteString("</ul>\n")
+
+	for i := range r.Templates {
+		template := &r.Templates[i]
+		file := resolveCoverTemplate(template.Template, root, module)
+		src, err := os.ReadFile(file) // #nosec G304 -- template paths come from the caller's coverage profiles
+		if err != nil {
+			return fmt.Errorf("cannot read template %s: %w", template.Template, err)
+		}
+
+		counts := template.LineCounts()
+		fmt.Fprintf(&b, "<h2 id=\"template%d\">%s %.1f%%</h2>\n<pre>\n", i, html.EscapeString(template.Template), template.Percent())
+		for n, line := range strings.Split(strings.TrimSuffix(string(src), "\n"), "\n") {
+			text := html.EscapeString(strings.TrimSuffix(line, "\r"))
+			count, ok := counts[n+1]
+			switch {
+			case !ok:
+				fmt.Fprintf(&b, "<span class=\"line\">%d</span><span>%s</span>\n", n+1, text)
+			case count > 0:
+				fmt.Fprintf(&b, "<span class=\"line\">%d</span><span class=\"covered\" title=\"%d execution(s)\">%s</span>\n", n+1, count, text)
+			default:
+				fmt.Fprintf(&b, "<span class=\"line\">%d</span><span class=\"uncovered\" title=\"0 execution(s)\">%s</span>\n", n+1, text)
+			}
+		}
+		b.WriteString("</pre>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("cannot write coverage report: %w", err)
+	}
+	return nil
+}
+
+// resolveCoverTemplate returns the file of a template named in a coverage
+// profile.
+func resolveCoverTemplate(name, root string, module *Module) string {
+	if module != nil {
+		if rel, ok := strings.CutPrefix(name, module.Path+"/"); ok {
+			return filepath.Join(module.Dir, filepath.FromSlash(rel))
+		}
+	}
+	if file := filepath.FromSlash(name); filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(root, filepath.FromSlash(name))
+}
+
+// coveragePercent returns covered as a percentage of total, or zero when
+// there is nothing to cover.
+func coveragePercent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
@@ -0,0 +1,177 @@
+package qtcwrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCoverProfile writes a coverage profile and returns its path.
+func writeCoverProfile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Cannot write coverage profile: %v", err)
+	}
+	return path
+}
+
+func TestReadCoverage(t *testing.T) {
+	dir := t.TempDir()
+	profiles := filepath.Join(dir, "cover")
+	if err := os.Mkdir(profiles, 0o700); err != nil {
+		t.Fatalf("Cannot create profile directory: %v", err)
+	}
+	writeCoverProfile(t, profiles, "a.out", "mode: count\nexample.com/app/home.qtpl:5.1,7.1 2 1\nexample.com/app/home.qtpl:9.1,10.1 1 0\n")
+	writeCoverProfile(t, profiles, "b.out", "mode: count\nexample.com/app/home.qtpl:5.1,7.1 2 3\nexample.com/app/about.qtpl:2.1,3.1 1 0\n")
+	single := writeCoverProfile(t, dir, "c.out", "mode: count\nexample.com/app/home.qtpl:9.1,10.1 1 0\n")
+
+	report, err := ReadCoverage(profiles, single)
+	if err != nil {
+		t.Fatalf("ReadCoverage failed: %v", err)
+	}
+
+	if len(report.Templates) != 2 || report.Templates[0].Template != "example.com/app/about.qtpl" {
+		t.Fatalf("Expected two templates sorted by name, got %+v", report.Templates)
+	}
+	home := report.Templates[1]
+	expected := []CoverageBlock{{StartLine: 5, EndLine: 6, Count: 4}, {StartLine: 9, EndLine: 9, Count: 0}}
+	if len(home.Blocks) != len(expected) {
+		t.Fatalf("Expected blocks %+v, got %+v", expected, home.Blocks)
+	}
+	for i := range expected {
+		if home.Blocks[i] != expected[i] {
+			t.Errorf("Expected block %+v, got %+v", expected[i], home.Blocks[i])
+		}
+	}
+
+	covered, total := home.Lines()
+	if covered != 2 || total != 3 {
+		t.Errorf("Expected 2 of 3 lines covered, got %d of %d", covered, total)
+	}
+	if percent := report.Percent(); percent != 50 {
+		t.Errorf("Expected 50%% total coverage, got %.1f%%", percent)
+	}
+}
+
+func TestReadCoverageErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"InvalidLine", "mode: count\nhome.qtpl 5 1\n", "invalid coverage profile line"},
+		{"ModeNotFirst", "home.qtpl:1.1,2.1 1 1\nmode: count\n", "invalid coverage profile line"},
+		{"InvalidCount", "home.qtpl:1.1,2.1 1 99999999999999999999\n", "invalid count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadCoverage(writeCoverProfile(t, dir, tt.name, tt.content))
+			assertValidationError(t, err, tt.expected, true)
+		})
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := ReadCoverage(filepath.Join(dir, "missing"))
+		assertValidationError(t, err, "cannot read coverage profile", true)
+	})
+}
+
+func TestTemplateCoverageLineCounts(t *testing.T) {
+	coverage := TemplateCoverage{Blocks: []CoverageBlock{
+		{StartLine: 3, EndLine: 4, Count: 2},
+		{StartLine: 4, EndLine: 4, Count: 0},
+		{StartLine: 6, EndLine: 6, Count: 0},
+	}}
+
+	counts := coverage.LineCounts()
+	expected := map[int]int64{3: 2, 4: 2, 6: 0}
+	if len(counts) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, counts)
+	}
+	for line, count := range expected {
+		if counts[line] != count {
+			t.Errorf("Expected line %d to have count %d, got %d", line, count, counts[line])
+		}
+	}
+	if percent := (&TemplateCoverage{}).Percent(); percent != 0 {
+		t.Errorf("Expected 0%% for a template without blocks, got %.1f%%", percent)
+	}
+}
+
+func TestCoverageReportWriteProfileAndSummary(t *testing.T) {
+	report := &CoverageReport{Templates: []TemplateCoverage{{
+		Template: "example.com/app/home.qtpl",
+		Blocks:   []CoverageBlock{{StartLine: 5, EndLine: 6, Count: 4}, {StartLine: 9, EndLine: 9, Count: 0}},
+	}}}
+
+	var profile strings.Builder
+	if err := report.WriteProfile(&profile); err != nil {
+		t.Fatalf("WriteProfile failed: %v", err)
+	}
+	expectedProfile := "mode: count\nexample.com/app/home.qtpl:5.1,7.1 2 4\nexample.com/app/home.qtpl:9.1,10.1 1 0\n"
+	if profile.String() != expectedProfile {
+		t.Errorf("Expected profile:\n%s\ngot:\n%s", expectedProfile, profile.String())
+	}
+
+	reread, err := ReadCoverage(writeCoverProfile(t, t.TempDir(), "merged.out", profile.String()))
+	if err != nil {
+		t.Fatalf("ReadCoverage failed: %v", err)
+	}
+	if len(reread.Templates) != 1 || len(reread.Templates[0].Blocks) != 2 || reread.Templates[0].Blocks[0] != report.Templates[0].Blocks[0] {
+		t.Errorf("Expected written profile to read back unchanged, got %+v", reread.Templates)
+	}
+
+	var summary strings.Builder
+	if err := report.WriteSummary(&summary); err != nil {
+		t.Fatalf("WriteSummary failed: %v", err)
+	}
+	expectedSummary := "example.com/app/home.qtpl\t66.7%\ntotal\t66.7%\n"
+	if summary.String() != expectedSummary {
+		t.Errorf("Expected summary %q, got %q", expectedSummary, summary.String())
+	}
+}
+
+func TestCoverageReportWriteHTML(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, goModFile), []byte("module example.com/app\n"), 0o600); err != nil {
+		t.Fatalf("Cannot write go.mod: %v", err)
+	}
+	writeTestTemplate(t, dir, filepath.Join("views", "home.qtpl"), "{% func Home(ok bool) %}\n{% if ok %}\n<b>yes</b>\n{% else %}\nno\n{% endif %}\n{% endfunc %}\n")
+	outside := writeTestTemplate(t, t.TempDir(), "other.qtpl", "{% func Other() %}\nother\n{% endfunc %}\n")
+
+	report := &CoverageReport{Templates: []TemplateCoverage{
+		{Template: "example.com/app/views/home.qtpl", Blocks: []CoverageBlock{
+			{StartLine: 1, EndLine: 2, Count: 1},
+			{StartLine: 3, EndLine: 3, Count: 1},
+			{StartLine: 5, EndLine: 5, Count: 0},
+		}},
+		{Template: filepath.ToSlash(outside), Blocks: []CoverageBlock{{StartLine: 1, EndLine: 2, Count: 0}}},
+	}}
+
+	var b strings.Builder
+	if err := report.WriteHTML(&b, filepath.Join(dir, "views")); err != nil {
+		t.Fatalf("WriteHTML failed: %v", err)
+	}
+
+	html := b.String()
+	for _, expected := range []string{
+		"<h1>Template coverage: 50.0%</h1>",
+		`<span class="line">3</span><span class="covered" title="1 execution(s)">&lt;b&gt;yes&lt;/b&gt;</span>`,
+		`<span class="line">4</span><span>{% else %}</span>`,
+		`<span class="line">5</span><span class="uncovered" title="0 execution(s)">no</span>`,
+		`<span class="line">2</span><span class="uncovered" title="0 execution(s)">other</span>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected HTML report to contain %q, got:\n%s", expected, html)
+		}
+	}
+
+	report.Templates = append(report.Templates, TemplateCoverage{Template: "example.com/app/views/missing.qtpl"})
+	err := report.WriteHTML(&b, dir)
+	assertValidationError(t, err, "cannot read template example.com/app/views/missing.qtpl", true)
+}
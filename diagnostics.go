@@ -0,0 +1,72 @@
+package qtcwrap
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// parseErrorPattern matches the template errors reported by qtc and the
+	// embedded backend, such as:
+	//
+	//	error when parsing file "views/a.qtpl": error in "func A()": empty if
+	//	condition at file "views/a.qtpl", line 3, pos 7, token "", last line "{% if %}"
+	parseErrorPattern = regexp.MustCompile(`error when parsing file "((?:[^"\\]|\\.)*)": (.*)$`)
+
+	// contextPattern matches the position quicktemplate's parser appends to
+	// its errors.
+	contextPattern = regexp.MustCompile(` at file "(?:[^"\\]|\\.)*", line (\d+), pos (\d+), token `)
+)
+
+// compileDiagnostics extracts the template errors from a failed compilation.
+//
+// Both backends report the first template that fails to parse, including
+// its position when quicktemplate knows it. Errors that do not concern a
+// template, such as a missing qtc binary, yield no diagnostics.
+func compileDiagnostics(err error) []Diagnostic {
+	text := err.Error()
+	var qtcErr *QtcError
+	if errors.As(err, &qtcErr) {
+		text = qtcErr.Stderr
+	}
+
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(text, "\n") {
+		match := parseErrorPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		file, unquoteErr := strconv.Unquote(`"` + match[1] + `"`)
+		if unquoteErr != nil {
+			file = match[1]
+		}
+
+		diagnostic := Diagnostic{File: file, Rule: RuleCompile, Severity: SeverityError, Message: match[2]}
+		if loc := contextPattern.FindStringSubmatchIndex(match[2]); loc != nil {
+			message := match[2]
+			diagnostic.Message = message[:loc[0]]
+			diagnostic.Line, _ = strconv.Atoi(message[loc[2]:loc[3]])
+			pos, _ := strconv.Atoi(message[loc[4]:loc[5]])
+			diagnostic.Column = pos + 1
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+// unstageDiagnostics rewrites the files of diagnostics reported for staged
+// copies to the original templates.
+func unstageDiagnostics(diagnostics []Diagnostic, staged []stagedTemplate) {
+	sources := make(map[string]string, len(staged))
+	for _, tpl := range staged {
+		sources[filepath.Clean(tpl.staged)] = tpl.source
+	}
+	for i := range diagnostics {
+		if source, ok := sources[filepath.Clean(diagnostics[i].File)]; ok {
+			diagnostics[i].File = source
+		}
+	}
+}
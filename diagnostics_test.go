@@ -0,0 +1,105 @@
+package qtcwrap
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// emptyIfTemplate fails to parse with an error on line 3.
+const emptyIfTemplate = "{% func Broken() %}\nhello\n{% if %}\n{% endfunc %}\n"
+
+func TestCompileDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected []Diagnostic
+	}{
+		{
+			name: "QtcStderr",
+			err: &QtcError{
+				Err: errors.New("exit status 1"),
+				Stderr: "qtc: 2024/01/02 10:00:00 Compiling *.qtpl template files in directory \"v\"\n" +
+					"qtc: 2024/01/02 10:00:00 error when parsing file \"v/a.qtpl\": error in \"func A()\": empty if condition " +
+					"at file \"v/a.qtpl\", line 3, pos 7, token \"\", last line \"{% if %}\"\n",
+			},
+			expected: []Diagnostic{
+				{File: "v/a.qtpl", Line: 3, Column: 8, Rule: RuleCompile, Severity: SeverityError, Message: "error in \"func A()\": empty if condition"},
+			},
+		},
+		{
+			name: "EmbeddedError",
+			err:  errors.New("error when parsing file \"v/b.qtpl\": unexpected tag \"endif\" at file \"v/b.qtpl\", line 12, pos 0, token \"endif\", last line \"{% endif %}\""),
+			expected: []Diagnostic{
+				{File: "v/b.qtpl", Line: 12, Column: 1, Rule: RuleCompile, Severity: SeverityError, Message: "unexpected tag \"endif\""},
+			},
+		},
+		{
+			name: "WithoutPosition",
+			err:  errors.New("error when parsing file \"v/c.qtpl\": unexpected EOF"),
+			expected: []Diagnostic{
+				{File: "v/c.qtpl", Rule: RuleCompile, Severity: SeverityError, Message: "unexpected EOF"},
+			},
+		},
+		{
+			name: "UnrelatedError",
+			err:  errors.New("qtc command not found in PATH"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compileDiagnostics(tt.err)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnstageDiagnostics(t *testing.T) {
+	staged := []stagedTemplate{{source: "views/a.qtpl", staged: "/tmp/stage/gen/a.qtpl", rel: "a.qtpl"}}
+	diagnostics := []Diagnostic{{File: "/tmp/stage/gen/a.qtpl"}, {File: "other.qtpl"}}
+
+	unstageDiagnostics(diagnostics, staged)
+
+	if diagnostics[0].File != "views/a.qtpl" || diagnostics[1].File != "other.qtpl" {
+		t.Errorf("Expected staged file to be mapped back, got %v", diagnostics)
+	}
+}
+
+func TestCompileReportsTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		outputDir bool
+	}{
+		{name: "InPlace"},
+		{name: "OutputDir", outputDir: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			templatesPath := filepath.Join(dir, templatesDir)
+			template := writeTestTemplate(t, templatesPath, "broken.qtpl", emptyIfTemplate)
+
+			config := Config{Dir: templatesPath, Backend: EmbeddedBackend}
+			if tt.outputDir {
+				config.OutputDir = filepath.Join(dir, genDir)
+			}
+
+			result, err := Compile(config)
+			if err == nil {
+				t.Fatal("Expected compilation to fail")
+			}
+			if len(result.Diagnostics) != 1 {
+				t.Fatalf("Expected 1 diagnostic, got %v", result.Diagnostics)
+			}
+			got := result.Diagnostics[0]
+			if got.File != template || got.Line != 3 || got.Rule != RuleCompile {
+				t.Errorf("Expected compile error at %s:3, got %v", template, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package qtcwrap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Invocation describes a planned compiler run.
+type Invocation struct {
+	// Binary is the compiler executable, the qtc binary found in PATH or
+	// "qtc" if it is not installed. It is empty for EmbeddedBackend, which
+	// compiles in-process with the same arguments.
+	Binary string
+
+	// Args holds the compiler arguments, as built from the configuration.
+	Args []string
+
+	// Dir is the working directory of the run.
+	Dir string
+
+	// Staged reports that the compiler runs on a temporary copy of the
+	// templates, as for OutputDir and Atomic. Args then refer to the
+	// original templates, since the copy only exists at run time.
+	Staged bool
+}
+
+// String returns the invocation as a shell command line.
+func (inv Invocation) String() string {
+	binary := inv.Binary
+	if binary == "" {
+		binary = "qtc (embedded)"
+	}
+	return strings.TrimSpace(binary + " " + strings.Join(inv.Args, " "))
+}
+
+// dryRun plans a compilation without running the compiler or writing any
+// file.
+//
+// The configuration is validated and the templates are discovered as usual.
+// The result lists the templates, the planned invocations in Invocations,
+// one per configured extension, the generated files that would be written
+// in Generated and those of them that already exist in Overwritten. Version constraints are not checked,
+// since that runs qtc.
+func dryRun(config Config) (*Result, error) {
+	if err := ValidateConfig(config); err != nil {
+		return nil, fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine working directory: %w", err)
+	}
+
+	binary := ""
+	if config.Backend != EmbeddedBackend {
+		binary = qtcBinary(config)
+		if path, err := exec.LookPath(binary); err == nil {
+			binary = path
+		}
+	}
+
+	result := &Result{Templates: templates}
+	for _, extConfig := range extConfigs(config) {
+		result.Invocations = append(result.Invocations, Invocation{
+			Binary: binary,
+			Args:   buildArgs(extConfig),
+			Dir:    wd,
+			Staged: config.OutputDir != "" || config.Atomic,
+		})
+	}
+	for _, template := range templates {
+		generated := generatedPath(config, template)
+		result.Generated = append(result.Generated, generated)
+
+		_, err := os.Stat(generated)
+		switch {
+		case err == nil:
+			result.Overwritten = append(result.Overwritten, generated)
+		case !errors.Is(err, os.ErrNotExist):
+			return result, fmt.Errorf("cannot check generated file %s: %w", generated, err)
+		}
+	}
+	return result, nil
+}
+
+// PrintDryRun writes the plan reported by a dry run to w: the planned
+// compiler invocations and the files that would be written or overwritten.
+//
+// Example:
+//
+//	result, err := Compile(Config{Dir: "templates", DryRun: true})
+//	if err == nil {
+//	    PrintDryRun(os.Stdout, result)
+//	}
+//	// [dry run] /usr/local/bin/qtc -dir=templates (in /src/app)
+//	// [dry run] would overwrite templates/home.qtpl.go
+func PrintDryRun(w io.Writer, result *Result) {
+	for _, invocation := range result.Invocations {
+		_, _ = fmt.Fprintf(w, "[dry run] %s (in %s)\n", invocation, invocation.Dir)
+	}
+
+	overwritten := make(map[string]bool, len(result.Overwritten))
+	for _, file := range result.Overwritten {
+		overwritten[file] = true
+	}
+	for _, file := range result.Generated {
+		if overwritten[file] {
+			_, _ = fmt.Fprintf(w, "[dry run] would overwrite %s\n", file)
+		} else {
+			_, _ = fmt.Fprintf(w, "[dry run] would write %s\n", file)
+		}
+	}
+}
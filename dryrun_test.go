@@ -0,0 +1,152 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileDryRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      func(dir string) Config
+		binary      bool
+		staged      bool
+		generated   []string
+		overwritten []string
+	}{
+		{
+			name: "InPlace",
+			config: func(dir string) Config {
+				return Config{Dir: dir, SkipLineComments: true, DryRun: true}
+			},
+			binary:      true,
+			generated:   []string{"a.qtpl.go", "b.qtpl.go"},
+			overwritten: []string{"a.qtpl.go"},
+		},
+		{
+			name: "OutputDirEmbedded",
+			config: func(dir string) Config {
+				return Config{Dir: dir, OutputDir: filepath.Join(dir, genDir), Backend: EmbeddedBackend, DryRun: true}
+			},
+			staged:    true,
+			generated: []string{filepath.Join(genDir, "a.qtpl.go"), filepath.Join(genDir, "b.qtpl.go")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), templatesDir)
+			writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+			writeTestTemplate(t, dir, "b.qtpl", helloTemplate)
+			existing := writeTestTemplate(t, dir, "a.qtpl.go", "package templates\n")
+
+			config := tt.config(dir)
+			result, err := Compile(config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(result.Invocations) != 1 {
+				t.Fatalf("Expected 1 planned invocation, got %v", result.Invocations)
+			}
+			invocation := result.Invocations[0]
+			if !reflect.DeepEqual(invocation.Args, buildArgs(config)) {
+				t.Errorf("Expected args %v, got %v", buildArgs(config), invocation.Args)
+			}
+			if (invocation.Binary != "") != tt.binary || invocation.Staged != tt.staged {
+				t.Errorf("Expected binary %v and staged %v, got %+v", tt.binary, tt.staged, invocation)
+			}
+			if wd, _ := os.Getwd(); invocation.Dir != wd {
+				t.Errorf("Expected working directory %s, got %s", wd, invocation.Dir)
+			}
+
+			if got := relPaths(t, dir, result.Generated); !reflect.DeepEqual(got, tt.generated) {
+				t.Errorf("Expected generated %v, got %v", tt.generated, got)
+			}
+			if got := relPaths(t, dir, result.Overwritten); !reflect.DeepEqual(got, tt.overwritten) {
+				t.Errorf("Expected overwritten %v, got %v", tt.overwritten, got)
+			}
+
+			// Nothing is written
+			if data, err := os.ReadFile(existing); err != nil || string(data) != "package templates\n" {
+				t.Errorf("Expected existing file to be untouched, got %q, %v", data, err)
+			}
+			for _, name := range []string{"b.qtpl.go", genDir} {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("Expected %s not to be written, got %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWithConfigDryRunWithoutQtc(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+	config := Config{Dir: dir, SkipLineComments: true, DryRun: true}
+
+	output := captureStdout(t, func() {
+		WithConfig(config)
+	})
+	expected := "[dry run] qtc -dir=" + dir + " " + skipCommentsArg
+	if !strings.Contains(output, expected) || strings.Contains(output, "validation failed") {
+		t.Errorf("Expected the dry run to plan %q without qtc installed, got %q", expected, output)
+	}
+
+	var err error
+	captureStdout(t, func() {
+		err = CompileWithValidation(config)
+	})
+	if err != nil {
+		t.Errorf("Expected CompileWithValidation to plan the dry run without qtc installed, got %v", err)
+	}
+}
+
+func TestCompileDryRunInvalidConfig(t *testing.T) {
+	_, err := Compile(Config{Dir: filepath.Join(t.TempDir(), "missing"), DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "configuration validation failed") {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+func TestPrintDryRun(t *testing.T) {
+	result := &Result{
+		Invocations: []Invocation{{Binary: "/usr/bin/qtc", Args: []string{dirTemplatesArg}, Dir: "/src"}},
+		Generated:   []string{"templates/a.qtpl.go", "templates/b.qtpl.go"},
+		Overwritten: []string{"templates/b.qtpl.go"},
+	}
+
+	var buf bytes.Buffer
+	PrintDryRun(&buf, result)
+
+	expected := "[dry run] /usr/bin/qtc -dir=templates (in /src)\n" +
+		"[dry run] would write templates/a.qtpl.go\n" +
+		"[dry run] would overwrite templates/b.qtpl.go\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestInvocationString(t *testing.T) {
+	if got := (Invocation{Args: []string{dirTemplatesArg}}).String(); got != "qtc (embedded) -dir=templates" {
+		t.Errorf("Expected embedded invocation, got %q", got)
+	}
+}
+
+// relPaths returns paths relative to dir, or nil for no paths.
+func relPaths(t *testing.T, dir string, paths []string) []string {
+	var rel []string
+	for _, path := range paths {
+		r, err := filepath.Rel(dir, path)
+		if err != nil {
+			t.Fatalf("Failed to resolve %s: %v", path, err)
+		}
+		rel = append(rel, r)
+	}
+	return rel
+}
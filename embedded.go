@@ -0,0 +1,182 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+
+	"github.com/valyala/quicktemplate/parser"
+)
+
+// Backend selects how templates are compiled.
+type Backend string
+
+const (
+	// ExecBackend compiles templates by running the external qtc binary.
+	// It is used when Config.Backend is empty.
+	ExecBackend Backend = "exec"
+
+	// EmbeddedBackend compiles templates in-process by calling quicktemplate's
+	// parser package directly. It does not require qtc to be installed.
+	EmbeddedBackend Backend = "embedded"
+)
+
+// defaultQtcExt is the template extension qtc uses when none is configured.
+const defaultQtcExt = "qtpl"
+
+// defaultQtcBinary is the qtc binary used when Config.Qtc is empty.
+const defaultQtcBinary = "qtc"
+
+// validateBackend checks that the configured backend is known and usable.
+//
+// The exec backend requires the qtc binary to be available; the
+// embedded backend has no external requirements.
+func validateBackend(config Config) error {
+	switch config.Backend {
+	case "", ExecBackend:
+		return validateQtcTool(qtcBinary(config))
+	case EmbeddedBackend:
+		return nil
+	default:
+		return fmt.Errorf("unknown backend %q", config.Backend)
+	}
+}
+
+// runBackend compiles templates in place with the configured backend.
+//
+// The exec backend runs qtc once per configured extension, stopping at the
+// first failing run.
+func runBackend(ctx context.Context, config Config) error {
+	switch config.Backend {
+	case "", ExecBackend:
+		runner := contextRunner(ctx, qtcBinary(config))
+		for _, extConfig := range extConfigs(config) {
+			if err := runner.Run(ctx, buildArgs(extConfig)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case EmbeddedBackend:
+		return compileEmbedded(config)
+	default:
+		return fmt.Errorf("unknown backend %q", config.Backend)
+	}
+}
+
+// compileEmbedded compiles templates in-process with the same semantics as
+// the qtc command-line tool.
+//
+// In single file mode only File is compiled. In directory mode Dir is
+// processed recursively and every file with one of the configured
+// extensions is compiled, with files of each directory handled in name order. Like qtc,
+// compilation stops at the first template that fails.
+func compileEmbedded(config Config) error {
+	if config.File != "" {
+		info, err := os.Stat(config.File)
+		if err != nil {
+			return fmt.Errorf("cannot stat file %q: %w", config.File, err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("cannot compile directory %q. Use Dir instead", config.File)
+		}
+		return compileEmbeddedFile(config.File, config.SkipLineComments)
+	}
+
+	dir := config.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return compileEmbeddedDir(dir, templateExts(config.Ext), config.SkipLineComments)
+}
+
+// compileEmbeddedDir compiles all templates with one of the extensions
+// exts below dir.
+func compileEmbeddedDir(dir string, exts []string, skipLineComments bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot compile files in %q: %w", dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := compileEmbeddedDir(filepath.Join(dir, entry.Name()), exts, skipLineComments); err != nil {
+				return err
+			}
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+
+	for _, name := range names {
+		if hasTemplateExt(name, exts) {
+			if err := compileEmbeddedFile(filepath.Join(dir, name), skipLineComments); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileEmbeddedFile compiles a single template to a Go file next to it.
+//
+// The package name is derived from the template's directory, exactly as qtc
+// does, and the generated code is formatted with go/format.
+func compileEmbeddedFile(infile string, skipLineComments bool) error {
+	code, err := generateCode(infile, skipLineComments)
+	if err != nil {
+		return err
+	}
+
+	outfile := infile + ".go"
+	// #nosec G306 -- generated Go sources are meant to be readable like any other source file
+	if err := os.WriteFile(outfile, code, generatedFilePerm); err != nil {
+		return fmt.Errorf("error when writing file %q: %w", outfile, err)
+	}
+	return nil
+}
+
+// generateCode returns the formatted Go code generated for a template file.
+func generateCode(infile string, skipLineComments bool) ([]byte, error) {
+	src, err := os.Open(infile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %q: %w", infile, err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	packageName, err := templatePackageName(infile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine package name for %q: %w", infile, err)
+	}
+
+	parse := parser.Parse
+	if skipLineComments {
+		parse = parser.ParseNoLineComments
+	}
+
+	var buf bytes.Buffer
+	if err := parse(&buf, src, infile, packageName); err != nil {
+		return nil, fmt.Errorf("error when parsing file %q: %w", infile, err)
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error when formatting compiled code for %q: %w", infile, err)
+	}
+	return code, nil
+}
+
+// templatePackageName returns the default package name for a template,
+// which is the name of the directory containing it.
+func templatePackageName(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(filepath.Dir(abs)), nil
+}
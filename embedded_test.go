@@ -0,0 +1,231 @@
+package qtcwrap
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// Embedded backend test constants.
+	corpusDir = "testdata/corpus"
+)
+
+// copyCorpus copies the shared template fixture corpus into a new temporary
+// directory and returns the path of the copy.
+func copyCorpus(t *testing.T) string {
+	templates, err := FindTemplateFiles(corpusDir, qtplExt)
+	if err != nil {
+		t.Fatalf(findTemplateFilesErr, err)
+	}
+
+	tempDir := createTempTestDir(t)
+	t.Cleanup(func() {
+		cleanupTempDir(t, tempDir)
+	})
+
+	dst := filepath.Join(tempDir, "corpus")
+	if _, err := stageTemplates(corpusDir, dst, templates); err != nil {
+		t.Fatalf("Failed to copy fixture corpus: %v", err)
+	}
+	return dst
+}
+
+// removeGeneratedFiles deletes all generated Go files below dir.
+func removeGeneratedFiles(t *testing.T, dir string) {
+	for path := range readGeneratedFiles(t, dir) {
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("Failed to remove %s: %v", path, err)
+		}
+	}
+}
+
+func TestEmbeddedMatchesExec(t *testing.T) {
+	requireQtc(t)
+
+	dir := copyCorpus(t)
+	for _, skipLineComments := range []bool{true, false} {
+		config := Config{Dir: dir, SkipLineComments: skipLineComments}
+
+		if _, err := Compile(config); err != nil {
+			t.Fatalf("Exec compilation failed: %v", err)
+		}
+		expected := readGeneratedFiles(t, dir)
+		removeGeneratedFiles(t, dir)
+
+		config.Backend = EmbeddedBackend
+		if _, err := Compile(config); err != nil {
+			t.Fatalf("Embedded compilation failed: %v", err)
+		}
+		actual := readGeneratedFiles(t, dir)
+		removeGeneratedFiles(t, dir)
+
+		if len(actual) != len(expected) {
+			t.Fatalf("Expected %d generated files, got %d", len(expected), len(actual))
+		}
+		for path, code := range expected {
+			if actual[path] != code {
+				t.Errorf("Embedded output for %s differs from qtc output (skipLineComments=%t)", path, skipLineComments)
+			}
+		}
+	}
+}
+
+func TestEmbeddedMatchesExecFileMode(t *testing.T) {
+	requireQtc(t)
+
+	dir := copyCorpus(t)
+	file := filepath.Join(dir, "layout", "page.qtpl")
+	config := Config{File: file, SkipLineComments: false}
+
+	if _, err := Compile(config); err != nil {
+		t.Fatalf("Exec compilation failed: %v", err)
+	}
+	expected, err := os.ReadFile(file + goExt)
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+
+	config.Backend = EmbeddedBackend
+	if _, err := Compile(config); err != nil {
+		t.Fatalf("Embedded compilation failed: %v", err)
+	}
+	actual, err := os.ReadFile(file + goExt)
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+
+	if string(actual) != string(expected) {
+		t.Error("Embedded output differs from qtc output in single file mode")
+	}
+}
+
+func TestCompileEmbedded(t *testing.T) {
+	dir := copyCorpus(t)
+
+	result, err := Compile(Config{Dir: dir, SkipLineComments: true, Backend: EmbeddedBackend})
+	if err != nil {
+		t.Fatalf("Embedded compilation failed: %v", err)
+	}
+	if len(result.Generated) != 4 {
+		t.Fatalf("Expected 4 generated files, got %v", result.Generated)
+	}
+
+	expectedPackages := map[string]string{
+		"basic.qtpl.go":          "corpus",
+		"layout/page.qtpl.go":    "layout",
+		"emails/welcome.qtpl.go": "mail",
+	}
+	for name, pkg := range expectedPackages {
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			t.Fatalf("Generated file %s is not valid Go: %v", name, err)
+		}
+		if file.Name.Name != pkg {
+			t.Errorf("Expected %s to declare package '%s', got '%s'", name, pkg, file.Name.Name)
+		}
+	}
+}
+
+func TestCompileEmbeddedWithExtension(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	writeTestTemplate(t, tempDir, "hello.tpl", helloTemplate)
+	writeTestTemplate(t, tempDir, "ignored.qtpl", helloTemplate)
+
+	if err := compileEmbedded(Config{Dir: tempDir, Ext: "tpl"}); err != nil {
+		t.Fatalf("Embedded compilation failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "hello.tpl.go")); err != nil {
+		t.Errorf("Expected hello.tpl to be compiled: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ignored.qtpl.go")); !os.IsNotExist(err) {
+		t.Error("Expected ignored.qtpl not to be compiled")
+	}
+}
+
+func TestCompileEmbeddedErrors(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+	broken := writeTestTemplate(t, tempDir, "broken.qtpl", brokenTemplate)
+
+	tests := []struct {
+		name     string
+		config   Config
+		errorMsg string
+	}{
+		{"SyntaxError", Config{File: broken}, "error when parsing file"},
+		{"MissingFile", Config{File: filepath.Join(tempDir, "missing.qtpl")}, "cannot stat file"},
+		{"FileIsDirectory", Config{File: tempDir}, "cannot compile directory"},
+		{"MissingDirectory", Config{Dir: filepath.Join(tempDir, "missing")}, "cannot compile files in"},
+		{"BrokenTemplateInDirectory", Config{Dir: tempDir}, "broken.qtpl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationError(t, compileEmbedded(tt.config), tt.errorMsg, true)
+		})
+	}
+}
+
+func TestEmbeddedBackendStaging(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	srcDir := filepath.Join(tempDir, templatesDir)
+	outDir := filepath.Join(tempDir, genDir)
+	writeTestTemplate(t, srcDir, "hello.qtpl", helloTemplate)
+
+	t.Run("OutputDir", func(t *testing.T) {
+		result, err := Compile(Config{Dir: srcDir, OutputDir: outDir, Backend: EmbeddedBackend})
+		if err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		code, err := os.ReadFile(result.Generated[0])
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		if !strings.Contains(string(code), "package gen\n") {
+			t.Error("Expected generated code to use the output directory package")
+		}
+	})
+
+	t.Run("AtomicFailure", func(t *testing.T) {
+		generated := writeTestTemplate(t, srcDir, "hello.qtpl.go", staleGeneratedCode)
+		writeTestTemplate(t, srcDir, "z_broken.qtpl", brokenTemplate)
+
+		if _, err := Compile(Config{Dir: srcDir, Atomic: true, Backend: EmbeddedBackend}); err == nil {
+			t.Fatal("Expected compilation error")
+		}
+		data, err := os.ReadFile(generated)
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		if string(data) != staleGeneratedCode {
+			t.Error("Expected existing generated code to stay untouched")
+		}
+	})
+}
+
+func TestValidateBackend(t *testing.T) {
+	t.Run("Embedded", func(t *testing.T) {
+		assertValidationError(t, validateBackend(Config{Backend: EmbeddedBackend}), "", false)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		assertValidationError(t, validateBackend(Config{Backend: "docker"}), "unknown backend", true)
+		assertValidationError(t, runBackend(context.Background(), Config{Backend: "docker"}), "unknown backend", true)
+		assertValidationError(t, ValidateConfig(Config{Dir: ".", Backend: "docker"}), "unknown backend", true)
+	})
+
+	t.Run("CompileWithValidationEmbedded", func(t *testing.T) {
+		dir := copyCorpus(t)
+		err := CompileWithValidation(Config{Dir: dir, Backend: EmbeddedBackend})
+		assertValidationError(t, err, "", false)
+	})
+}
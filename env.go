@@ -0,0 +1,165 @@
+package qtcwrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding Config
+// fields, such as QTCWRAP_DIR for Dir and QTCWRAP_QTC for Qtc.
+//
+// Values are resolved in this order, later sources taking precedence:
+//
+//  1. Defaults, as returned by GetDefaultConfig
+//  2. Configuration files: //go:generate qtcwrap directives and
+//     qtcwrap:generate template markers
+//  3. Code: the Config or options passed to the API, and command-line flags
+//  4. Environment variables
+//
+// Environment variables therefore let CI change a build, such as keeping
+// line comments with QTCWRAP_SKIP_LINE_COMMENTS=false, without code
+// changes. Generate and CompileModule take the template locations from
+// directives and packages, so QTCWRAP_DIR and QTCWRAP_FILE do not apply
+// to them. Result.EnvOverrides reports the fields a compilation took from
+// the environment.
+const EnvPrefix = "QTCWRAP_"
+
+// EnvOverride describes a Config field overridden by an environment
+// variable. Result.EnvOverrides reports the overrides a compilation used.
+type EnvOverride struct {
+	// Field is the name of the overridden Config field, such as "Dir".
+	Field string
+
+	// Var is the name of the environment variable, such as "QTCWRAP_DIR".
+	Var string
+
+	// Value is the value of the environment variable.
+	Value string
+}
+
+// envField links a Config field to the environment variable overriding it.
+type envField struct {
+	// field is the name of the Config field.
+	field string
+
+	// name is the variable name without EnvPrefix.
+	name string
+
+	// location marks fields selecting the templates to compile.
+	location bool
+
+	// set parses value into the field.
+	set func(config *Config, value string) error
+}
+
+// envFields lists the environment variable of every Config field.
+var envFields = []envField{
+	{field: "Dir", name: "DIR", location: true, set: func(c *Config, v string) error { c.Dir = v; return nil }},
+	{field: "File", name: "FILE", location: true, set: func(c *Config, v string) error { c.File = v; return nil }},
+	{field: "Ext", name: "EXT", set: func(c *Config, v string) error { c.Ext = v; return nil }},
+	{field: "SkipLineComments", name: "SKIP_LINE_COMMENTS", set: envBool(func(c *Config) *bool { return &c.SkipLineComments })},
+	{field: "OutputDir", name: "OUTPUT_DIR", set: func(c *Config, v string) error { c.OutputDir = v; return nil }},
+	{field: "Atomic", name: "ATOMIC", set: envBool(func(c *Config) *bool { return &c.Atomic })},
+	{field: "Backend", name: "BACKEND", set: func(c *Config, v string) error { c.Backend = Backend(v); return nil }},
+	{field: "SourceMaps", name: "SOURCE_MAPS", set: envBool(func(c *Config) *bool { return &c.SourceMaps })},
+	{field: "PostBuildCheck", name: "POST_BUILD_CHECK", set: envBool(func(c *Config) *bool { return &c.PostBuildCheck })},
+	{field: "CacheDir", name: "CACHE_DIR", set: func(c *Config, v string) error { c.CacheDir = v; return nil }},
+	{field: "MinQtcVersion", name: "MIN_QTC_VERSION", set: func(c *Config, v string) error { c.MinQtcVersion = v; return nil }},
+	{field: "MaxQtcVersion", name: "MAX_QTC_VERSION", set: func(c *Config, v string) error { c.MaxQtcVersion = v; return nil }},
+	{field: "MatchModuleVersion", name: "MATCH_MODULE_VERSION", set: envBool(func(c *Config) *bool { return &c.MatchModuleVersion })},
+	{field: "Retries", name: "RETRIES", set: func(c *Config, v string) (err error) { c.Retries, err = strconv.Atoi(v); return err }},
+	{field: "RetryBackoff", name: "RETRY_BACKOFF", set: func(c *Config, v string) (err error) { c.RetryBackoff, err = time.ParseDuration(v); return err }},
+	{field: "DryRun", name: "DRY_RUN", set: envBool(func(c *Config) *bool { return &c.DryRun })},
+	{field: "Qtc", name: "QTC", set: func(c *Config, v string) error { c.Qtc = v; return nil }},
+	{field: "Coverage", name: "COVERAGE", set: envBool(func(c *Config) *bool { return &c.Coverage })},
+}
+
+// envBool returns a setter parsing a boolean into the field returned by
+// field.
+func envBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// EnvOverrides returns the Config fields overridden by the environment, in
+// the order of the Config fields. Variables that are set to an empty
+// string are ignored.
+//
+// Example:
+//
+//	for _, override := range EnvOverrides() {
+//	    fmt.Printf("%s = %q (from %s)\n", override.Field, override.Value, override.Var)
+//	}
+func EnvOverrides() []EnvOverride {
+	var overrides []EnvOverride
+	for _, f := range envFields {
+		name := EnvPrefix + f.name
+		if value := os.Getenv(name); value != "" {
+			overrides = append(overrides, EnvOverride{Field: f.field, Var: name, Value: value})
+		}
+	}
+	return overrides
+}
+
+// ApplyEnv returns config with the overrides of the environment applied.
+// It fails if a variable holds a value that cannot be parsed for its
+// field, such as QTCWRAP_RETRIES=many.
+//
+// Compile, WithConfig, New and the qtcwrap command apply the environment
+// themselves; ApplyEnv shows the effective configuration ahead of time.
+//
+// Example:
+//
+//	config, err := ApplyEnv(Config{Dir: "templates", SkipLineComments: true})
+//	if err != nil {
+//	    fmt.Printf("Invalid environment: %v\n", err)
+//	}
+func ApplyEnv(config Config) (Config, error) {
+	config, _, err := applyEnv(config, true)
+	return config, err
+}
+
+// applyEnv applies the overrides of the environment to config and returns
+// the applied overrides. Overrides of the template location are skipped
+// unless withLocation is set.
+func applyEnv(config Config, withLocation bool) (Config, []EnvOverride, error) {
+	var overrides []EnvOverride
+	for _, f := range envFields {
+		if f.location && !withLocation {
+			continue
+		}
+		name := EnvPrefix + f.name
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if err := f.set(&config, value); err != nil {
+			return config, nil, fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+		}
+		overrides = append(overrides, EnvOverride{Field: f.field, Var: name, Value: value})
+	}
+	return config, overrides, nil
+}
+
+// envSource returns the environment variable overriding field, or an empty
+// string if the field keeps the value set in code.
+func envSource(field string) string {
+	for _, f := range envFields {
+		if f.field != field {
+			continue
+		}
+		name := EnvPrefix + f.name
+		if os.Getenv(name) != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,223 @@
+package qtcwrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valksor/go-qtcwrap/internal/fakeqtc"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected Config
+	}{
+		{"NoOverrides", nil, Config{Dir: templatesDir, SkipLineComments: true}},
+		{
+			name: "Overrides",
+			env: map[string]string{
+				"QTCWRAP_DIR":                "views",
+				"QTCWRAP_SKIP_LINE_COMMENTS": "false",
+				"QTCWRAP_BACKEND":            "embedded",
+				"QTCWRAP_RETRIES":            "2",
+				"QTCWRAP_RETRY_BACKOFF":      "1s",
+				"QTCWRAP_QTC":                "/opt/bin/qtc",
+			},
+			expected: Config{Dir: viewsDir, Backend: EmbeddedBackend, Retries: 2, RetryBackoff: time.Second, Qtc: "/opt/bin/qtc"},
+		},
+		{"EmptyValue", map[string]string{"QTCWRAP_DIR": ""}, Config{Dir: templatesDir, SkipLineComments: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			config, err := ApplyEnv(Config{Dir: templatesDir, SkipLineComments: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, config)
+			}
+		})
+	}
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		t.Setenv("QTCWRAP_ATOMIC", "sometimes")
+		_, err := ApplyEnv(Config{})
+		assertValidationError(t, err, "QTCWRAP_ATOMIC", true)
+	})
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("QTCWRAP_QTC", "/opt/bin/qtc")
+	t.Setenv("QTCWRAP_DIR", viewsDir)
+
+	overrides := EnvOverrides()
+	expected := []EnvOverride{
+		{Field: "Dir", Var: "QTCWRAP_DIR", Value: viewsDir},
+		{Field: "Qtc", Var: "QTCWRAP_QTC", Value: "/opt/bin/qtc"},
+	}
+	if len(overrides) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, overrides)
+	}
+	for i := range expected {
+		if overrides[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], overrides[i])
+		}
+	}
+}
+
+func TestValidateConfigEnvSource(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("FromEnvironment", func(t *testing.T) {
+		t.Setenv("QTCWRAP_DIR", filepath.Join(dir, "missing"))
+		err := ValidateConfig(Config{Dir: dir})
+		assertValidationError(t, err, "(set by QTCWRAP_DIR)", true)
+	})
+
+	t.Run("FromCode", func(t *testing.T) {
+		t.Setenv("QTCWRAP_SKIP_LINE_COMMENTS", "false")
+		err := ValidateConfig(Config{Dir: filepath.Join(dir, "missing")})
+		if err == nil || strings.Contains(err.Error(), "set by") {
+			t.Errorf("Expected an error without environment source, got %v", err)
+		}
+	})
+
+	t.Run("MissingBinary", func(t *testing.T) {
+		t.Setenv("QTCWRAP_QTC", filepath.Join(dir, "qtc"))
+		err := ValidateConfig(Config{Dir: dir})
+		assertValidationError(t, err, "(set by QTCWRAP_QTC)", true)
+	})
+}
+
+func TestNewAppliesEnv(t *testing.T) {
+	t.Setenv("QTCWRAP_SKIP_LINE_COMMENTS", "false")
+	if New(WithSkipLineComments(true)).Config().SkipLineComments {
+		t.Error("Expected the environment to override the options")
+	}
+	if !GetDefaultConfig().SkipLineComments {
+		t.Error("Expected GetDefaultConfig to ignore the environment")
+	}
+
+	t.Setenv("QTCWRAP_RETRIES", "many")
+	if _, err := New().Compile(context.Background()); err == nil || !strings.Contains(err.Error(), "QTCWRAP_RETRIES") {
+		t.Errorf("Expected the invalid override to be reported, got %v", err)
+	}
+}
+
+func TestCompileReportsEnvOverrides(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	result, err := New(FromConfig(Config{Dir: dir, Backend: EmbeddedBackend})).Compile(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.EnvOverrides) != 0 {
+		t.Errorf("Expected no overrides without environment variables, got %+v", result.EnvOverrides)
+	}
+
+	t.Setenv("QTCWRAP_BACKEND", string(EmbeddedBackend))
+	t.Setenv("QTCWRAP_SKIP_LINE_COMMENTS", "false")
+	logger := &logRecorder{}
+	result, err = New(WithDir(dir), WithLogger(logger)).Compile(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []EnvOverride{
+		{Field: "SkipLineComments", Var: "QTCWRAP_SKIP_LINE_COMMENTS", Value: "false"},
+		{Field: "Backend", Var: "QTCWRAP_BACKEND", Value: string(EmbeddedBackend)},
+	}
+	if !reflect.DeepEqual(result.EnvOverrides, expected) {
+		t.Errorf("Expected overrides %+v, got %+v", expected, result.EnvOverrides)
+	}
+	message := `[qtcwrap env] Backend = "embedded" (set by QTCWRAP_BACKEND)`
+	if len(logger.messages) != 2 || logger.messages[1] != message {
+		t.Errorf("Expected the overrides to be logged, got %q", logger.messages)
+	}
+}
+
+func TestCompileQtcBinaryFromEnv(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+	fake := fakeqtc.Build(t, fakeqtc.Script{Generate: true})
+	t.Setenv("QTCWRAP_QTC", fake.Path)
+	t.Setenv("PATH", t.TempDir())
+
+	if _, err := Compile(Config{Dir: dir}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := fake.Calls(t); len(calls) != 1 {
+		t.Errorf("Expected the configured binary to be run once, got %+v", calls)
+	}
+}
+
+func TestCompileWithValidationEnv(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+	fake := fakeqtc.Build(t, fakeqtc.Script{Generate: true})
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		calls int
+	}{
+		{"EmbeddedBackend", map[string]string{"QTCWRAP_BACKEND": string(EmbeddedBackend)}, 0},
+		{"QtcBinary", map[string]string{"QTCWRAP_QTC": fake.Path}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PATH", t.TempDir())
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			fake.Reset(t)
+			dir := filepath.Join(t.TempDir(), templatesDir)
+			template := writeTestTemplate(t, dir, "a.qtpl", helloTemplate)
+
+			var err error
+			captureStdout(t, func() {
+				err = CompileWithValidation(Config{Dir: dir, SkipLineComments: true})
+			})
+			if err != nil {
+				t.Fatalf("Expected the environment to select an available compiler, got %v", err)
+			}
+			if _, err := os.Stat(template + goExt); err != nil {
+				t.Errorf("Expected the template to be compiled: %v", err)
+			}
+			if calls := fake.Calls(t); len(calls) != tt.calls {
+				t.Errorf("Expected %d qtc runs, got %+v", tt.calls, calls)
+			}
+		})
+	}
+}
+
+func TestGenerateIgnoresLocationEnv(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, "views/page.qtpl", "qtcwrap:generate\n\n"+helloTemplate)
+	t.Setenv("QTCWRAP_FILE", filepath.Join(root, "missing.qtpl"))
+	t.Setenv("QTCWRAP_BACKEND", string(EmbeddedBackend))
+
+	report, err := Generate(root)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(report.Packages) != 1 || report.Packages[0] != filepath.Join(root, viewsDir) {
+		t.Errorf("Expected the marker's template to be compiled with the embedded backend, got %v", report.Packages)
+	}
+}
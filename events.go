@@ -0,0 +1,186 @@
+package qtcwrap
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// EventAction identifies the kind of an Event.
+type EventAction string
+
+const (
+	// ActionDiscover reports a template selected for compilation.
+	ActionDiscover EventAction = "discover"
+
+	// ActionStart reports that compilation started.
+	ActionStart EventAction = "start"
+
+	// ActionEnd reports that compilation finished, successfully or not.
+	ActionEnd EventAction = "end"
+
+	// ActionDiagnostic reports a problem found in a template.
+	ActionDiagnostic EventAction = "diagnostic"
+
+	// ActionWarning reports a suppressed qtc warning.
+	ActionWarning EventAction = "warning"
+
+	// ActionSummary is the last event of a compilation.
+	ActionSummary EventAction = "summary"
+)
+
+// Event is a step of a compilation, reported by CompileWithEvents.
+//
+// Only the fields relevant to Action are set, so events encode to compact
+// JSON objects, similar to the output of "go test -json".
+type Event struct {
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+
+	// Action identifies the kind of event.
+	Action EventAction `json:"action"`
+
+	// Template is the discovered template.
+	Template string `json:"template,omitempty"`
+
+	// Backend is the backend compiling the templates, set on start.
+	Backend Backend `json:"backend,omitempty"`
+
+	// Elapsed is the compilation time in seconds, set on end and summary.
+	Elapsed float64 `json:"elapsed,omitempty"`
+
+	// Generated and Cached list the generated files and the files restored
+	// from the build cache, set on end.
+	Generated []string `json:"generated,omitempty"`
+	Cached    []string `json:"cached,omitempty"`
+
+	// Diagnostic is the reported problem.
+	Diagnostic *Diagnostic `json:"diagnostic,omitempty"`
+
+	// Warning is the suppressed qtc output.
+	Warning string `json:"warning,omitempty"`
+
+	// Error describes why compilation failed, set on end and summary.
+	Error string `json:"error,omitempty"`
+
+	// Summary totals the compilation.
+	Summary *EventSummary `json:"summary,omitempty"`
+}
+
+// EventSummary totals a compilation.
+type EventSummary struct {
+	// Passed reports whether the compilation succeeded.
+	Passed bool `json:"passed"`
+
+	// Templates, Generated, Cached, Warnings and Diagnostics count the
+	// corresponding items of the compilation Result.
+	Templates   int `json:"templates"`
+	Generated   int `json:"generated"`
+	Cached      int `json:"cached"`
+	Warnings    int `json:"warnings"`
+	Diagnostics int `json:"diagnostics"`
+}
+
+// CompileWithEvents compiles templates like Compile and reports every step
+// to emit as it happens.
+//
+// Events are emitted in this order: one discover event per selected
+// template, start, end, one diagnostic event per Result diagnostic, one
+// warning event per suppressed warning, and a final summary. If the
+// templates cannot be listed, only the summary is emitted. The result and
+// error are those of Compile.
+//
+// Example:
+//
+//	// Stream JSON lines to an IDE plugin
+//	_, err := CompileWithEvents(Config{Dir: "templates"}, JSONEvents(os.Stdout))
+func CompileWithEvents(config Config, emit func(Event)) (*Result, error) {
+	started := time.Now()
+	event := func(action EventAction) Event {
+		return Event{Time: time.Now(), Action: action}
+	}
+
+	config, err := ApplyEnv(config)
+	var templates []string
+	if err == nil {
+		templates, err = configTemplates(config)
+	}
+	if err != nil {
+		summary := event(ActionSummary)
+		summary.Elapsed = time.Since(started).Seconds()
+		summary.Error = err.Error()
+		summary.Summary = &EventSummary{}
+		emit(summary)
+		return nil, err
+	}
+
+	for _, template := range templates {
+		discover := event(ActionDiscover)
+		discover.Template = template
+		emit(discover)
+	}
+
+	start := event(ActionStart)
+	start.Backend = config.Backend
+	if start.Backend == "" {
+		start.Backend = ExecBackend
+	}
+	emit(start)
+
+	result, err := Compile(config)
+	if result == nil {
+		result = &Result{Templates: templates}
+	}
+
+	end := event(ActionEnd)
+	end.Elapsed = time.Since(started).Seconds()
+	end.Generated = result.Generated
+	end.Cached = result.Cached
+	if err != nil {
+		end.Error = err.Error()
+	}
+	emit(end)
+
+	for i := range result.Diagnostics {
+		diagnostic := event(ActionDiagnostic)
+		diagnostic.Diagnostic = &result.Diagnostics[i]
+		emit(diagnostic)
+	}
+	for _, warning := range result.Warnings {
+		suppressed := event(ActionWarning)
+		suppressed.Warning = warning
+		emit(suppressed)
+	}
+
+	summary := event(ActionSummary)
+	summary.Elapsed = time.Since(started).Seconds()
+	summary.Error = end.Error
+	summary.Summary = &EventSummary{
+		Passed:      err == nil,
+		Templates:   len(result.Templates),
+		Generated:   len(result.Generated),
+		Cached:      len(result.Cached),
+		Warnings:    len(result.Warnings),
+		Diagnostics: len(result.Diagnostics),
+	}
+	emit(summary)
+
+	return result, err
+}
+
+// JSONEvents returns an event callback for CompileWithEvents that writes
+// every event to w as a single line of JSON. Write errors are ignored, so
+// a closed reader does not affect the compilation.
+//
+// Example:
+//
+//	CompileWithEvents(config, JSONEvents(os.Stdout))
+//	// {"time":"...","action":"discover","template":"templates/home.qtpl"}
+//	// {"time":"...","action":"start","backend":"exec"}
+//	// ...
+func JSONEvents(w io.Writer) func(Event) {
+	encoder := json.NewEncoder(w)
+	return func(event Event) {
+		_ = encoder.Encode(event)
+	}
+}
@@ -0,0 +1,119 @@
+package qtcwrap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// eventActions returns the actions of events in order.
+func eventActions(events []Event) []EventAction {
+	actions := make([]EventAction, 0, len(events))
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+func TestCompileWithEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]string
+		actions   []EventAction
+		passed    bool
+	}{
+		{
+			name:      "Success",
+			templates: map[string]string{"a.qtpl": helloTemplate, "b.qtpl": helloTemplate},
+			actions:   []EventAction{ActionDiscover, ActionDiscover, ActionStart, ActionEnd, ActionSummary},
+			passed:    true,
+		},
+		{
+			name:      "TemplateError",
+			templates: map[string]string{"broken.qtpl": emptyIfTemplate},
+			actions:   []EventAction{ActionDiscover, ActionStart, ActionEnd, ActionDiagnostic, ActionSummary},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), templatesDir)
+			for name, content := range tt.templates {
+				writeTestTemplate(t, dir, name, content)
+			}
+
+			var events []Event
+			_, err := CompileWithEvents(Config{Dir: dir, Backend: EmbeddedBackend}, func(event Event) {
+				events = append(events, event)
+			})
+			if (err == nil) != tt.passed {
+				t.Fatalf("Expected passed %v, got error %v", tt.passed, err)
+			}
+
+			if got := eventActions(events); !reflect.DeepEqual(got, tt.actions) {
+				t.Fatalf("Expected actions %v, got %v", tt.actions, got)
+			}
+
+			start := events[len(tt.templates)]
+			if start.Backend != EmbeddedBackend {
+				t.Errorf("Expected start event for embedded backend, got %q", start.Backend)
+			}
+
+			summary := events[len(events)-1].Summary
+			if summary == nil || summary.Passed != tt.passed || summary.Templates != len(tt.templates) {
+				t.Errorf("Expected summary of %d templates with passed %v, got %+v", len(tt.templates), tt.passed, summary)
+			}
+			if end := events[len(tt.templates)+1]; tt.passed && len(end.Generated) != len(tt.templates) {
+				t.Errorf("Expected end event to list generated files, got %v", end.Generated)
+			}
+		})
+	}
+}
+
+func TestCompileWithEventsMissingDir(t *testing.T) {
+	var events []Event
+	_, err := CompileWithEvents(Config{Dir: filepath.Join(t.TempDir(), "missing")}, func(event Event) {
+		events = append(events, event)
+	})
+	if err == nil {
+		t.Fatal("Expected error for missing directory")
+	}
+	if len(events) != 1 || events[0].Action != ActionSummary || events[0].Error == "" {
+		t.Errorf("Expected a single failed summary, got %+v", events)
+	}
+}
+
+func TestJSONEvents(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, "broken.qtpl", emptyIfTemplate)
+
+	var buf bytes.Buffer
+	if _, err := CompileWithEvents(Config{Dir: dir, Backend: EmbeddedBackend}, JSONEvents(&buf)); err == nil {
+		t.Fatal("Expected compilation to fail")
+	}
+
+	var actions []string
+	var diagnostic map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var object map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &object); err != nil {
+			t.Fatalf("Expected one JSON object per line, got %q: %v", scanner.Text(), err)
+		}
+		actions = append(actions, object["action"].(string))
+		if object["action"] == string(ActionDiagnostic) {
+			diagnostic = object["diagnostic"].(map[string]any)
+		}
+	}
+
+	expected := []string{"discover", "start", "end", "diagnostic", "summary"}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expected actions %v, got %v", expected, actions)
+	}
+	if diagnostic["line"] != float64(3) || diagnostic["rule"] != RuleCompile {
+		t.Errorf("Expected compile diagnostic on line 3, got %v", diagnostic)
+	}
+}
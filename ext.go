@@ -0,0 +1,100 @@
+package qtcwrap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// extSeparator separates the extensions listed in Config.Ext, such as
+// ".qtpl,.qtxt".
+const extSeparator = ","
+
+// templateExts returns the extensions listed in ext, each with a leading
+// dot, in order and without duplicates. Without any extension, qtc's
+// default ".qtpl" is returned.
+func templateExts(ext string) []string {
+	var exts []string
+	for _, e := range strings.Split(ext, extSeparator) {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if !slices.Contains(exts, e) {
+			exts = append(exts, e)
+		}
+	}
+	if len(exts) == 0 {
+		return []string{"." + defaultQtcExt}
+	}
+	return exts
+}
+
+// hasTemplateExt reports whether the file name ends with one of exts.
+//
+// The extension must follow at least one character of the name, so
+// ".qtpl" matches "home.qtpl" but neither "home.xqtpl" nor a file named
+// just ".qtpl".
+func hasTemplateExt(name string, exts []string) bool {
+	for _, ext := range exts {
+		if len(name) > len(ext) && strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExt checks the extensions listed in ext: each must start with a
+// dot and none may be empty.
+func validateExt(ext string) error {
+	if ext == "" {
+		return nil
+	}
+	for _, e := range strings.Split(ext, extSeparator) {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			return fmt.Errorf("empty extension in %q", ext)
+		}
+		if !strings.HasPrefix(e, ".") {
+			return fmt.Errorf("extension must start with a dot: %s", e)
+		}
+		if e == "." {
+			return errors.New("extension must not be a single dot")
+		}
+	}
+	return nil
+}
+
+// extConfigs splits a directory configuration listing several extensions
+// into one configuration per extension, since qtc accepts a single -ext.
+// Other configurations are returned unchanged.
+func extConfigs(config Config) []Config {
+	if config.File != "" || !strings.Contains(config.Ext, extSeparator) {
+		return []Config{config}
+	}
+
+	exts := templateExts(config.Ext)
+	configs := make([]Config, 0, len(exts))
+	for _, ext := range exts {
+		extConfig := config
+		extConfig.Ext = ext
+		configs = append(configs, extConfig)
+	}
+	return configs
+}
+
+// coversExts reports whether the extensions listed in outer include every
+// extension listed in inner.
+func coversExts(outer, inner string) bool {
+	outerExts := templateExts(outer)
+	for _, ext := range templateExts(inner) {
+		if !slices.Contains(outerExts, ext) {
+			return false
+		}
+	}
+	return true
+}
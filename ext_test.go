@@ -0,0 +1,174 @@
+package qtcwrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/valksor/go-qtcwrap/internal/fakeqtc"
+)
+
+const (
+	// Extension test constants.
+	qtxtExt          = ".qtxt"
+	multiExt         = ".qtpl,.qtxt"
+	textTemplate     = "{% func Mail() %}Hello{% endfunc %}\n"
+	extQtxtArg       = "-ext=.qtxt"
+	mailQtxtFile     = "mail.qtxt"
+	otherTplFile     = "other.xqtpl"
+	pageQtplFile     = "page.qtpl"
+	expectedFilesErr = "Expected %v, got %v"
+)
+
+func TestTemplateExts(t *testing.T) {
+	tests := []struct {
+		ext      string
+		expected []string
+	}{
+		{"", []string{qtplExt}},
+		{qtplExt, []string{qtplExt}},
+		{"qtpl", []string{qtplExt}},
+		{multiExt, []string{qtplExt, qtxtExt}},
+		{" .qtpl , qtxt ,.qtpl", []string{qtplExt, qtxtExt}},
+	}
+
+	for _, tt := range tests {
+		if got := templateExts(tt.ext); strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("templateExts(%q) = %v, expected %v", tt.ext, got, tt.expected)
+		}
+	}
+}
+
+func TestHasTemplateExt(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{pageQtplFile, true},
+		{mailQtxtFile, true},
+		{otherTplFile, false},
+		{qtplExt, false},
+		{"page.qtpl.go", false},
+	}
+
+	exts := templateExts(multiExt)
+	for _, tt := range tests {
+		if got := hasTemplateExt(tt.name, exts); got != tt.expected {
+			t.Errorf("hasTemplateExt(%q) = %t, expected %t", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestValidateExt(t *testing.T) {
+	tests := []struct {
+		ext         string
+		expectError bool
+	}{
+		{"", false},
+		{multiExt, false},
+		{".qtpl, .qtxt", false},
+		{".qtpl,qtxt", true},
+		{".qtpl,,.qtxt", true},
+		{".", true},
+	}
+
+	for _, tt := range tests {
+		if err := validateExt(tt.ext); (err != nil) != tt.expectError {
+			t.Errorf("validateExt(%q) = %v, expected error: %t", tt.ext, err, tt.expectError)
+		}
+	}
+}
+
+func TestFindTemplateFilesMultipleExtensions(t *testing.T) {
+	dir := t.TempDir()
+	page := writeTestTemplate(t, dir, pageQtplFile, helloTemplate)
+	mail := writeTestTemplate(t, dir, "nested/"+mailQtxtFile, textTemplate)
+	writeTestTemplate(t, dir, otherTplFile, helloTemplate)
+
+	files, err := FindTemplateFiles(dir, multiExt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{mail, page}
+	if strings.Join(files, "|") != strings.Join(expected, "|") {
+		t.Errorf(expectedFilesErr, expected, files)
+	}
+
+	// Extensions without a leading dot must not match longer extensions
+	files, err = FindTemplateFiles(dir, "qtpl")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(files) != 1 || files[0] != page {
+		t.Errorf(expectedFilesErr, []string{page}, files)
+	}
+}
+
+func TestCompileMultipleExtensions(t *testing.T) {
+	t.Run("Embedded", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), templatesDir)
+		page := writeTestTemplate(t, dir, pageQtplFile, helloTemplate)
+		mail := writeTestTemplate(t, dir, mailQtxtFile, textTemplate)
+		writeTestTemplate(t, dir, otherTplFile, helloTemplate)
+
+		result, err := Compile(Config{Dir: dir, Ext: multiExt, Backend: EmbeddedBackend})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{mail + goExt, page + goExt}
+		if strings.Join(result.Generated, "|") != strings.Join(expected, "|") {
+			t.Errorf(expectedFilesErr, expected, result.Generated)
+		}
+		if _, err := os.Stat(filepath.Join(dir, otherTplFile+goExt)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be compiled, got %v", otherTplFile, err)
+		}
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), templatesDir)
+		writeTestTemplate(t, dir, pageQtplFile, helloTemplate)
+		writeTestTemplate(t, dir, mailQtxtFile, textTemplate)
+
+		fake := fakeqtc.Build(t, fakeqtc.Script{Generate: true})
+		fake.Install(t)
+
+		if _, err := Compile(Config{Dir: dir, Ext: multiExt}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		calls := fake.Calls(t)
+		if len(calls) != 2 {
+			t.Fatalf("Expected one qtc run per extension, got %+v", calls)
+		}
+		for i, ext := range []string{extQtplArg, extQtxtArg} {
+			if !strings.Contains(strings.Join(calls[i].Args, " "), ext) {
+				t.Errorf("Expected run %d to use %s, got %v", i, ext, calls[i].Args)
+			}
+		}
+	})
+}
+
+func TestDryRunMultipleExtensions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), templatesDir)
+	writeTestTemplate(t, dir, pageQtplFile, helloTemplate)
+
+	result, err := Compile(Config{Dir: dir, Ext: multiExt, Backend: EmbeddedBackend, DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Invocations) != 2 {
+		t.Errorf("Expected one planned invocation per extension, got %+v", result.Invocations)
+	}
+}
+
+func TestBatchConfigsExtensions(t *testing.T) {
+	dir := absPath(templatesDir)
+	outer := Config{Dir: dir, Ext: multiExt}
+	textOnly := Config{Dir: filepath.Join(dir, viewsDir), Ext: qtxtExt}
+	textFile := Config{File: filepath.Join(dir, mailQtxtFile)}
+
+	batched := batchConfigs([]Config{outer, textOnly, textFile, {Dir: dir, Ext: "qtpl, .qtxt"}})
+	if len(batched) != 1 || batched[0] != outer {
+		t.Errorf("Expected configurations covered by the extension list to be batched, got %+v", batched)
+	}
+}
@@ -0,0 +1,261 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// templateFunc is a template func found in generated code.
+type templateFunc struct {
+	// Name is the name of the func, without Write or Stream prefix.
+	Name string
+
+	// Receiver is the receiver type of a template method, such as
+	// "*BasePage", or empty for plain funcs.
+	Receiver string
+
+	// Params lists the parameters of the func.
+	Params []funcParam
+
+	// Stream, Write and String report which variants were generated.
+	Stream, Write, String bool
+
+	// pos is the position of the StreamName declaration.
+	pos token.Pos
+
+	// imports maps the import names of the declaring file to import paths.
+	imports map[string]string
+}
+
+// funcParam is a parameter of a template func.
+type funcParam struct {
+	// Name is the parameter name.
+	Name string
+
+	// Type is the parameter type as written in the generated code.
+	Type string
+
+	// Variadic is set for a final "...T" parameter; Type then holds T.
+	Variadic bool
+
+	// expr is the type expression.
+	expr ast.Expr
+}
+
+// params returns the parameters in their exported form.
+func (f templateFunc) params() []TemplateParam {
+	params := make([]TemplateParam, 0, len(f.Params))
+	for _, param := range f.Params {
+		params = append(params, TemplateParam{Name: param.Name, Type: param.Type, Variadic: param.Variadic})
+	}
+	return params
+}
+
+// discoverTemplateFuncs lists the template funcs generated into the Go
+// package in dir that can be called from other packages, sorted by name.
+//
+// Only exported funcs without receiver that come with Stream and Write
+// variants are reported.
+func discoverTemplateFuncs(dir string) ([]templateFunc, error) {
+	fset := token.NewFileSet()
+	files, err := parsePackageDir(fset, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var funcs []templateFunc
+	for _, fn := range collectTemplateFuncs(fset, files) {
+		if fn.Receiver == "" && ast.IsExported(fn.Name) && fn.Stream && fn.Write {
+			funcs = append(funcs, fn)
+		}
+	}
+
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Name < funcs[j].Name
+	})
+	return funcs, nil
+}
+
+// collectTemplateFuncs finds the template funcs declared in the generated
+// files among files, in declaration order.
+//
+// qtc turns every template func Name into the funcs StreamName, WriteName
+// and Name, where StreamName is the one every other variant calls. A
+// template func is therefore recognized by its StreamName declaration, and
+// its parameters are those of StreamName after the leading writer.
+func collectTemplateFuncs(fset *token.FileSet, files []*ast.File) []templateFunc {
+	type funcKey struct {
+		receiver string
+		name     string
+	}
+
+	declared := make(map[funcKey]bool)
+	var streams []*ast.FuncDecl
+	var streamFiles []*ast.File
+	for _, file := range files {
+		if !ast.IsGenerated(file) {
+			continue
+		}
+		for _, d := range file.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			declared[funcKey{receiverType(fset, fn), fn.Name.Name}] = true
+			if strings.HasPrefix(fn.Name.Name, "Stream") && len(fn.Name.Name) > len("Stream") {
+				streams = append(streams, fn)
+				streamFiles = append(streamFiles, file)
+			}
+		}
+	}
+
+	funcs := make([]templateFunc, 0, len(streams))
+	for i, stream := range streams {
+		params := stream.Type.Params.List
+		if len(params) == 0 || len(params[0].Names) != 1 {
+			continue
+		}
+
+		receiver := receiverType(fset, stream)
+		name := strings.TrimPrefix(stream.Name.Name, "Stream")
+		fn := templateFunc{
+			Name:     name,
+			Receiver: receiver,
+			Stream:   true,
+			Write:    declared[funcKey{receiver, "Write" + name}],
+			String:   declared[funcKey{receiver, name}],
+			pos:      stream.Pos(),
+			imports:  fileImports(streamFiles[i]),
+		}
+
+		for _, field := range params[1:] {
+			expr := field.Type
+			variadic := false
+			if ellipsis, ok := expr.(*ast.Ellipsis); ok {
+				expr, variadic = ellipsis.Elt, true
+			}
+			for _, ident := range field.Names {
+				fn.Params = append(fn.Params, funcParam{Name: ident.Name, Type: exprString(fset, expr), Variadic: variadic, expr: expr})
+			}
+		}
+		funcs = append(funcs, fn)
+	}
+	return funcs
+}
+
+// receiverType returns the receiver type of a method as Go source, or an
+// empty string for plain funcs.
+func receiverType(fset *token.FileSet, fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	return exprString(fset, fn.Recv.List[0].Type)
+}
+
+// fileImports maps the import names of a file to import paths.
+//
+// Imports without an explicit name are assumed to use the last element of
+// their path, ignoring a major version suffix such as "/v2".
+func fileImports(file *ast.File) map[string]string {
+	imports := make(map[string]string, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := path.Base(importPath)
+		if isMajorVersion(name) {
+			name = path.Base(path.Dir(importPath))
+		}
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+	return imports
+}
+
+// isMajorVersion reports whether a path element is a major version suffix.
+func isMajorVersion(elem string) bool {
+	n, err := strconv.Atoi(strings.TrimPrefix(elem, "v"))
+	return strings.HasPrefix(elem, "v") && err == nil && n >= 2
+}
+
+// exprString formats an expression as Go source.
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, expr); err != nil {
+		return fmt.Sprintf("%T", expr)
+	}
+	return buf.String()
+}
+
+// qualifyType writes a parameter type as it must appear outside its
+// package: types declared in the package are qualified with pkgAlias and
+// imported types with the alias returned by importAlias for their path.
+//
+// It reports false for types that cannot be named outside the package,
+// such as unexported types, and for type expressions not supported by the
+// preview server.
+func qualifyType(expr ast.Expr, pkgAlias string, imports map[string]string, importAlias func(string) string) (string, bool) {
+	qualify := func(e ast.Expr) (string, bool) {
+		return qualifyType(e, pkgAlias, imports, importAlias)
+	}
+
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(e.Name) != nil {
+			return e.Name, true
+		}
+		if !ast.IsExported(e.Name) {
+			return "", false
+		}
+		return pkgAlias + "." + e.Name, true
+	case *ast.SelectorExpr:
+		pkg, ok := e.X.(*ast.Ident)
+		if !ok || !ast.IsExported(e.Sel.Name) {
+			return "", false
+		}
+		importPath, ok := imports[pkg.Name]
+		if !ok {
+			return "", false
+		}
+		return importAlias(importPath) + "." + e.Sel.Name, true
+	case *ast.StarExpr:
+		elem, ok := qualify(e.X)
+		return "*" + elem, ok
+	case *ast.ArrayType:
+		elem, ok := qualify(e.Elt)
+		if !ok {
+			return "", false
+		}
+		if e.Len == nil {
+			return "[]" + elem, true
+		}
+		if lit, isLit := e.Len.(*ast.BasicLit); isLit {
+			return "[" + lit.Value + "]" + elem, true
+		}
+		return "", false
+	case *ast.MapType:
+		key, ok := qualify(e.Key)
+		if !ok {
+			return "", false
+		}
+		value, ok := qualify(e.Value)
+		return "map[" + key + "]" + value, ok
+	case *ast.InterfaceType:
+		if e.Methods == nil || len(e.Methods.List) == 0 {
+			return "interface{}", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,100 @@
+package qtcwrap
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscoverTemplateFuncs(t *testing.T) {
+	corpus := copyCorpus(t)
+	if _, err := Compile(Config{Dir: corpus, Backend: EmbeddedBackend}); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	tests := []struct {
+		dir       string
+		expected  []string
+		signature string
+	}{
+		{".", []string{"Greeting", "List"}, "name string, count int"},
+		{"layout", []string{"PageTemplate"}, "p Page"},
+		{"emails", []string{"Welcome"}, "user string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			funcs, err := discoverTemplateFuncs(filepath.Join(corpus, tt.dir))
+			if err != nil {
+				t.Fatalf("discoverTemplateFuncs failed: %v", err)
+			}
+			if len(funcs) != len(tt.expected) {
+				t.Fatalf("Expected funcs %v, got %+v", tt.expected, funcs)
+			}
+			for i, name := range tt.expected {
+				if funcs[i].Name != name {
+					t.Errorf("Expected func %d to be %s, got %s", i, name, funcs[i].Name)
+				}
+			}
+			if got := (TemplateFunc{Params: funcs[0].params()}).Signature(); got != tt.signature {
+				t.Errorf("Expected signature %q, got %q", tt.signature, got)
+			}
+		})
+	}
+}
+
+func TestQualifyType(t *testing.T) {
+	imports := map[string]string{"time": "time", "yaml": "gopkg.in/yaml.v3"}
+	aliases := map[string]string{"time": "i1", "gopkg.in/yaml.v3": "i2"}
+
+	tests := []struct {
+		expr     string
+		expected string
+		ok       bool
+	}{
+		{"string", "string", true},
+		{"[]map[string]int", "[]map[string]int", true},
+		{"*Page", "*t0.Page", true},
+		{"[3]time.Time", "[3]i1.Time", true},
+		{"map[string]yaml.Node", "map[string]i2.Node", true},
+		{"interface{}", "interface{}", true},
+		{"any", "any", true},
+		{"page", "", false},
+		{"[]*page", "", false},
+		{"func()", "", false},
+		{"other.Type", "", false},
+		{"interface{ String() string }", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", tt.expr, err)
+			}
+			got, ok := qualifyType(expr, "t0", imports, func(importPath string) string {
+				return aliases[importPath]
+			})
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("Expected %q (%t), got %q (%t)", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestFileImports(t *testing.T) {
+	src := "package p\n\nimport (\n\t\"time\"\n\tqt \"github.com/valyala/quicktemplate\"\n\t\"example.com/mod/v2\"\n)\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, parser.ImportsOnly)
+	if err != nil {
+		t.Fatalf("Failed to parse source: %v", err)
+	}
+
+	imports := fileImports(file)
+	expected := map[string]string{"time": "time", "qt": "github.com/valyala/quicktemplate", "mod": "example.com/mod/v2"}
+	for name, importPath := range expected {
+		if imports[name] != importPath {
+			t.Errorf("Expected %s to import %s, got %q", name, importPath, imports[name])
+		}
+	}
+}
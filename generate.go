@@ -0,0 +1,529 @@
+package qtcwrap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// generateDirectivePrefix starts go:generate directives invoking qtcwrap.
+	generateDirectivePrefix = "//go:generate"
+
+	// templateMarker marks templates that should be compiled by Generate.
+	templateMarker = "qtcwrap:generate"
+
+	// commandName is the name of the qtcwrap command-line tool.
+	commandName = "qtcwrap"
+
+	// qtplExtension is the default template extension.
+	qtplExtension = ".qtpl"
+)
+
+// ParseArgs builds a Config from qtcwrap command-line arguments.
+//
+// The flags mirror the Config fields and start from GetDefaultConfig, so
+// line comments are skipped unless -skipLineComments=false is given:
+//
+//	-dir, -file, -ext, -skipLineComments, -output, -atomic,
+//	-backend, -sourcemaps, -check, -cache, -minQtcVersion,
+//	-maxQtcVersion, -matchModuleVersion, -retries, -retryBackoff,
+//	-dryRun, -qtc, -coverage
+//
+// The same arguments are accepted by the qtcwrap command and by
+// "//go:generate qtcwrap" directives.
+//
+// Example:
+//
+//	config, err := ParseArgs([]string{"-dir=templates", "-ext=.qtpl"})
+//	if err != nil {
+//	    fmt.Printf("Invalid arguments: %v\n", err)
+//	    return
+//	}
+//	WithConfig(config)
+func ParseArgs(args []string) (Config, error) {
+	config := GetDefaultConfig()
+	flags := newFlagSet(&config)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil {
+		return config, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if flags.NArg() > 0 {
+		return config, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return config, nil
+}
+
+// PrintFlags writes the flags accepted by ParseArgs and their defaults to w.
+func PrintFlags(w io.Writer) {
+	config := GetDefaultConfig()
+	flags := newFlagSet(&config)
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// newFlagSet returns a flag set that stores its values in config.
+func newFlagSet(config *Config) *flag.FlagSet {
+	flags := flag.NewFlagSet(commandName, flag.ContinueOnError)
+	flags.StringVar(&config.Dir, "dir", config.Dir, "directory with template files to compile")
+	flags.StringVar(&config.File, "file", config.File, "single template file to compile; -dir and -ext are ignored")
+	flags.StringVar(&config.Ext, "ext", config.Ext, "comma-separated extensions of template files (default qtc's .qtpl)")
+	flags.BoolVar(&config.SkipLineComments, "skipLineComments", config.SkipLineComments, "don't write line comments")
+	flags.StringVar(&config.OutputDir, "output", config.OutputDir, "directory receiving the generated files")
+	flags.BoolVar(&config.Atomic, "atomic", config.Atomic, "only replace generated files if every template compiles")
+	flags.Func("backend", "compiler backend: exec or embedded", func(value string) error {
+		config.Backend = Backend(value)
+		return nil
+	})
+	flags.BoolVar(&config.SourceMaps, "sourcemaps", config.SourceMaps, "write source map side files")
+	flags.BoolVar(&config.PostBuildCheck, "check", config.PostBuildCheck, "type-check generated packages")
+	flags.StringVar(&config.CacheDir, "cache", config.CacheDir, "build cache directory")
+	flags.StringVar(&config.MinQtcVersion, "minQtcVersion", config.MinQtcVersion, "minimum accepted qtc version")
+	flags.StringVar(&config.MaxQtcVersion, "maxQtcVersion", config.MaxQtcVersion, "maximum accepted qtc version")
+	flags.BoolVar(&config.MatchModuleVersion, "matchModuleVersion", config.MatchModuleVersion, "require qtc to match the quicktemplate version in go.mod")
+	flags.IntVar(&config.Retries, "retries", config.Retries, "number of retries of transient qtc failures")
+	flags.DurationVar(&config.RetryBackoff, "retryBackoff", config.RetryBackoff, "wait before the first retry, doubled for every further retry (default 200ms)")
+	flags.BoolVar(&config.DryRun, "dryRun", config.DryRun, "print the planned qtc invocations and files without compiling")
+	flags.StringVar(&config.Qtc, "qtc", config.Qtc, "qtc binary used by the exec backend (default qtc from PATH)")
+	flags.BoolVar(&config.Coverage, "coverage", config.Coverage, "instrument generated code with template coverage counters")
+	return flags
+}
+
+// Directive is a request to compile templates found in the source tree.
+//
+// Directives come from "//go:generate qtcwrap ..." lines in Go files and from
+// "qtcwrap:generate ..." marker lines in templates.
+type Directive struct {
+	// Position is the location of the directive.
+	Position Position
+
+	// Args holds the qtcwrap arguments of the directive.
+	Args []string
+
+	// Config is the configuration described by Args. Paths are resolved
+	// relative to the directory containing the directive, which is where
+	// go generate would run the command. Marker lines in templates default
+	// to compiling the template itself.
+	Config Config
+}
+
+// GenerateReport describes the outcome of Generate.
+type GenerateReport struct {
+	// Directives lists all directives that were found.
+	Directives []Directive
+
+	// Configs lists the deduplicated configurations that were compiled.
+	Configs []Config
+
+	// Results holds the result of each compiled configuration, in the
+	// order of Configs.
+	Results []*Result
+
+	// Packages lists the directories that received generated code.
+	Packages []string
+}
+
+// ScanDirectives discovers qtcwrap directives below root.
+//
+// It finds "//go:generate qtcwrap ..." directives in Go files and
+// "qtcwrap:generate ..." marker lines in .qtpl templates. Like go generate's
+// "./..." pattern, it skips vendor and testdata directories and directories
+// starting with "." or "_", and it does not descend into node_modules
+// directories either.
+//
+// Example:
+//
+//	directives, err := ScanDirectives(".")
+//	if err != nil {
+//	    fmt.Printf("Cannot scan directives: %v\n", err)
+//	    return
+//	}
+//	for _, directive := range directives {
+//	    fmt.Printf("%s: qtcwrap %s\n", directive.Position, strings.Join(directive.Args, " "))
+//	}
+func ScanDirectives(root string) ([]Directive, error) {
+	templateExtensions := templateExts(qtplExtension)
+	var goFiles, templates []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			if path != root && skippedDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+		case strings.HasSuffix(entry.Name(), ".go"):
+			goFiles = append(goFiles, path)
+		case hasTemplateExt(entry.Name(), templateExtensions):
+			templates = append(templates, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking the path %s: %w", root, err)
+	}
+
+	var directives []Directive
+	for _, file := range goFiles {
+		found, err := scanFile(file, parseGenerateLine)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, found...)
+	}
+	for _, file := range templates {
+		found, err := scanFile(file, parseMarkerLine)
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			if found[i].Config.File == "" && !hasFlag(found[i].Args, "dir") {
+				found[i].Config.File = file
+			}
+		}
+		directives = append(directives, found...)
+	}
+	return directives, nil
+}
+
+// Generate runs all qtcwrap directives below root as one batched compilation.
+//
+// Directives are discovered with ScanDirectives. Identical configurations
+// are compiled once, and configurations already covered by a directory
+// compilation with the same options are skipped. Compilation continues after
+// a failing configuration; all errors are returned together.
+//
+// Example:
+//
+//	report, err := Generate(".")
+//	for _, pkg := range report.Packages {
+//	    fmt.Printf("regenerated %s\n", pkg)
+//	}
+//	if err != nil {
+//	    fmt.Printf("Generation failed: %v\n", err)
+//	}
+func Generate(root string) (*GenerateReport, error) {
+	directives, err := ScanDirectives(root)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]Config, 0, len(directives))
+	for _, directive := range directives {
+		config, _, err := applyEnv(directive.Config, false)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+
+	report := &GenerateReport{Directives: directives, Configs: batchConfigs(configs)}
+	packages := make(map[string]bool)
+
+	var errs []error
+	for _, config := range report.Configs {
+		result, err := compileContext(context.Background(), config)
+		report.Results = append(report.Results, result)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if result == nil {
+			continue
+		}
+		for _, generated := range result.Generated {
+			packages[filepath.Dir(generated)] = true
+		}
+	}
+
+	for pkg := range packages {
+		report.Packages = append(report.Packages, pkg)
+	}
+	sort.Strings(report.Packages)
+	return report, errors.Join(errs...)
+}
+
+// lineParser extracts qtcwrap arguments from a source line. It returns false
+// if the line is not a directive.
+type lineParser func(line string) ([]string, bool, error)
+
+// scanFile returns the directives found in file by parse.
+func scanFile(file string, parse lineParser) ([]Directive, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", file, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var directives []Directive
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		args, ok, err := parse(scanner.Text())
+		pos := Position{File: file, Line: lineNo}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pos, err)
+		}
+		if !ok {
+			continue
+		}
+
+		config, err := ParseArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pos, err)
+		}
+		directives = append(directives, Directive{
+			Position: pos,
+			Args:     args,
+			Config:   resolveConfigPaths(config, filepath.Dir(file)),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	return directives, nil
+}
+
+// goRunValueFlags lists the flags of go run that take their value as a
+// separate word, such as "-mod mod".
+var goRunValueFlags = map[string]bool{
+	"C": true, "asmflags": true, "buildmode": true, "compiler": true, "covermode": true,
+	"coverpkg": true, "exec": true, "gccgoflags": true, "gcflags": true, "installsuffix": true,
+	"ldflags": true, "mod": true, "modfile": true, "overlay": true, "p": true, "pgo": true,
+	"pkgdir": true, "tags": true, "toolexec": true,
+}
+
+// parseGenerateLine parses a "//go:generate qtcwrap ..." line. Directives
+// running the command through "go run [build flags] .../cmd/qtcwrap", with
+// or without an "@version" suffix, are recognized too.
+func parseGenerateLine(line string) ([]string, bool, error) {
+	rest, ok := strings.CutPrefix(line, generateDirectivePrefix)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return nil, false, nil
+	}
+
+	words, err := splitArgs(rest)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(words) >= 2 && words[0] == "go" && words[1] == "run" {
+		words = skipGoRunFlags(words[2:])
+	}
+	if len(words) == 0 {
+		return nil, false, nil
+	}
+	command, _, _ := strings.Cut(words[0], "@")
+	if filepath.Base(command) != commandName {
+		return nil, false, nil
+	}
+	return words[1:], true, nil
+}
+
+// skipGoRunFlags returns the words of a go run command line following its
+// build flags, starting with the package to run.
+func skipGoRunFlags(words []string) []string {
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(words[0], "-"), "=")
+		words = words[1:]
+		if name == "" {
+			break
+		}
+		if !hasValue && goRunValueFlags[name] && len(words) > 0 {
+			words = words[1:]
+		}
+	}
+	return words
+}
+
+// parseMarkerLine parses a "qtcwrap:generate ..." marker line in a template.
+func parseMarkerLine(line string) ([]string, bool, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), templateMarker)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return nil, false, nil
+	}
+
+	words, err := splitArgs(rest)
+	if err != nil {
+		return nil, false, err
+	}
+	return words, true, nil
+}
+
+// splitArgs splits a directive into words the way go generate does:
+// words are separated by spaces and double-quoted strings form one word.
+func splitArgs(line string) ([]string, error) {
+	var words []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := 1
+			for ; end < len(line); end++ {
+				if line[end] == '\\' {
+					end++
+					continue
+				}
+				if line[end] == '"' {
+					break
+				}
+			}
+			if end >= len(line) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			word, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string: %w", err)
+			}
+			words = append(words, word)
+			line = strings.TrimSpace(line[end+1:])
+			continue
+		}
+
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		words = append(words, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+	return words, nil
+}
+
+// hasFlag reports whether args set the named flag.
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConfigPaths makes the relative paths of config relative to dir.
+func resolveConfigPaths(config Config, dir string) Config {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	config.Dir = resolve(config.Dir)
+	config.File = resolve(config.File)
+	config.OutputDir = resolve(config.OutputDir)
+	config.CacheDir = resolve(config.CacheDir)
+
+	// A bare command name is looked up in PATH, like go generate does
+	if strings.ContainsRune(config.Qtc, '/') || strings.ContainsRune(config.Qtc, filepath.Separator) {
+		config.Qtc = resolve(config.Qtc)
+	}
+	return config
+}
+
+// skippedDir reports whether ScanDirectives skips a directory with the
+// given name: the directories go generate's "./..." pattern skips, and
+// node_modules, which never holds Go packages of the module.
+func skippedDir(name string) bool {
+	return name == "vendor" || name == "testdata" || name == "node_modules" ||
+		strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// batchConfigs removes duplicate configurations and configurations covered
+// by a directory compilation with the same options.
+func batchConfigs(configs []Config) []Config {
+	var unique []Config
+	seen := make(map[Config]bool)
+	for _, config := range configs {
+		normalized := normalizeConfig(config)
+		if !seen[normalized] {
+			seen[normalized] = true
+			unique = append(unique, config)
+		}
+	}
+
+	batched := make([]Config, 0, len(unique))
+	for i, config := range unique {
+		covered := false
+		for j, other := range unique {
+			if i != j && coversConfig(other, config) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			batched = append(batched, config)
+		}
+	}
+	return batched
+}
+
+// coversConfig reports whether compiling outer also compiles everything
+// inner would, with identical options.
+//
+// Only in-place directory compilations cover other configurations, since qtc
+// processes directories recursively. A directory covers itself only for a
+// single file configuration.
+func coversConfig(outer, inner Config) bool {
+	if outer.File != "" || outer.OutputDir != "" || inner.OutputDir != "" {
+		return false
+	}
+
+	outerOptions, innerOptions := outer, inner
+	outerOptions.Dir, innerOptions.Dir = "", ""
+	outerOptions.File, innerOptions.File = "", ""
+	innerOptions.Ext = outerOptions.Ext
+	if outerOptions != innerOptions {
+		return false
+	}
+
+	outerDir := absPath(templateRoot(outer))
+	if inner.File != "" {
+		return hasTemplateExt(filepath.Base(inner.File), templateExts(outer.Ext)) && withinDir(outerDir, absPath(inner.File))
+	}
+
+	innerDir := absPath(templateRoot(inner))
+	return coversExts(outer.Ext, inner.Ext) && outerDir != innerDir && withinDir(outerDir, innerDir)
+}
+
+// normalizeConfig returns config with absolute, cleaned paths, so that
+// configurations can be compared regardless of how paths were written.
+func normalizeConfig(config Config) Config {
+	if config.File != "" {
+		config.File = absPath(config.File)
+		config.Dir, config.Ext = "", ""
+	} else {
+		config.Dir = absPath(templateRoot(config))
+		config.Ext = strings.Join(templateExts(config.Ext), extSeparator)
+	}
+	if config.OutputDir != "" {
+		config.OutputDir = absPath(config.OutputDir)
+	}
+	return config
+}
+
+// absPath returns the absolute form of path, or path itself if it cannot
+// be resolved.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// withinDir reports whether path is dir or lies below it.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
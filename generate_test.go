@@ -0,0 +1,288 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// Generate test constants.
+	embeddedBackendArg = "-backend=embedded"
+	viewsDir           = "views"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected Config
+	}{
+		{
+			name:     "Defaults",
+			args:     nil,
+			expected: GetDefaultConfig(),
+		},
+		{
+			name: "AllFlags",
+			args: []string{
+				dirTemplatesArg, extQtplArg, "-skipLineComments=false", "-output=gen",
+				"-atomic", embeddedBackendArg, "-sourcemaps", "-check", "-cache=cache",
+				"-minQtcVersion=v1.7.0", "-maxQtcVersion=v1.8.0", "-matchModuleVersion", "-dryRun", "-retries=3", "-retryBackoff=1s",
+				"-qtc=bin/qtc",
+			},
+			expected: Config{
+				Dir:                templatesDir,
+				Ext:                qtplExt,
+				OutputDir:          genDir,
+				Atomic:             true,
+				Backend:            EmbeddedBackend,
+				SourceMaps:         true,
+				PostBuildCheck:     true,
+				CacheDir:           cacheDirName,
+				MinQtcVersion:      olderQtVersion,
+				MaxQtcVersion:      embeddedQtVersion,
+				MatchModuleVersion: true,
+				DryRun:             true,
+				Retries:            3,
+				RetryBackoff:       time.Second,
+				Qtc:                "bin/qtc",
+			},
+		},
+		{
+			name:     "FileMode",
+			args:     []string{"-file", testQtplFile},
+			expected: Config{Dir: ".", File: testQtplFile, SkipLineComments: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, config)
+			}
+		})
+	}
+
+	t.Run("UnknownFlag", func(t *testing.T) {
+		_, err := ParseArgs([]string{"-unknown"})
+		assertValidationError(t, err, "invalid arguments", true)
+	})
+
+	t.Run("PositionalArgument", func(t *testing.T) {
+		_, err := ParseArgs([]string{templatesDir})
+		assertValidationError(t, err, "unexpected arguments", true)
+	})
+
+	t.Run("Help", func(t *testing.T) {
+		if _, err := ParseArgs([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("Expected flag.ErrHelp, got %v", err)
+		}
+	})
+}
+
+func TestPrintFlags(t *testing.T) {
+	var buf bytes.Buffer
+	PrintFlags(&buf)
+	for _, name := range []string{"-dir", "-file", "-ext", "-skipLineComments", "-output", "-backend"} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("Expected usage to mention %s", name)
+		}
+	}
+}
+
+func TestParseGenerateLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+		ok       bool
+	}{
+		{"Binary", "//go:generate qtcwrap -dir=templates", []string{dirTemplatesArg}, true},
+		{"GoRun", "//go:generate go run github.com/valksor/go-qtcwrap/cmd/qtcwrap -file=a.qtpl", []string{"-file=a.qtpl"}, true},
+		{"GoRunVersion", "//go:generate go run github.com/valksor/go-qtcwrap/cmd/qtcwrap@v1.2.0 -dir=templates", []string{dirTemplatesArg}, true},
+		{"GoRunFlag", "//go:generate go run -mod=mod github.com/valksor/go-qtcwrap/cmd/qtcwrap -dir=templates", []string{dirTemplatesArg}, true},
+		{"GoRunSeparateFlagValue", "//go:generate go run -mod mod -tags dev github.com/valksor/go-qtcwrap/cmd/qtcwrap -dir=templates", []string{dirTemplatesArg}, true},
+		{"GoRunOtherPackage", "//go:generate go run -mod=mod golang.org/x/tools/cmd/stringer@v0.1.0 -type=Kind", nil, false},
+		{"QuotedArgument", `//go:generate qtcwrap "-dir=my templates"`, []string{"-dir=my templates"}, true},
+		{"OtherCommand", "//go:generate stringer -type=Kind", nil, false},
+		{"QtcDirectly", "//go:generate qtc -dir=templates", nil, false},
+		{"NotADirective", "// go:generate qtcwrap", nil, false},
+		{"NoSpace", "//go:generateqtcwrap", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, ok, err := parseGenerateLine(tt.line)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ok != tt.ok || strings.Join(args, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %v (%t), got %v (%t)", tt.expected, tt.ok, args, ok)
+			}
+		})
+	}
+
+	t.Run("UnterminatedQuote", func(t *testing.T) {
+		_, _, err := parseGenerateLine(`//go:generate qtcwrap "-dir=x`)
+		assertValidationError(t, err, "unterminated", true)
+	})
+}
+
+func TestParseMarkerLine(t *testing.T) {
+	args, ok, err := parseMarkerLine("  qtcwrap:generate -skipLineComments=false")
+	if err != nil || !ok || len(args) != 1 || args[0] != "-skipLineComments=false" {
+		t.Errorf("Unexpected marker parse result: %v %t %v", args, ok, err)
+	}
+
+	if _, ok, _ := parseMarkerLine("qtcwrap:generated by hand"); ok {
+		t.Error("Expected words starting with the marker not to match")
+	}
+}
+
+func TestSkippedDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"pkg", false},
+		{"views", false},
+		{"vendor", true},
+		{"testdata", true},
+		{"node_modules", true},
+		{".git", true},
+		{"_build", true},
+	}
+
+	for _, tt := range tests {
+		if got := skippedDir(tt.name); got != tt.expected {
+			t.Errorf("skippedDir(%q) = %t, expected %t", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestBatchConfigs(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	parent := Config{Dir: root, SkipLineComments: true}
+	child := Config{Dir: filepath.Join(root, viewsDir), SkipLineComments: true}
+	childFile := Config{File: filepath.Join(root, viewsDir, testQtplFile), SkipLineComments: true}
+	childOtherOptions := Config{Dir: filepath.Join(root, viewsDir), SkipLineComments: false}
+	otherExtFile := Config{File: filepath.Join(root, "a.template"), SkipLineComments: true}
+	outputConfig := Config{Dir: filepath.Join(root, viewsDir), OutputDir: filepath.Join(root, genDir), SkipLineComments: true}
+
+	configs := []Config{
+		parent,
+		child,
+		childFile,
+		childOtherOptions,
+		otherExtFile,
+		outputConfig,
+		{Dir: root + string(filepath.Separator), SkipLineComments: true},
+	}
+
+	batched := batchConfigs(configs)
+	expected := []Config{parent, childOtherOptions, otherExtFile, outputConfig}
+	if len(batched) != len(expected) {
+		t.Fatalf("Expected %d configs, got %d: %+v", len(expected), len(batched), batched)
+	}
+	for i := range expected {
+		if batched[i] != expected[i] {
+			t.Errorf("Expected config %d to be %+v, got %+v", i, expected[i], batched[i])
+		}
+	}
+}
+
+func TestScanDirectives(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, "main.go", "package main\n\n//go:generate qtcwrap -dir=views -backend=embedded\n")
+	writeTestTemplate(t, root, "vendor/x/x.go", "package x\n\n//go:generate qtcwrap -dir=.\n")
+	writeTestTemplate(t, root, "node_modules/x/x.qtpl", "qtcwrap:generate\n\n"+helloTemplate)
+	writeTestTemplate(t, root, ".git/hooks/x.go", "package hooks\n\n//go:generate qtcwrap -dir=.\n")
+	template := writeTestTemplate(t, root, "mail/welcome.qtpl", "qtcwrap:generate -backend=embedded\n\n"+helloTemplate)
+
+	directives, err := ScanDirectives(root)
+	if err != nil {
+		t.Fatalf("ScanDirectives failed: %v", err)
+	}
+	if len(directives) != 2 {
+		t.Fatalf("Expected 2 directives, got %+v", directives)
+	}
+
+	goDirective := directives[0]
+	if goDirective.Position.Line != 3 || goDirective.Config.Dir != filepath.Join(root, viewsDir) {
+		t.Errorf("Unexpected go:generate directive: %+v", goDirective)
+	}
+
+	marker := directives[1]
+	if marker.Position.File != template || marker.Config.File != template {
+		t.Errorf("Expected marker to compile its own template, got %+v", marker)
+	}
+	if marker.Config.Backend != EmbeddedBackend {
+		t.Errorf("Expected marker arguments to be applied, got %+v", marker.Config)
+	}
+}
+
+func TestScanDirectivesInvalidArguments(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, "main.go", "package main\n\n//go:generate qtcwrap -bogus\n")
+
+	_, err := ScanDirectives(root)
+	assertValidationError(t, err, "main.go:3", true)
+}
+
+func TestGenerate(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, "main.go", "package main\n\n//go:generate qtcwrap -dir=. -backend=embedded\n")
+	writeTestTemplate(t, root, "views/views.go", "package views\n\n//go:generate qtcwrap -backend=embedded\n")
+	writeTestTemplate(t, root, "views/page.qtpl", "qtcwrap:generate -backend=embedded\n\n"+helloTemplate)
+	writeTestTemplate(t, root, "mail/welcome.qtpl", helloTemplate)
+
+	report, err := Generate(root)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if len(report.Directives) != 3 {
+		t.Errorf("Expected 3 directives, got %d", len(report.Directives))
+	}
+	if len(report.Configs) != 1 || len(report.Results) != 1 {
+		t.Fatalf("Expected directives to be batched into one compilation, got %+v", report.Configs)
+	}
+
+	expectedPackages := []string{filepath.Join(root, "mail"), filepath.Join(root, viewsDir)}
+	if strings.Join(report.Packages, "|") != strings.Join(expectedPackages, "|") {
+		t.Errorf("Expected packages %v, got %v", expectedPackages, report.Packages)
+	}
+}
+
+func TestGenerateContinuesAfterFailure(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, "broken/broken.qtpl", "qtcwrap:generate -backend=embedded\n\n"+brokenTemplate)
+	writeTestTemplate(t, root, "views/page.qtpl", "qtcwrap:generate -backend=embedded\n\n"+helloTemplate)
+
+	report, err := Generate(root)
+	if err == nil {
+		t.Fatal("Expected error for broken template")
+	}
+	if len(report.Packages) != 1 || report.Packages[0] != filepath.Join(root, viewsDir) {
+		t.Errorf("Expected views to be regenerated despite the failure, got %v", report.Packages)
+	}
+}
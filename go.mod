@@ -1,3 +1,7 @@
 module github.com/valksor/go-qtcwrap
 
 go 1.24
+
+require github.com/valyala/quicktemplate v1.8.0
+
+require github.com/valyala/bytebufferpool v1.0.0 // indirect
@@ -0,0 +1,253 @@
+package qtcwrap
+
+import "strings"
+
+// OutputContext describes where in an HTML document a template writes a
+// value.
+type OutputContext string
+
+const (
+	// ContextText is HTML text between tags.
+	ContextText OutputContext = "text"
+
+	// ContextTag is the inside of an HTML tag outside attribute values,
+	// such as <div {%s= attrs %}>.
+	ContextTag OutputContext = "tag"
+
+	// ContextAttribute is a quoted attribute value.
+	ContextAttribute OutputContext = "attribute"
+
+	// ContextUnquotedAttribute is an unquoted attribute value, such as
+	// <a href={%s url %}>.
+	ContextUnquotedAttribute OutputContext = "unquoted attribute"
+
+	// ContextEventHandler is a quoted value of an event handler attribute,
+	// such as onclick, which browsers run as JavaScript.
+	ContextEventHandler OutputContext = "event handler"
+
+	// ContextScript is JavaScript code inside a <script> element.
+	ContextScript OutputContext = "script"
+
+	// ContextScriptString is a JavaScript string literal inside a <script>
+	// element.
+	ContextScriptString OutputContext = "script string"
+)
+
+// htmlContext follows the HTML written by a template func to tell the
+// context of each output tag and the text shown to users.
+//
+// It reads the template text linearly, the way a simple HTML tokenizer
+// would, and does not follow control flow: the context after an
+// if/else is the context at the end of its last branch.
+type htmlContext struct {
+	// context is the context of the next byte.
+	context OutputContext
+
+	// tag is the lower-case name of the current tag, with a leading slash
+	// for end tags.
+	tag string
+
+	// attr is the lower-case name of the last attribute of the tag.
+	attr string
+
+	// afterEq reports whether an attribute value is expected.
+	afterEq bool
+
+	// quote is the closing quote of the attribute value or script string.
+	quote byte
+
+	// comment is the end marker of the HTML comment, script comment or
+	// style element being skipped, if any.
+	comment string
+}
+
+// newHTMLContext returns the context at the start of a template func.
+func newHTMLContext() *htmlContext {
+	return &htmlContext{context: ContextText}
+}
+
+// output returns the context of a value written at the current position
+// and moves past it. A value written right after "=" in a tag starts an
+// unquoted attribute value.
+func (c *htmlContext) output() OutputContext {
+	if c.context == ContextTag && c.afterEq {
+		c.context = ContextUnquotedAttribute
+		c.afterEq = false
+	}
+	return c.context
+}
+
+// translatableAttrs lists the attributes whose values are shown to users.
+var translatableAttrs = map[string]bool{
+	"alt":         true,
+	"aria-label":  true,
+	"label":       true,
+	"placeholder": true,
+	"title":       true,
+}
+
+// htmlText is a run of HTML text, or of the value of a translatable
+// attribute, read by htmlContext.advance.
+type htmlText struct {
+	// offset is the byte offset of the run in the advanced text.
+	offset int
+
+	// text is the run as written in the template.
+	text string
+}
+
+// advance moves past template text and returns its runs of HTML text and
+// translatable attribute values. Markup, comments, scripts and styles are
+// not part of any run.
+func (c *htmlContext) advance(text string) []htmlText {
+	var runs []htmlText
+	runStart := -1
+	flush := func(end int) {
+		if runStart >= 0 && end > runStart {
+			runs = append(runs, htmlText{offset: runStart, text: text[runStart:end]})
+		}
+		runStart = -1
+	}
+
+	for i := 0; i < len(text); i++ {
+		if c.comment != "" {
+			if hasPrefixFold(text[i:], c.comment) {
+				i += len(c.comment) - 1
+				c.comment = ""
+			}
+			continue
+		}
+
+		ch := text[i]
+		switch c.context {
+		case ContextText:
+			if strings.HasPrefix(text[i:], "<!--") {
+				flush(i)
+				c.comment = "-->"
+				i += len("<!--") - 1
+			} else if name := htmlTagName(text[i:]); name != "" {
+				flush(i)
+				c.startTag(name)
+				i += len(name)
+			} else if runStart < 0 {
+				runStart = i
+			}
+		case ContextTag:
+			switch {
+			case ch == '>':
+				c.context = ContextText
+				switch c.tag {
+				case "script":
+					c.context = ContextScript
+				case "style":
+					c.comment = "</style>"
+				}
+			case ch == '=':
+				c.afterEq = true
+			case ch == '"' || ch == '\'':
+				if c.afterEq {
+					c.context = ContextAttribute
+					if strings.HasPrefix(c.attr, "on") {
+						c.context = ContextEventHandler
+					}
+					c.quote = ch
+					c.afterEq = false
+				}
+			case isHTMLSpace(ch) || ch == '/':
+			case c.afterEq:
+				c.context = ContextUnquotedAttribute
+				c.afterEq = false
+			default:
+				j := i
+				for j < len(text) && !isHTMLSpace(text[j]) && !strings.ContainsRune("=>/\"'", rune(text[j])) {
+					j++
+				}
+				c.attr = strings.ToLower(text[i:j])
+				i = j - 1
+			}
+		case ContextAttribute, ContextEventHandler:
+			if ch == c.quote {
+				flush(i)
+				c.context = ContextTag
+			} else if c.context == ContextAttribute && translatableAttrs[c.attr] && runStart < 0 {
+				runStart = i
+			}
+		case ContextUnquotedAttribute:
+			if isHTMLSpace(ch) || ch == '>' {
+				c.context = ContextTag
+				i--
+			}
+		case ContextScript:
+			switch {
+			case hasPrefixFold(text[i:], "</script"):
+				c.startTag("/script")
+				i += len("</script") - 1
+			case ch == '"' || ch == '\'' || ch == '`':
+				c.context = ContextScriptString
+				c.quote = ch
+			case strings.HasPrefix(text[i:], "//"):
+				c.comment = "\n"
+				i++
+			case strings.HasPrefix(text[i:], "/*"):
+				c.comment = "*/"
+				i++
+			}
+		case ContextScriptString:
+			switch {
+			case ch == '\\':
+				i++
+			case ch == c.quote:
+				c.context = ContextScript
+			case hasPrefixFold(text[i:], "</script"):
+				c.startTag("/script")
+				i += len("</script") - 1
+			}
+		}
+	}
+	flush(len(text))
+	return runs
+}
+
+// startTag enters the tag with the given name.
+func (c *htmlContext) startTag(name string) {
+	c.context = ContextTag
+	c.tag = strings.ToLower(name)
+	c.attr = ""
+	c.afterEq = false
+}
+
+// htmlTagName returns the name of the start or end tag at the beginning of
+// s, such as "div" for "<div>" and "/div" for "</div>", or an empty string
+// if s does not start with a tag.
+func htmlTagName(s string) string {
+	if len(s) < 2 || s[0] != '<' {
+		return ""
+	}
+	start := 1
+	if s[1] == '/' {
+		start = 2
+	}
+	end := start
+	for end < len(s) && (isASCIILetter(s[end]) || (end > start && s[end] >= '0' && s[end] <= '9')) {
+		end++
+	}
+	if end == start {
+		return ""
+	}
+	return s[1:end]
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring ASCII case.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// isASCIILetter reports whether ch is an ASCII letter.
+func isASCIILetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// isHTMLSpace reports whether ch is HTML whitespace.
+func isHTMLSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f'
+}
@@ -0,0 +1,87 @@
+package qtcwrap
+
+import "testing"
+
+func TestHTMLContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected OutputContext
+	}{
+		{"Text", "<p>Hello, ", ContextText},
+		{"AfterTag", "<div class=\"a\">", ContextText},
+		{"Tag", "<div ", ContextTag},
+		{"QuotedAttribute", `<a href="/x?q=`, ContextAttribute},
+		{"SingleQuotedAttribute", `<a title='`, ContextAttribute},
+		{"UnquotedAttribute", `<a href=`, ContextUnquotedAttribute},
+		{"UnquotedAttributeWithSpace", `<a href = `, ContextUnquotedAttribute},
+		{"AfterAttribute", `<a href="x" `, ContextTag},
+		{"EventHandler", `<button onClick="go(`, ContextEventHandler},
+		{"Script", "<script>var x = ", ContextScript},
+		{"ScriptWithAttributes", `<script type="module">var x = `, ContextScript},
+		{"ScriptString", `<script>var x = "a\"`, ContextScriptString},
+		{"TemplateLiteral", "<script>var x = `", ContextScriptString},
+		{"AfterScriptString", `<script>var x = "a"; var y = `, ContextScript},
+		{"ScriptComment", "<script>// don't\nvar x = ", ContextScript},
+		{"ScriptBlockComment", "<script>/* it's */ var x = ", ContextScript},
+		{"AfterScript", "<SCRIPT>var x = 1;</Script><p>", ContextText},
+		{"HTMLComment", "<!-- <script> -->", ContextText},
+		{"LessThan", "a < b and ", ContextText},
+		{"SelfClosing", "<br/>", ContextText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html := newHTMLContext()
+			html.advance(tt.text)
+			if context := html.output(); context != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, context)
+			}
+		})
+	}
+}
+
+func TestHTMLContextAcrossOutputs(t *testing.T) {
+	html := newHTMLContext()
+	html.advance("<a href=")
+	if context := html.output(); context != ContextUnquotedAttribute {
+		t.Fatalf("Expected %q, got %q", ContextUnquotedAttribute, context)
+	}
+	html.advance(" title=\"")
+	if context := html.output(); context != ContextAttribute {
+		t.Fatalf("Expected %q, got %q", ContextAttribute, context)
+	}
+	html.advance("\">")
+	if context := html.output(); context != ContextText {
+		t.Errorf("Expected %q, got %q", ContextText, context)
+	}
+}
+
+func TestHTMLContextText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []htmlText
+	}{
+		{"Text", "<p>Hello</p>", []htmlText{{offset: 3, text: "Hello"}}},
+		{"TranslatableAttribute", `<img alt="A cat" src="cat.png">`, []htmlText{{offset: 10, text: "A cat"}}},
+		{"OtherAttribute", `<a href="/home">`, nil},
+		{"Script", `<script>var s = "no";</script>`, nil},
+		{"Style", "<style>p { color: red }</STYLE>Hi", []htmlText{{offset: 31, text: "Hi"}}},
+		{"Comment", "<!-- note -->Hi", []htmlText{{offset: 13, text: "Hi"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := newHTMLContext().advance(tt.text)
+			if len(runs) != len(tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, runs)
+			}
+			for i := range runs {
+				if runs[i] != tt.expected[i] {
+					t.Errorf("Expected %+v, got %+v", tt.expected[i], runs[i])
+				}
+			}
+		})
+	}
+}
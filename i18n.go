@@ -0,0 +1,292 @@
+package qtcwrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultTranslationFunc is the translation func ExtractMessages looks for
+// when none is given.
+const DefaultTranslationFunc = "T"
+
+// Message is a translatable string found in templates.
+type Message struct {
+	// ID is the message, used as the gettext msgid.
+	ID string `json:"id"`
+
+	// References lists the calls of translation funcs with the message.
+	References []Position `json:"references,omitempty"`
+
+	// Unwrapped lists the places the message is written as literal
+	// template text or attribute value instead of being wrapped in a
+	// translation func call.
+	Unwrapped []Position `json:"unwrapped,omitempty"`
+}
+
+// Catalog holds the messages extracted from templates.
+type Catalog struct {
+	// Messages lists the messages in order of first appearance.
+	Messages []Message `json:"messages"`
+}
+
+// ExtractMessages extracts the user-facing strings of the templates
+// selected by config.
+//
+// String literals passed as the first argument to one of funcs, such as
+// T("Sign in") or i18n.T("Sign in"), become messages with references. A
+// name without a package, such as "T", also matches qualified calls and
+// methods, such as i18n.T("Sign in") and p.T("Sign in"), while "i18n.T"
+// only matches i18n.T. Without funcs, DefaultTranslationFunc is used. Calls
+// are found in output tags as well as in for, if, switch, case and code
+// tags.
+//
+// Literal text of template funcs, and the values of the alt, aria-label,
+// label, placeholder and title attributes, become messages with Unwrapped
+// positions, since they are shown to users without translation. Markup,
+// scripts, styles and comments are skipped, whitespace is collapsed and
+// text without letters is ignored. Text is split at template tags, so
+// "Hello, {%s name %}!" yields "Hello,".
+//
+// Example:
+//
+//	catalog, err := ExtractMessages(Config{Dir: "templates"}, "T")
+//	if err != nil {
+//	    fmt.Printf("Cannot extract messages: %v\n", err)
+//	    return
+//	}
+//	f, _ := os.Create("messages.pot")
+//	defer f.Close()
+//	_ = catalog.WritePOT(f)
+//	for _, diagnostic := range catalog.Diagnostics() {
+//	    fmt.Println(diagnostic)
+//	}
+func ExtractMessages(config Config, funcs ...string) (*Catalog, error) {
+	if len(funcs) == 0 {
+		funcs = []string{DefaultTranslationFunc}
+	}
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	extractor := &messageExtractor{funcs: funcs, index: make(map[string]int)}
+	for _, template := range templates {
+		src, err := os.ReadFile(template) // #nosec G304 -- templates are selected by the caller's configuration
+		if err != nil {
+			return nil, fmt.Errorf("cannot read template %s: %w", template, err)
+		}
+		tags, err := scanTags(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan template %s: %w", template, err)
+		}
+		extractor.extract(filepath.ToSlash(template), tags)
+	}
+	return &Catalog{Messages: extractor.messages}, nil
+}
+
+// messageExtractor collects the messages of templates.
+type messageExtractor struct {
+	// funcs lists the names of the translation funcs.
+	funcs []string
+
+	// messages holds the messages in order of first appearance.
+	messages []Message
+
+	// index maps message IDs to their index in messages.
+	index map[string]int
+}
+
+// extract collects the messages of the tags of a template.
+func (e *messageExtractor) extract(template string, tags []templateTag) {
+	var context *htmlContext
+	for _, tag := range tags {
+		switch {
+		case tag.name == "func":
+			context = newHTMLContext()
+			continue
+		case tag.name == "endfunc":
+			if context != nil {
+				e.addText(template, tag, context)
+			}
+			context = nil
+			continue
+		case context == nil:
+			continue
+		}
+
+		e.addText(template, tag, context)
+		if _, ok := tagEscaping[tag.name]; ok {
+			context.output()
+		}
+		e.addCalls(template, tag)
+	}
+}
+
+// addText adds the text preceding a tag as unwrapped messages.
+func (e *messageExtractor) addText(template string, tag templateTag, context *htmlContext) {
+	startLine := tag.line - strings.Count(tag.text, "\n")
+	for _, run := range context.advance(tag.text) {
+		id := strings.Join(strings.Fields(html.UnescapeString(run.text)), " ")
+		if !strings.ContainsFunc(id, unicode.IsLetter) {
+			continue
+		}
+		leading := len(run.text) - len(strings.TrimLeftFunc(run.text, unicode.IsSpace))
+		line := startLine + strings.Count(tag.text[:run.offset+leading], "\n")
+		message := e.message(id)
+		message.Unwrapped = append(message.Unwrapped, Position{File: template, Line: line})
+	}
+}
+
+// addCalls adds the string literals passed to translation funcs in the Go
+// code of a tag.
+func (e *messageExtractor) addCalls(template string, tag templateTag) {
+	fset := token.NewFileSet()
+	code := parseTagCode(fset, tag)
+	if code == nil {
+		return
+	}
+
+	ast.Inspect(code, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 || !e.isTranslationFunc(call.Fun) {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		id, err := strconv.Unquote(lit.Value)
+		if err != nil || id == "" {
+			return true
+		}
+		line := tag.line + fset.Position(call.Pos()).Line - 1
+		message := e.message(id)
+		message.References = append(message.References, Position{File: template, Line: line})
+		return true
+	})
+}
+
+// isTranslationFunc reports whether the called expression is one of the
+// translation funcs.
+func (e *messageExtractor) isTranslationFunc(fun ast.Expr) bool {
+	for _, name := range e.funcs {
+		pkg, fn, qualified := strings.Cut(name, ".")
+		switch f := fun.(type) {
+		case *ast.Ident:
+			if !qualified && f.Name == name {
+				return true
+			}
+		case *ast.SelectorExpr:
+			if !qualified && f.Sel.Name == name {
+				return true
+			}
+			if x, ok := f.X.(*ast.Ident); ok && qualified && x.Name == pkg && f.Sel.Name == fn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// message returns the message with the given ID, adding it if needed.
+func (e *messageExtractor) message(id string) *Message {
+	i, ok := e.index[id]
+	if !ok {
+		i = len(e.messages)
+		e.index[id] = i
+		e.messages = append(e.messages, Message{ID: id})
+	}
+	return &e.messages[i]
+}
+
+// Diagnostics returns a RuleUntranslated warning for every place text is
+// written without being wrapped for translation, ordered by file and line,
+// so the places can be written as SARIF or JUnit with Report.
+func (c *Catalog) Diagnostics() []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, message := range c.Messages {
+		for _, position := range message.Unwrapped {
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     position.File,
+				Line:     position.Line,
+				Rule:     RuleUntranslated,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("text %q is not wrapped for translation", message.ID),
+			})
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return diagnostics
+}
+
+// WritePOT writes the catalog as a gettext template (.pot) with "#:"
+// references to template lines. Messages that are not wrapped for
+// translation everywhere carry an extracted comment listing where they are
+// written as literal text.
+func (c *Catalog) WritePOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Messages extracted from templates by qtcwrap.\n")
+	b.WriteString("msgid \"\"\n")
+	b.WriteString("msgstr \"\"\n")
+	b.WriteString("\"MIME-Version: 1.0\\n\"\n")
+	b.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	b.WriteString("\"Content-Transfer-Encoding: 8bit\\n\"\n")
+
+	for _, message := range c.Messages {
+		b.WriteString("\n")
+		if len(message.Unwrapped) > 0 {
+			b.WriteString("#. not wrapped for translation:" + poReferences(message.Unwrapped) + "\n")
+		}
+		b.WriteString("#:" + poReferences(append(append([]Position(nil), message.References...), message.Unwrapped...)) + "\n")
+		b.WriteString("msgid " + poQuote(message.ID) + "\n")
+		b.WriteString("msgstr \"\"\n")
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("cannot write catalog: %w", err)
+	}
+	return nil
+}
+
+// WriteJSON writes the catalog, with references, as an indented JSON
+// document.
+func (c *Catalog) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return fmt.Errorf("cannot write catalog: %w", err)
+	}
+	return nil
+}
+
+// poReferences formats positions as space-separated "file:line"
+// references, each preceded by a space.
+func poReferences(positions []Position) string {
+	var b strings.Builder
+	for _, position := range positions {
+		b.WriteString(" " + position.String())
+	}
+	return b.String()
+}
+
+// poQuote quotes a string for a PO file.
+func poQuote(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(s) + `"`
+}
@@ -0,0 +1,191 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// i18nTemplate is a template with wrapped and unwrapped strings.
+const i18nTemplate = `Text outside funcs is not shown.
+
+{% func Login(p *Page) %}
+<h1>{%s T("Sign in") %}</h1>
+<p>
+	Welcome   back!
+	{%s p.Name %}
+</p>
+<input placeholder="Email &amp; name" title="{%s p.T("Your email") %}">
+<script>var s = "not text";</script>
+{% if p.Error != "" %}{%s i18n.T("Error: %s", p.Error) %}{% endif %}
+{% code label := tr(
+	"Multi\nline") %}
+{% comment %}Commented out{% endcomment %}
+<b>42</b> {%s T(p.Dynamic) %}
+{% endfunc %}
+
+{% func Footer() %}{%s T("Sign in") %} Welcome back!{% endfunc %}
+`
+
+func TestExtractMessages(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplate(t, dir, "login.qtpl", i18nTemplate)
+	template := filepath.ToSlash(filepath.Join(dir, "login.qtpl"))
+
+	catalog, err := ExtractMessages(Config{Dir: dir}, "T", "i18n.T")
+	if err != nil {
+		t.Fatalf("ExtractMessages failed: %v", err)
+	}
+
+	expected := []struct {
+		id         string
+		references []int
+		unwrapped  []int
+	}{
+		{"Sign in", []int{4, 18}, nil},
+		{"Welcome back!", nil, []int{6, 18}},
+		{"Email & name", nil, []int{9}},
+		{"Your email", []int{9}, nil},
+		{"Error: %s", []int{11}, nil},
+	}
+	if len(catalog.Messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %+v", len(expected), catalog.Messages)
+	}
+	for i, want := range expected {
+		message := catalog.Messages[i]
+		if message.ID != want.id {
+			t.Errorf("Message %d: expected %q, got %q", i, want.id, message.ID)
+		}
+		if !equalLines(message.References, template, want.references) {
+			t.Errorf("%q: expected references %v, got %v", want.id, want.references, message.References)
+		}
+		if !equalLines(message.Unwrapped, template, want.unwrapped) {
+			t.Errorf("%q: expected unwrapped %v, got %v", want.id, want.unwrapped, message.Unwrapped)
+		}
+	}
+}
+
+// equalLines reports whether the positions are the given lines of file.
+func equalLines(positions []Position, file string, lines []int) bool {
+	if len(positions) != len(lines) {
+		return false
+	}
+	for i, position := range positions {
+		if position.File != file || position.Line != lines[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExtractMessagesFuncs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplate(t, dir, "login.qtpl", i18nTemplate)
+
+	tests := []struct {
+		name     string
+		funcs    []string
+		expected []string
+	}{
+		{"Default", nil, []string{"Sign in", "Your email", "Error: %s"}},
+		{"Custom", []string{"tr"}, []string{"Multi\nline"}},
+		{"Qualified", []string{"i18n.T"}, []string{"Error: %s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog, err := ExtractMessages(Config{Dir: dir}, tt.funcs...)
+			if err != nil {
+				t.Fatalf("ExtractMessages failed: %v", err)
+			}
+			var ids []string
+			for _, message := range catalog.Messages {
+				if len(message.References) > 0 {
+					ids = append(ids, message.ID)
+				}
+			}
+			if strings.Join(ids, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %q, got %q", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestCatalogDiagnostics(t *testing.T) {
+	catalog := &Catalog{Messages: []Message{
+		{ID: "Hello", Unwrapped: []Position{{File: "b.qtpl", Line: 2}}},
+		{ID: "Sign in", References: []Position{{File: "a.qtpl", Line: 1}}},
+		{ID: "Bye", Unwrapped: []Position{{File: "a.qtpl", Line: 9}}},
+	}}
+
+	diagnostics := catalog.Diagnostics()
+	expected := []string{
+		`a.qtpl:9: text "Bye" is not wrapped for translation`,
+		`b.qtpl:2: text "Hello" is not wrapped for translation`,
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, diagnostics)
+	}
+	for i, diagnostic := range diagnostics {
+		if diagnostic.String() != expected[i] || diagnostic.Rule != RuleUntranslated || diagnostic.Severity != SeverityWarning {
+			t.Errorf("Expected %q, got %+v", expected[i], diagnostic)
+		}
+	}
+}
+
+func TestCatalogWritePOT(t *testing.T) {
+	catalog := &Catalog{Messages: []Message{
+		{ID: "Sign in", References: []Position{{File: "a.qtpl", Line: 1}, {File: "b.qtpl", Line: 4}}},
+		{ID: "Say \"hi\"\nnow", References: []Position{{File: "a.qtpl", Line: 3}}, Unwrapped: []Position{{File: "c.qtpl", Line: 7}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := catalog.WritePOT(&buf); err != nil {
+		t.Fatalf("WritePOT failed: %v", err)
+	}
+
+	expected := []string{
+		"msgid \"\"\nmsgstr \"\"\n\"MIME-Version: 1.0\\n\"\n",
+		"\n#: a.qtpl:1 b.qtpl:4\nmsgid \"Sign in\"\nmsgstr \"\"\n",
+		"\n#. not wrapped for translation: c.qtpl:7\n#: a.qtpl:3 c.qtpl:7\nmsgid \"Say \\\"hi\\\"\\nnow\"\nmsgstr \"\"\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected the catalog to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestCatalogWriteJSON(t *testing.T) {
+	catalog := &Catalog{Messages: []Message{{ID: "Sign in", References: []Position{{File: "a.qtpl", Line: 1}}}}}
+
+	var buf bytes.Buffer
+	if err := catalog.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded Catalog
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(decoded.Messages) != 1 || decoded.Messages[0].ID != "Sign in" || decoded.Messages[0].References[0] != (Position{File: "a.qtpl", Line: 1}) {
+		t.Errorf("Unexpected catalog %+v", decoded)
+	}
+	if strings.Contains(buf.String(), "unwrapped") {
+		t.Errorf("Expected empty positions to be omitted, got %s", buf.String())
+	}
+}
+
+func TestExtractMessagesErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := ExtractMessages(Config{Dir: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+
+	writeTestTemplate(t, dir, "broken.qtpl", "{% func A() %}{% comment %}")
+	if _, err := ExtractMessages(Config{Dir: dir}); err == nil || !strings.Contains(err.Error(), "missing endcomment tag") {
+		t.Errorf("Expected a missing tag error, got %v", err)
+	}
+}
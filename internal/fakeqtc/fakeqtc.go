@@ -0,0 +1,189 @@
+// Package fakeqtc builds a scriptable stand-in for the qtc compiler.
+//
+// The fake is a small Go program compiled at test time. It records every
+// invocation, writes scripted output, exits with a scripted code and can
+// write generated files for the templates selected by its arguments, so
+// code running qtc can be tested without installing it and independently
+// of the installed version.
+//
+// The package is internal so that the tests of qtcwrap itself can use it;
+// it is exported to other modules through the qtcwraptest package.
+package fakeqtc
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const (
+	// scriptFile is the name of the script file next to the fake binary.
+	scriptFile = "fakeqtc.json"
+
+	// callsFile is the name of the invocation log next to the fake binary.
+	callsFile = "fakeqtc-calls.jsonl"
+)
+
+// Script describes how the fake qtc behaves when it is run.
+type Script struct {
+	// Stdout and Stderr are written to the corresponding streams.
+	Stdout string
+	Stderr string
+
+	// ExitCode is the exit status of every invocation.
+	ExitCode int
+
+	// Version is printed for "qtc -version". If empty, -version is rejected
+	// as an unknown flag, like the real qtc does.
+	Version string
+
+	// Generate enables writing a generated file next to every template
+	// selected by the -dir, -ext and -file arguments, as qtc does. The
+	// file holds GeneratedCode, or a minimal generated Go file declaring
+	// the package named after the template directory if it is empty.
+	Generate      bool
+	GeneratedCode string
+
+	// Files maps paths, relative to the working directory of the fake, to
+	// contents written on every invocation.
+	Files map[string]string
+
+	// First holds the scripts of the first invocations, in order, such as
+	// failures before a successful run. Later invocations follow the
+	// script itself. Calls recorded before SetScript count as invocations.
+	First []Script
+}
+
+// Call records an invocation of the fake qtc.
+type Call struct {
+	// Args holds the command-line arguments, without program name.
+	Args []string
+
+	// Dir is the working directory of the invocation.
+	Dir string
+}
+
+// Fake is a built fake qtc executable.
+type Fake struct {
+	// Dir is the directory holding the executable, its script and its
+	// invocation log.
+	Dir string
+
+	// Path is the path of the executable.
+	Path string
+}
+
+// Build compiles a fake qtc executable into a temporary directory and
+// configures it with script. The test is skipped if the go command is not
+// available and fails if the fake cannot be built.
+//
+// Example:
+//
+//	fake := fakeqtc.Build(t, fakeqtc.Script{Generate: true})
+//	fake.Install(t)
+func Build(t testing.TB, script Script) *Fake {
+	t.Helper()
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available to build the fake qtc")
+	}
+
+	dir := t.TempDir()
+	srcDir := filepath.Join(dir, "src")
+	if err := os.MkdirAll(srcDir, 0o750); err != nil {
+		t.Fatalf("Failed to create fake qtc source directory: %v", err)
+	}
+	sources := map[string]string{
+		"go.mod":  "module fakeqtc\n\ngo 1.24\n",
+		"main.go": mainSource,
+	}
+	for name, content := range sources {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write fake qtc source: %v", err)
+		}
+	}
+
+	name := "qtc"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	fake := &Fake{Dir: filepath.Join(dir, "bin"), Path: filepath.Join(dir, "bin", name)}
+
+	// #nosec G204 -- builds the fixed fake qtc source written above
+	cmd := exec.Command(goTool, "build", "-o", fake.Path, ".")
+	cmd.Dir = srcDir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build fake qtc: %v\n%s", err, output)
+	}
+
+	fake.SetScript(t, script)
+	return fake
+}
+
+// SetScript replaces the script of the fake. It applies to all later
+// invocations.
+func (f *Fake) SetScript(t testing.TB, script Script) {
+	t.Helper()
+
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatalf("Failed to encode fake qtc script: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(f.Dir, scriptFile), data, 0o600); err != nil {
+		t.Fatalf("Failed to write fake qtc script: %v", err)
+	}
+}
+
+// Install puts the fake first in PATH for the rest of the test, so it is
+// run instead of any installed qtc. Like t.Setenv, it cannot be used in
+// parallel tests.
+func (f *Fake) Install(t testing.TB) {
+	t.Helper()
+	t.Setenv("PATH", f.Dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// Calls returns the invocations of the fake in the order they happened.
+func (f *Fake) Calls(t testing.TB) []Call {
+	t.Helper()
+
+	file, err := os.Open(filepath.Join(f.Dir, callsFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Failed to read fake qtc calls: %v", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var calls []Call
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var call Call
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			t.Fatalf("Failed to decode fake qtc call: %v", err)
+		}
+		calls = append(calls, call)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read fake qtc calls: %v", err)
+	}
+	return calls
+}
+
+// Reset forgets the recorded invocations.
+func (f *Fake) Reset(t testing.TB) {
+	t.Helper()
+
+	if err := os.Remove(filepath.Join(f.Dir, callsFile)); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to reset fake qtc calls: %v", err)
+	}
+}
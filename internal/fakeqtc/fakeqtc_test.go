@@ -0,0 +1,151 @@
+package fakeqtc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// run runs the fake in dir and returns its output and exit code.
+func run(t *testing.T, fake *Fake, dir string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+
+	cmd := exec.Command(fake.Path, args...)
+	cmd.Dir = dir
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("Failed to run fake qtc: %v", err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+func TestBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+
+	fake := Build(t, Script{Stdout: "out\n", Stderr: "err\n", ExitCode: 4})
+	dir := t.TempDir()
+
+	t.Run("ScriptedOutput", func(t *testing.T) {
+		stdout, stderr, code := run(t, fake, dir, "-dir=templates", "-skipLineComments")
+		if stdout != "out\n" || stderr != "err\n" || code != 4 {
+			t.Errorf("Expected scripted output, got stdout %q, stderr %q, code %d", stdout, stderr, code)
+		}
+	})
+
+	t.Run("Calls", func(t *testing.T) {
+		calls := fake.Calls(t)
+		if len(calls) != 1 {
+			t.Fatalf("Expected 1 call, got %d", len(calls))
+		}
+		if !reflect.DeepEqual(calls[0].Args, []string{"-dir=templates", "-skipLineComments"}) {
+			t.Errorf("Expected recorded arguments, got %v", calls[0].Args)
+		}
+		if resolved, _ := filepath.EvalSymlinks(calls[0].Dir); resolved != mustEvalSymlinks(t, dir) {
+			t.Errorf("Expected working directory %s, got %s", dir, calls[0].Dir)
+		}
+
+		fake.Reset(t)
+		if calls := fake.Calls(t); len(calls) != 0 {
+			t.Errorf("Expected no calls after Reset, got %v", calls)
+		}
+	})
+
+	t.Run("Version", func(t *testing.T) {
+		fake.SetScript(t, Script{})
+		if _, stderr, code := run(t, fake, dir, "-version"); code != 2 || !strings.Contains(stderr, "-version") {
+			t.Errorf("Expected -version to be rejected, got code %d, stderr %q", code, stderr)
+		}
+
+		fake.SetScript(t, Script{Version: "v1.8.0"})
+		if stdout, _, code := run(t, fake, dir, "-version"); code != 0 || stdout != "v1.8.0\n" {
+			t.Errorf("Expected scripted version, got code %d, stdout %q", code, stdout)
+		}
+	})
+
+	t.Run("Generate", func(t *testing.T) {
+		views := filepath.Join(dir, "views")
+		for _, name := range []string{"a.qtpl", "sub/b.qtpl", "c.html"} {
+			writeFile(t, filepath.Join(views, name), "")
+		}
+		fake.SetScript(t, Script{Generate: true, Files: map[string]string{"extra/out.txt": "extra"}})
+
+		if _, stderr, code := run(t, fake, dir, "-dir=views"); code != 0 {
+			t.Fatalf("Expected success, got code %d: %s", code, stderr)
+		}
+
+		code, err := os.ReadFile(filepath.Join(views, "a.qtpl.go"))
+		if err != nil || !strings.Contains(string(code), "package views\n") {
+			t.Errorf("Expected generated file declaring package views, got %q, %v", code, err)
+		}
+		if _, err := os.Stat(filepath.Join(views, "sub", "b.qtpl.go")); err != nil {
+			t.Errorf("Expected generated file in subdirectory: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(views, "c.html.go")); !os.IsNotExist(err) {
+			t.Errorf("Expected other extensions to be ignored, got %v", err)
+		}
+		if extra, err := os.ReadFile(filepath.Join(dir, "extra", "out.txt")); err != nil || string(extra) != "extra" {
+			t.Errorf("Expected scripted file, got %q, %v", extra, err)
+		}
+
+		fake.SetScript(t, Script{Generate: true, GeneratedCode: "package custom\n"})
+		if _, stderr, code := run(t, fake, dir, "-file=views/c.html"); code != 0 {
+			t.Fatalf("Expected success, got code %d: %s", code, stderr)
+		}
+		if code, err := os.ReadFile(filepath.Join(views, "c.html.go")); err != nil || string(code) != "package custom\n" {
+			t.Errorf("Expected scripted generated code, got %q, %v", code, err)
+		}
+	})
+
+	t.Run("First", func(t *testing.T) {
+		fake.Reset(t)
+		fake.SetScript(t, Script{Stdout: "later\n", First: []Script{{Stderr: "first\n", ExitCode: 1}}})
+
+		if _, stderr, code := run(t, fake, dir); code != 1 || stderr != "first\n" {
+			t.Errorf("Expected first script, got code %d, stderr %q", code, stderr)
+		}
+		if stdout, _, code := run(t, fake, dir); code != 0 || stdout != "later\n" {
+			t.Errorf("Expected later script, got code %d, stdout %q", code, stdout)
+		}
+	})
+
+	t.Run("Install", func(t *testing.T) {
+		fake.Install(t)
+		path, err := exec.LookPath("qtc")
+		if err != nil || path != fake.Path {
+			t.Errorf("Expected qtc to resolve to %s, got %s, %v", fake.Path, path, err)
+		}
+	})
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func mustEvalSymlinks(t *testing.T, path string) string {
+	t.Helper()
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %v", path, err)
+	}
+	return resolved
+}
@@ -0,0 +1,158 @@
+package fakeqtc
+
+// mainSource is the program built by Build. It only uses the standard
+// library, so it builds without network access.
+const mainSource = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type script struct {
+	Stdout        string
+	Stderr        string
+	ExitCode      int
+	Version       string
+	Generate      bool
+	GeneratedCode string
+	Files         map[string]string
+	First         []script
+}
+
+type call struct {
+	Args []string
+	Dir  string
+}
+
+func main() {
+	exe, err := os.Executable()
+	if err != nil {
+		fail(err)
+	}
+	dir := filepath.Dir(exe)
+
+	var s script
+	data, err := os.ReadFile(filepath.Join(dir, "` + scriptFile + `"))
+	if err != nil {
+		fail(err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		fail(err)
+	}
+
+	if n := record(filepath.Join(dir, "` + callsFile + `")); n <= len(s.First) {
+		s = s.First[n-1]
+	}
+
+	args := os.Args[1:]
+	if len(args) == 1 && (args[0] == "-version" || args[0] == "--version") {
+		if s.Version == "" {
+			fmt.Fprintln(os.Stderr, "flag provided but not defined: -version")
+			os.Exit(2)
+		}
+		fmt.Println(s.Version)
+		os.Exit(0)
+	}
+
+	if s.Generate {
+		generate(args, s.GeneratedCode)
+	}
+	for name, content := range s.Files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+			fail(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			fail(err)
+		}
+	}
+
+	fmt.Fprint(os.Stdout, s.Stdout)
+	fmt.Fprint(os.Stderr, s.Stderr)
+	os.Exit(s.ExitCode)
+}
+
+// record appends the invocation to the log at path and returns the number
+// of recorded invocations.
+func record(path string) int {
+	wd, _ := os.Getwd()
+	line, err := json.Marshal(call{Args: os.Args[1:], Dir: wd})
+	if err != nil {
+		fail(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		fail(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func generate(args []string, code string) {
+	dir, ext, file := ".", "qtpl", ""
+	for _, arg := range args {
+		name, value, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch name {
+		case "dir":
+			dir = value
+		case "ext":
+			ext = value
+		case "file":
+			file = value
+		}
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	var templates []string
+	if file != "" {
+		templates = append(templates, file)
+	} else {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ext) {
+				templates = append(templates, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	for _, template := range templates {
+		content := code
+		if content == "" {
+			abs, err := filepath.Abs(template)
+			if err != nil {
+				fail(err)
+			}
+			pkg := filepath.Base(filepath.Dir(abs))
+			content = "// Code generated by qtc from " + fmt.Sprintf("%q", filepath.Base(template)) + ". DO NOT EDIT.\n\npackage " + pkg + "\n"
+		}
+		if err := os.WriteFile(template+".go", []byte(content), 0o600); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "fake qtc: %v\n", err)
+	os.Exit(3)
+}
+`
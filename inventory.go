@@ -0,0 +1,172 @@
+package qtcwrap
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// TemplateFunc describes a func declared in a template.
+type TemplateFunc struct {
+	// Name is the template func name, such as "Page". The generated Go
+	// funcs are StreamPage, WritePage and Page.
+	Name string
+
+	// Receiver is the receiver type of a template method, such as
+	// "*BasePage", or empty for plain funcs.
+	Receiver string
+
+	// Package is the name of the Go package the func is generated into.
+	Package string
+
+	// Params lists the parameters of the func.
+	Params []TemplateParam
+
+	// Stream, Write and String report which variants are generated:
+	// StreamName writing to a *quicktemplate.Writer, WriteName writing to
+	// an io.Writer and Name returning a string.
+	Stream, Write, String bool
+
+	// Position is the location of the func in its template.
+	Position Position
+}
+
+// TemplateParam is a parameter of a template func.
+type TemplateParam struct {
+	// Name is the parameter name.
+	Name string
+
+	// Type is the parameter type as written in the template.
+	Type string
+
+	// Variadic is set for a final "...T" parameter; Type then holds T.
+	Variadic bool
+}
+
+// Signature returns the parameter list of the func as Go source, such as
+// "title string, items []string".
+func (f TemplateFunc) Signature() string {
+	params := make([]string, 0, len(f.Params))
+	for _, param := range f.Params {
+		typ := param.Type
+		if param.Variadic {
+			typ = "..." + typ
+		}
+		params = append(params, param.Name+" "+typ)
+	}
+	return strings.Join(params, ", ")
+}
+
+// Inventory lists the template funcs declared in a set of templates.
+type Inventory struct {
+	// Funcs holds the template funcs ordered by template file and line.
+	Funcs []TemplateFunc
+}
+
+// Lookup finds a template func by the name of any of its generated Go
+// funcs. Methods are named "Receiver.Name", without pointer.
+//
+// Example:
+//
+//	if _, ok := inventory.Lookup("WritePage"); !ok {
+//	    fmt.Println("handler calls a template that does not exist")
+//	}
+func (inv *Inventory) Lookup(name string) (TemplateFunc, bool) {
+	receiver, method, isMethod := strings.Cut(name, ".")
+	if !isMethod {
+		receiver, method = "", name
+	}
+
+	for _, fn := range inv.Funcs {
+		if strings.TrimPrefix(fn.Receiver, "*") != receiver && (isMethod || fn.Receiver != "") {
+			continue
+		}
+		if (fn.Stream && method == "Stream"+fn.Name) || (fn.Write && method == "Write"+fn.Name) ||
+			(fn.String && method == fn.Name) {
+			return fn, true
+		}
+	}
+	return TemplateFunc{}, false
+}
+
+// BuildInventory lists the template funcs of the templates selected by
+// config.
+//
+// Every template is compiled in memory with quicktemplate's parser, without
+// writing files or requiring qtc, and the generated code is inspected with
+// go/ast. Positions refer to the templates, so the inventory can be used
+// to generate documentation or to check that handlers only call existing
+// templates.
+//
+// Example:
+//
+//	inventory, err := BuildInventory(Config{Dir: "templates"})
+//	if err != nil {
+//	    fmt.Printf("Cannot list templates: %v\n", err)
+//	    return
+//	}
+//	for _, fn := range inventory.Funcs {
+//	    fmt.Printf("%s: %s(%s)\n", fn.Position, fn.Name, fn.Signature())
+//	}
+func BuildInventory(config Config) (*Inventory, error) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &Inventory{}
+	for _, template := range templates {
+		funcs, err := templateFuncs(template)
+		if err != nil {
+			return nil, err
+		}
+		inventory.Funcs = append(inventory.Funcs, funcs...)
+	}
+
+	sort.SliceStable(inventory.Funcs, func(i, j int) bool {
+		a, b := inventory.Funcs[i].Position, inventory.Funcs[j].Position
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return inventory, nil
+}
+
+// templateFuncs lists the funcs declared in a single template.
+//
+// The code is generated with line comments, so the lines of the generated
+// declarations resolve to template lines.
+func templateFuncs(template string) ([]TemplateFunc, error) {
+	code, err := generateCode(template, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, template+".go", code, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse code generated for %s: %w", template, err)
+	}
+
+	collected := collectTemplateFuncs(fset, []*ast.File{file})
+	funcs := make([]TemplateFunc, 0, len(collected))
+	for _, fn := range collected {
+		pos := fset.Position(fn.pos)
+		public := TemplateFunc{
+			Name:     fn.Name,
+			Receiver: fn.Receiver,
+			Package:  file.Name.Name,
+			Stream:   fn.Stream,
+			Write:    fn.Write,
+			String:   fn.String,
+			Params:   fn.params(),
+			Position: Position{File: template, Line: pos.Line},
+		}
+		funcs = append(funcs, public)
+	}
+	return funcs, nil
+}
@@ -0,0 +1,86 @@
+package qtcwrap
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildInventory(t *testing.T) {
+	inventory, err := BuildInventory(Config{Dir: corpusDir})
+	if err != nil {
+		t.Fatalf("BuildInventory failed: %v", err)
+	}
+
+	page := filepath.Join(corpusDir, "layout", "page.qtpl")
+	expected := []struct {
+		name      string
+		receiver  string
+		pkg       string
+		signature string
+		position  Position
+	}{
+		{"Greeting", "", "corpus", "name string, count int", Position{File: filepath.Join(corpusDir, "basic.qtpl"), Line: 3}},
+		{"List", "", "corpus", "items []string", Position{File: filepath.Join(corpusDir, controlTemplate), Line: 5}},
+		{"Welcome", "", "mail", "user string", Position{File: filepath.Join(corpusDir, "emails", "welcome.qtpl"), Line: 5}},
+		{"PageTemplate", "", "layout", "p Page", Position{File: page, Line: 10}},
+		{"Title", "*BasePage", "layout", "", Position{File: page, Line: 25}},
+		{"Body", "*BasePage", "layout", "", Position{File: page, Line: 27}},
+	}
+
+	if len(inventory.Funcs) != len(expected) {
+		t.Fatalf("Expected %d funcs, got %+v", len(expected), inventory.Funcs)
+	}
+	for i, want := range expected {
+		fn := inventory.Funcs[i]
+		if fn.Name != want.name || fn.Receiver != want.receiver || fn.Package != want.pkg {
+			t.Errorf("Func %d: expected %s %s.%s, got %+v", i, want.pkg, want.receiver, want.name, fn)
+		}
+		if fn.Signature() != want.signature {
+			t.Errorf("%s: expected signature %q, got %q", want.name, want.signature, fn.Signature())
+		}
+		if fn.Position != want.position {
+			t.Errorf("%s: expected position %s, got %s", want.name, want.position, fn.Position)
+		}
+		if !fn.Stream || !fn.Write || !fn.String {
+			t.Errorf("%s: expected all variants, got %+v", want.name, fn)
+		}
+	}
+}
+
+func TestInventoryLookup(t *testing.T) {
+	inventory := &Inventory{Funcs: []TemplateFunc{
+		{Name: "Page", Stream: true, Write: true, String: true},
+		{Name: "Title", Receiver: "*BasePage", Stream: true, Write: true},
+	}}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"Page", true},
+		{"WritePage", true},
+		{"StreamPage", true},
+		{"Missing", false},
+		{"BasePage.WriteTitle", true},
+		{"BasePage.Title", false},
+		{"WriteTitle", false},
+		{"Other.WritePage", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := inventory.Lookup(tt.name); ok != tt.expected {
+				t.Errorf("Lookup(%q) = %t, expected %t", tt.name, ok, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildInventoryInvalidTemplate(t *testing.T) {
+	dir := createTempTestDir(t)
+	defer cleanupTempDir(t, dir)
+
+	writeTestTemplate(t, dir, testQtplFile, brokenTemplate)
+	_, err := BuildInventory(Config{Dir: dir})
+	assertValidationError(t, err, testQtplFile, true)
+}
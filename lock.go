@@ -0,0 +1,265 @@
+package qtcwrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// lockDirName is the directory holding lock files, below the user cache
+	// directory or, without one, os.TempDir with the user ID appended.
+	lockDirName = "qtcwrap-locks"
+
+	// lockPollInterval and maxLockPollInterval bound the wait between
+	// attempts to take a busy file lock.
+	lockPollInterval    = 10 * time.Millisecond
+	maxLockPollInterval = 100 * time.Millisecond
+)
+
+// lockMode is the mode a directory is locked in.
+type lockMode int
+
+const (
+	// lockShared is held on the ancestors of a compiled directory, so
+	// compilations of sibling directories do not exclude each other.
+	lockShared lockMode = iota + 1
+
+	// lockExclusive is held on a compiled directory.
+	lockExclusive
+)
+
+// lockPlan returns the locks protecting compilations into dirs.
+//
+// Locking is hierarchical: every directory is locked exclusively and its
+// ancestors in shared mode. Compilations of nested directories therefore
+// conflict on the outer directory, while compilations of disjoint
+// directories only share locks and run in parallel. Directories are
+// resolved to absolute paths, following symbolic links where they exist.
+func lockPlan(dirs []string) (map[string]lockMode, error) {
+	plan := make(map[string]lockMode)
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", dir, err)
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+
+		plan[abs] = lockExclusive
+		for parent := filepath.Dir(abs); ; parent = filepath.Dir(parent) {
+			if plan[parent] == 0 {
+				plan[parent] = lockShared
+			}
+			if filepath.Dir(parent) == parent {
+				break
+			}
+		}
+	}
+	return plan, nil
+}
+
+// sortedLockPaths returns the paths of a plan in lock order. Locks are
+// always taken in this order, which prevents deadlocks between
+// compilations.
+func sortedLockPaths(plan map[string]lockMode) []string {
+	paths := make([]string, 0, len(plan))
+	for path := range plan {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// heldLock counts the holders of a directory lock within the process.
+type heldLock struct {
+	shared    int
+	exclusive bool
+}
+
+// pathLocks tracks the directory locks held within the process.
+type pathLocks struct {
+	mu      sync.Mutex
+	held    map[string]*heldLock
+	changed chan struct{}
+}
+
+// processLocks serializes overlapping compilations of the process.
+var processLocks = &pathLocks{held: make(map[string]*heldLock), changed: make(chan struct{})}
+
+// acquire waits until every lock of plan is available and takes them.
+func (l *pathLocks) acquire(ctx context.Context, plan map[string]lockMode) error {
+	for {
+		l.mu.Lock()
+		if l.available(plan) {
+			for path, mode := range plan {
+				held := l.held[path]
+				if held == nil {
+					held = &heldLock{}
+					l.held[path] = held
+				}
+				if mode == lockExclusive {
+					held.exclusive = true
+				} else {
+					held.shared++
+				}
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for concurrent compilation: %w", ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// available reports whether every lock of plan can be taken. The caller
+// must hold l.mu.
+func (l *pathLocks) available(plan map[string]lockMode) bool {
+	for path, mode := range plan {
+		held := l.held[path]
+		if held == nil {
+			continue
+		}
+		if held.exclusive || (mode == lockExclusive && held.shared > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// release gives up the locks of plan and wakes up waiting compilations.
+func (l *pathLocks) release(plan map[string]lockMode) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for path, mode := range plan {
+		held := l.held[path]
+		if held == nil {
+			continue
+		}
+		if mode == lockExclusive {
+			held.exclusive = false
+		} else {
+			held.shared--
+		}
+		if !held.exclusive && held.shared == 0 {
+			delete(l.held, path)
+		}
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// lockDirPath returns the per-user directory holding lock files: qtcwrap-locks
+// in the user cache directory, such as ~/.cache/qtcwrap-locks, or
+// os.TempDir()/qtcwrap-locks-<uid> when there is no cache directory. A
+// per-user location keeps other users of a shared temporary directory from
+// owning, or creating in advance, the directory every compilation locks in.
+func lockDirPath() string {
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cacheDir, lockDirName)
+	}
+	name := lockDirName
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// lockDirs takes the in-process and file locks protecting compilations into
+// dirs and returns a function releasing them.
+//
+// File locks are advisory locks on files in lockDirPath, one per directory,
+// so concurrent go generate processes serialize as well. On platforms
+// without file locking, and for directories whose lock file cannot be
+// created or locked, such as on a read-only or full disk, only
+// compilations within the process are serialized.
+func lockDirs(ctx context.Context, dirs []string) (func(), error) {
+	plan, err := lockPlan(dirs)
+	if err != nil {
+		return nil, err
+	}
+	if err := processLocks.acquire(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	lockDir := lockDirPath()
+	if err := os.MkdirAll(lockDir, 0o700); err != nil {
+		// Fall back to in-process locking
+		return func() { processLocks.release(plan) }, nil
+	}
+
+	var files []*os.File
+	unlock := func() {
+		for i := len(files) - 1; i >= 0; i-- {
+			_ = unlockFile(files[i])
+			_ = files[i].Close()
+		}
+		processLocks.release(plan)
+	}
+
+	for _, path := range sortedLockPaths(plan) {
+		sum := sha256.Sum256([]byte(path))
+		name := filepath.Join(lockDir, hex.EncodeToString(sum[:16])+".lock")
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o600) // #nosec G304 -- name is derived from a hash below the lock directory
+		if err != nil {
+			// Fall back to in-process locking for this directory
+			continue
+		}
+		if err := lockFileContext(ctx, f, plan[path]); err != nil {
+			_ = f.Close()
+			if ctx.Err() == nil {
+				continue
+			}
+			unlock()
+			return nil, fmt.Errorf("cannot lock %s: %w", path, err)
+		}
+		files = append(files, f)
+	}
+	return unlock, nil
+}
+
+// lockFileContext takes a file lock, polling while it is held elsewhere
+// until ctx is done.
+func lockFileContext(ctx context.Context, f *os.File, mode lockMode) error {
+	interval := lockPollInterval
+	for {
+		locked, err := tryLockFile(f, mode)
+		if err != nil || locked {
+			return err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("waiting for concurrent compilation: %w", ctx.Err())
+		case <-timer.C:
+		}
+		interval = min(2*interval, maxLockPollInterval)
+	}
+}
+
+// compileDirs returns the directories a compilation writes to: the
+// template root and the output directory.
+func compileDirs(config Config) []string {
+	dirs := []string{templateRoot(config)}
+	if config.OutputDir != "" {
+		dirs = append(dirs, config.OutputDir)
+	}
+	return dirs
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package qtcwrap
+
+import "os"
+
+// tryLockFile pretends to lock f on platforms without flock, where only
+// compilations within the process are serialized.
+func tryLockFile(*os.File, lockMode) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op on platforms without flock.
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,162 @@
+package qtcwrap
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// lockTestTimeout bounds waits for locks that are expected to be busy.
+const lockTestTimeout = 50 * time.Millisecond
+
+// resolvedTempDir returns a temporary directory without symbolic links, as
+// used in lock plans.
+func resolvedTempDir(t *testing.T) string {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf(createTempDirErr, err)
+	}
+	return dir
+}
+
+func TestLockPlan(t *testing.T) {
+	root := resolvedTempDir(t)
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "a", "b")
+
+	plan, err := lockPlan([]string{b, filepath.Join(root, "c"), a})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]lockMode{
+		root:                     lockShared,
+		a:                        lockExclusive,
+		b:                        lockExclusive,
+		filepath.Join(root, "c"): lockExclusive,
+		filepath.Dir(root):       lockShared,
+	}
+	for path, mode := range expected {
+		if plan[path] != mode {
+			t.Errorf("Expected mode %d for %s, got %d", mode, path, plan[path])
+		}
+	}
+	if plan[string(filepath.Separator)] != lockShared {
+		t.Errorf("Expected filesystem root to be locked shared, got %v", plan)
+	}
+
+	paths := sortedLockPaths(plan)
+	for i := 1; i < len(paths); i++ {
+		if paths[i-1] >= paths[i] {
+			t.Errorf("Expected sorted lock order, got %v", paths)
+		}
+	}
+}
+
+func TestPathLocks(t *testing.T) {
+	locks := &pathLocks{held: make(map[string]*heldLock), changed: make(chan struct{})}
+	outer := map[string]lockMode{"/a": lockExclusive}
+	inner := map[string]lockMode{"/a": lockShared, "/a/b": lockExclusive}
+	sibling := map[string]lockMode{"/c": lockExclusive}
+
+	if err := locks.acquire(context.Background(), outer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTestTimeout)
+	defer cancel()
+	if err := locks.acquire(ctx, inner); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected overlapping lock to wait, got %v", err)
+	}
+	if err := locks.acquire(context.Background(), sibling); err != nil {
+		t.Fatalf("Expected disjoint lock to be available, got %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- locks.acquire(context.Background(), inner)
+	}()
+	locks.release(outer)
+	if err := <-acquired; err != nil {
+		t.Fatalf("Expected lock after release, got %v", err)
+	}
+
+	locks.release(inner)
+	locks.release(sibling)
+	if len(locks.held) != 0 {
+		t.Errorf("Expected no held locks, got %v", locks.held)
+	}
+}
+
+func TestLockDirs(t *testing.T) {
+	root := resolvedTempDir(t)
+	outer, inner, sibling := filepath.Join(root, "a"), filepath.Join(root, "a", "b"), filepath.Join(root, "c")
+
+	unlock, err := lockDirs(context.Background(), []string{outer})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTestTimeout)
+	defer cancel()
+	if _, err := lockDirs(ctx, []string{inner}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected nested directory to wait, got %v", err)
+	}
+
+	unlockSibling, err := lockDirs(context.Background(), []string{sibling})
+	if err != nil {
+		t.Fatalf("Expected disjoint directory to be available, got %v", err)
+	}
+	unlockSibling()
+
+	unlock()
+	unlockInner, err := lockDirs(context.Background(), []string{inner})
+	if err != nil {
+		t.Fatalf("Expected lock after release, got %v", err)
+	}
+	unlockInner()
+}
+
+func TestLockDirPath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "ios" || runtime.GOOS == "plan9" {
+		t.Skip("the user cache directory does not follow XDG_CACHE_HOME")
+	}
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	if got, expected := lockDirPath(), filepath.Join(cacheDir, lockDirName); got != expected {
+		t.Errorf("Expected lock directory %s, got %s", expected, got)
+	}
+}
+
+func TestLockDirsUnwritableLockDir(t *testing.T) {
+	// A file where the lock directory belongs cannot be turned into one
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for _, name := range []string{"XDG_CACHE_HOME", "HOME", "LocalAppData", "home"} {
+		t.Setenv(name, blocker)
+	}
+	dir := resolvedTempDir(t)
+
+	unlock, err := lockDirs(context.Background(), []string{dir})
+	if err != nil {
+		t.Fatalf("Expected in-process locking without a lock directory, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTestTimeout)
+	defer cancel()
+	if _, err := lockDirs(ctx, []string{dir}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected in-process locks to still serialize compilations, got %v", err)
+	}
+
+	unlock()
+	unlockAgain, err := lockDirs(context.Background(), []string{dir})
+	if err != nil {
+		t.Fatalf("Expected lock after release, got %v", err)
+	}
+	unlockAgain()
+}
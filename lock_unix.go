@@ -0,0 +1,37 @@
+//go:build unix
+
+package qtcwrap
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLockFile takes an advisory lock on f without blocking. It reports
+// false if the lock is held by another process or open file.
+func tryLockFile(f *os.File, mode lockMode) (bool, error) {
+	how := syscall.LOCK_SH
+	if mode == lockExclusive {
+		how = syscall.LOCK_EX
+	}
+
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB) // #nosec G115 -- file descriptors fit in an int
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+}
+
+// unlockFile releases the advisory lock on f.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN) // #nosec G115 -- file descriptors fit in an int
+}
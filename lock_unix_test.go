@@ -0,0 +1,44 @@
+//go:build unix
+
+package qtcwrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+	open := func() *os.File {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+		if err != nil {
+			t.Fatalf("Failed to open lock file: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+		return f
+	}
+	first, second := open(), open()
+
+	if locked, err := tryLockFile(first, lockShared); !locked || err != nil {
+		t.Fatalf("Expected shared lock, got %v, %v", locked, err)
+	}
+	if locked, err := tryLockFile(second, lockShared); !locked || err != nil {
+		t.Fatalf("Expected second shared lock, got %v, %v", locked, err)
+	}
+	if err := unlockFile(second); err != nil {
+		t.Fatalf("Failed to unlock: %v", err)
+	}
+
+	if locked, err := tryLockFile(second, lockExclusive); locked || err != nil {
+		t.Fatalf("Expected exclusive lock to be busy, got %v, %v", locked, err)
+	}
+	if err := unlockFile(first); err != nil {
+		t.Fatalf("Failed to unlock: %v", err)
+	}
+	if locked, err := tryLockFile(second, lockExclusive); !locked || err != nil {
+		t.Fatalf("Expected exclusive lock after release, got %v, %v", locked, err)
+	}
+}
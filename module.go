@@ -0,0 +1,368 @@
+package qtcwrap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// goModFile is the name of Go module files.
+	goModFile = "go.mod"
+
+	// goWorkFile is the name of Go workspace files.
+	goWorkFile = "go.work"
+)
+
+// Module describes a Go module taking part in a module compilation.
+type Module struct {
+	// Path is the module path declared in go.mod.
+	Path string
+
+	// Dir is the module root directory.
+	Dir string
+}
+
+// PackageResult holds the compilation result for one Go package.
+type PackageResult struct {
+	// ImportPath is the import path of the package.
+	ImportPath string
+
+	// Dir is the package directory.
+	Dir string
+
+	// Module is the path of the module the package belongs to.
+	Module string
+
+	// Result holds the compiled templates and generated files.
+	Result *Result
+}
+
+// ModuleReport describes the outcome of CompileModule.
+type ModuleReport struct {
+	// Modules lists the modules that were compiled. A workspace lists every
+	// module of its use directives.
+	Modules []Module
+
+	// Packages holds the results grouped by package, sorted by import path.
+	// Only packages containing templates are listed.
+	Packages []PackageResult
+}
+
+// Package returns the result for an import path.
+func (r *ModuleReport) Package(importPath string) (*PackageResult, bool) {
+	for i := range r.Packages {
+		if r.Packages[i].ImportPath == importPath {
+			return &r.Packages[i], true
+		}
+	}
+	return nil, false
+}
+
+// CompileModule compiles the templates of every package in a Go module.
+//
+// root must contain a go.mod file or a go.work file. For a workspace, every
+// module listed in its use directives is compiled. Packages are found by
+// walking the module tree; like the go command, the walk skips vendor and
+// testdata directories, directories starting with "." or "_", and nested
+// modules, which are separate modules.
+//
+// The options of config apply to every package; Dir and File are ignored.
+// Templates are compiled package by package, so only the templates of a
+// package itself, not of its subpackages, are part of its result. When
+// config.OutputDir is set, each package is compiled into the same relative
+// directory below OutputDir.
+//
+// Compilation continues after a failing package; all errors are returned
+// together.
+//
+// Example:
+//
+//	report, err := CompileModule(".", GetDefaultConfig())
+//	if err != nil {
+//	    fmt.Printf("Compilation failed: %v\n", err)
+//	}
+//	for _, pkg := range report.Packages {
+//	    fmt.Printf("%s: %d templates\n", pkg.ImportPath, len(pkg.Result.Templates))
+//	}
+func CompileModule(root string, config Config) (*ModuleReport, error) {
+	config, _, err := applyEnv(config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := findModules(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ModuleReport{Modules: modules}
+	var errs []error
+	for _, module := range modules {
+		packages, err := modulePackages(module, config.Ext)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, pkg := range packages {
+			result, err := compilePackage(module, pkg, config)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", pkg.importPath, err))
+			}
+			report.Packages = append(report.Packages, PackageResult{
+				ImportPath: pkg.importPath,
+				Dir:        pkg.dir,
+				Module:     module.Path,
+				Result:     result,
+			})
+		}
+	}
+
+	sort.Slice(report.Packages, func(i, j int) bool {
+		return report.Packages[i].ImportPath < report.Packages[j].ImportPath
+	})
+	return report, errors.Join(errs...)
+}
+
+// modulePackage is a package directory containing templates.
+type modulePackage struct {
+	importPath string
+	dir        string
+	templates  []string
+}
+
+// compilePackage compiles the templates of one package. Every template is
+// generated before the package is type-checked, and the failures of all
+// templates are reported.
+func compilePackage(module Module, pkg modulePackage, config Config) (*Result, error) {
+	rel, err := filepath.Rel(module.Dir, pkg.dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s relative to %s: %w", pkg.dir, module.Dir, err)
+	}
+
+	outputDir := ""
+	if config.OutputDir != "" {
+		outputDir = filepath.Join(config.OutputDir, rel)
+	}
+
+	configs := make([]Config, 0, len(pkg.templates))
+	for _, template := range pkg.templates {
+		fileConfig := config
+		fileConfig.Dir = ""
+		fileConfig.File = template
+		fileConfig.OutputDir = outputDir
+		configs = append(configs, fileConfig)
+	}
+	return compileEach(context.Background(), configs)
+}
+
+// mergeResult appends the contents of src to dst.
+func mergeResult(dst, src *Result) {
+	if src == nil {
+		return
+	}
+	dst.Templates = append(dst.Templates, src.Templates...)
+	dst.Generated = append(dst.Generated, src.Generated...)
+	dst.Warnings = append(dst.Warnings, src.Warnings...)
+	dst.Diagnostics = append(dst.Diagnostics, src.Diagnostics...)
+	dst.Cached = append(dst.Cached, src.Cached...)
+	dst.Invocations = append(dst.Invocations, src.Invocations...)
+	dst.Overwritten = append(dst.Overwritten, src.Overwritten...)
+	dst.Attempts = append(dst.Attempts, src.Attempts...)
+}
+
+// findModules returns the modules rooted at root: the modules of the
+// workspace if root holds a go.work file, or the module of its go.mod file.
+func findModules(root string) ([]Module, error) {
+	workFile := filepath.Join(root, goWorkFile)
+	if _, err := os.Stat(workFile); err == nil {
+		dirs, err := readWorkspace(workFile)
+		if err != nil {
+			return nil, err
+		}
+
+		modules := make([]Module, 0, len(dirs))
+		for _, dir := range dirs {
+			module, err := readModule(filepath.Join(root, dir))
+			if err != nil {
+				return nil, err
+			}
+			modules = append(modules, module)
+		}
+		return modules, nil
+	}
+
+	module, err := readModule(root)
+	if err != nil {
+		return nil, err
+	}
+	return []Module{module}, nil
+}
+
+// readModule reads the module path from the go.mod file in dir.
+func readModule(dir string) (Module, error) {
+	modFile := filepath.Join(dir, goModFile)
+	lines, err := readDirectiveLines(modFile)
+	if err != nil {
+		return Module{}, err
+	}
+
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "module"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			modulePath, err := unquoteModulePath(strings.TrimSpace(rest))
+			if err != nil || modulePath == "" {
+				return Module{}, fmt.Errorf("%s: invalid module directive", modFile)
+			}
+			return Module{Path: modulePath, Dir: dir}, nil
+		}
+	}
+	return Module{}, fmt.Errorf("%s: no module directive found", modFile)
+}
+
+// readWorkspace returns the module directories listed in the use directives
+// of a go.work file, relative to the workspace root.
+func readWorkspace(workFile string) ([]string, error) {
+	lines, err := readDirectiveLines(workFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	inBlock := false
+	for _, line := range lines {
+		switch {
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock:
+			dirs = append(dirs, line)
+		case line == "use (":
+			inBlock = true
+		case strings.HasPrefix(line, "use "):
+			dirs = append(dirs, strings.TrimSpace(strings.TrimPrefix(line, "use ")))
+		}
+	}
+
+	for i, dir := range dirs {
+		unquoted, err := unquoteModulePath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid use directive %s", workFile, dir)
+		}
+		dirs[i] = filepath.FromSlash(unquoted)
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("%s: no use directives found", workFile)
+	}
+	return dirs, nil
+}
+
+// readDirectiveLines returns the non-empty lines of a go.mod or go.work
+// file with comments removed.
+func readDirectiveLines(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", file, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	return lines, nil
+}
+
+// unquoteModulePath removes the optional quotes around a path in go.mod and
+// go.work files.
+func unquoteModulePath(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "`") {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// modulePackages walks a module and returns its package directories that
+// contain templates with one of the given extensions.
+func modulePackages(module Module, ext string) ([]modulePackage, error) {
+	exts := templateExts(ext)
+
+	byDir := make(map[string]*modulePackage)
+	var dirs []string
+	err := filepath.WalkDir(module.Dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if p == module.Dir {
+				return nil
+			}
+			name := entry.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, goModFile)); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !hasTemplateExt(entry.Name(), exts) {
+			return nil
+		}
+		dir := filepath.Dir(p)
+		pkg, ok := byDir[dir]
+		if !ok {
+			importPath, err := packageImportPath(module, dir)
+			if err != nil {
+				return err
+			}
+			pkg = &modulePackage{importPath: importPath, dir: dir}
+			byDir[dir] = pkg
+			dirs = append(dirs, dir)
+		}
+		pkg.templates = append(pkg.templates, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking module %s: %w", module.Path, err)
+	}
+
+	packages := make([]modulePackage, 0, len(dirs))
+	for _, dir := range dirs {
+		packages = append(packages, *byDir[dir])
+	}
+	return packages, nil
+}
+
+// packageImportPath returns the import path of a directory inside a module.
+func packageImportPath(module Module, dir string) (string, error) {
+	rel, err := filepath.Rel(module.Dir, dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s relative to %s: %w", dir, module.Dir, err)
+	}
+	if rel == "." {
+		return module.Path, nil
+	}
+	return path.Join(module.Path, filepath.ToSlash(rel)), nil
+}
@@ -0,0 +1,204 @@
+package qtcwrap
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// Module test constants.
+	siteModulePath = "example.com/site"
+	siteGoMod      = "module " + siteModulePath + " // site\n\ngo 1.24\n"
+
+	// callerTemplate calls the func of calleeTemplate.
+	callerTemplate = "{% func A() %}<p>{%= B() %}</p>{% endfunc %}\n"
+	calleeTemplate = "{% func B() %}b{% endfunc %}\n"
+)
+
+func TestReadModule(t *testing.T) {
+	tests := []struct {
+		name     string
+		goMod    string
+		expected string
+		errMsg   string
+	}{
+		{"Plain", siteGoMod, siteModulePath, ""},
+		{"Quoted", "module \"example.com/quoted\"\n", "example.com/quoted", ""},
+		{"Missing", "go 1.24\n", "", "no module directive"},
+		{"Empty", "module\n", "", "invalid module directive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createTempTestDir(t)
+			defer cleanupTempDir(t, dir)
+			writeTestTemplate(t, dir, goModFile, tt.goMod)
+
+			module, err := readModule(dir)
+			if tt.errMsg != "" {
+				assertValidationError(t, err, tt.errMsg, true)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if module.Path != tt.expected || module.Dir != dir {
+				t.Errorf("Expected module %s in %s, got %+v", tt.expected, dir, module)
+			}
+		})
+	}
+}
+
+func TestReadWorkspace(t *testing.T) {
+	dir := createTempTestDir(t)
+	defer cleanupTempDir(t, dir)
+
+	work := writeTestTemplate(t, dir, goWorkFile, "go 1.24\n\nuse ./app // main\n\nuse (\n\t./lib\n\t\"./tools\"\n)\n")
+	dirs, err := readWorkspace(work)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"app", "lib", "tools"}
+	for i := range dirs {
+		dirs[i] = filepath.Clean(dirs[i])
+	}
+	if strings.Join(dirs, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, dirs)
+	}
+}
+
+func TestCompileModule(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, goModFile, siteGoMod)
+	writeTestTemplate(t, root, "index.qtpl", helloTemplate)
+	writeTestTemplate(t, root, "views/page.qtpl", helloTemplate)
+	writeTestTemplate(t, root, "views/footer.qtpl", helloTemplate)
+	writeTestTemplate(t, root, "views/admin/panel.qtpl", helloTemplate)
+	writeTestTemplate(t, root, "vendor/x/x.qtpl", brokenTemplate)
+	writeTestTemplate(t, root, "testdata/t.qtpl", brokenTemplate)
+	writeTestTemplate(t, root, "nested/go.mod", "module example.com/nested\n")
+	writeTestTemplate(t, root, "nested/n.qtpl", brokenTemplate)
+
+	report, err := CompileModule(root, Config{SkipLineComments: true, Backend: EmbeddedBackend})
+	if err != nil {
+		t.Fatalf("CompileModule failed: %v", err)
+	}
+
+	if len(report.Modules) != 1 || report.Modules[0].Path != siteModulePath {
+		t.Errorf("Unexpected modules: %+v", report.Modules)
+	}
+
+	expected := map[string]int{
+		siteModulePath:                  1,
+		siteModulePath + "/views":       2,
+		siteModulePath + "/views/admin": 1,
+	}
+	if len(report.Packages) != len(expected) {
+		t.Fatalf("Expected %d packages, got %+v", len(expected), report.Packages)
+	}
+	for i, pkg := range report.Packages {
+		if i > 0 && report.Packages[i-1].ImportPath >= pkg.ImportPath {
+			t.Errorf("Expected packages sorted by import path, got %s after %s", pkg.ImportPath, report.Packages[i-1].ImportPath)
+		}
+		if count, ok := expected[pkg.ImportPath]; !ok || len(pkg.Result.Generated) != count {
+			t.Errorf("Unexpected package %s with %d generated files", pkg.ImportPath, len(pkg.Result.Generated))
+		}
+	}
+
+	if _, ok := report.Package(siteModulePath + "/vendor/x"); ok {
+		t.Error("Expected vendor directory to be skipped")
+	}
+}
+
+func TestCompileModuleCrossTemplateCalls(t *testing.T) {
+	root := createTestModule(t)
+	writeTestTemplate(t, root, "views/a.qtpl", callerTemplate)
+	writeTestTemplate(t, root, "views/b.qtpl", calleeTemplate)
+
+	report, err := CompileModule(root, Config{SkipLineComments: true, Backend: EmbeddedBackend, PostBuildCheck: true})
+	if err != nil {
+		t.Fatalf("Expected templates calling each other to type-check, got: %v", err)
+	}
+	pkg, ok := report.Package(siteModulePath + "/views")
+	if !ok || len(pkg.Result.Generated) != 2 || len(pkg.Result.Diagnostics) != 0 {
+		t.Errorf("Expected both templates generated without diagnostics, got %+v", pkg)
+	}
+}
+
+func TestCompileModuleCollectsTemplateErrors(t *testing.T) {
+	root := createTestModule(t)
+	writeTestTemplate(t, root, "views/a.qtpl", brokenTemplate)
+	writeTestTemplate(t, root, "views/b.qtpl", calleeTemplate)
+	writeTestTemplate(t, root, "views/c.qtpl", brokenTemplate)
+
+	report, err := CompileModule(root, Config{SkipLineComments: true, Backend: EmbeddedBackend, PostBuildCheck: true})
+	if err == nil {
+		t.Fatal("Expected error for broken templates")
+	}
+	for _, name := range []string{"a.qtpl", "c.qtpl"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to report %s, got: %v", name, err)
+		}
+	}
+	pkg, ok := report.Package(siteModulePath + "/views")
+	if !ok || len(pkg.Result.Generated) != 1 {
+		t.Errorf("Expected the valid template to be generated despite the failures, got %+v", pkg)
+	}
+}
+
+func TestCompileModuleWorkspace(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, goWorkFile, "go 1.24\n\nuse (\n\t./app\n\t./lib\n)\n")
+	writeTestTemplate(t, root, "app/go.mod", "module example.com/app\n")
+	writeTestTemplate(t, root, "app/views/page.qtpl", helloTemplate)
+	writeTestTemplate(t, root, "lib/go.mod", "module example.com/lib\n")
+	writeTestTemplate(t, root, "lib/mail/welcome.qtpl", helloTemplate)
+	writeTestTemplate(t, root, "lib/broken/broken.qtpl", brokenTemplate)
+
+	report, err := CompileModule(root, Config{SkipLineComments: true, Backend: EmbeddedBackend})
+	assertValidationError(t, err, "example.com/lib/broken", true)
+
+	if len(report.Modules) != 2 {
+		t.Fatalf("Expected 2 modules, got %+v", report.Modules)
+	}
+	for _, importPath := range []string{"example.com/app/views", "example.com/lib/mail"} {
+		pkg, ok := report.Package(importPath)
+		if !ok || len(pkg.Result.Generated) != 1 {
+			t.Errorf("Expected %s to be compiled, got %+v", importPath, pkg)
+		}
+	}
+}
+
+func TestCompileModuleOutputDir(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	writeTestTemplate(t, root, goModFile, siteGoMod)
+	writeTestTemplate(t, root, "views/page.qtpl", helloTemplate)
+	output := filepath.Join(root, genDir)
+
+	report, err := CompileModule(root, Config{SkipLineComments: true, Backend: EmbeddedBackend, OutputDir: output})
+	if err != nil {
+		t.Fatalf("CompileModule failed: %v", err)
+	}
+
+	pkg, ok := report.Package(siteModulePath + "/views")
+	expected := filepath.Join(output, viewsDir, "page.qtpl.go")
+	if !ok || len(pkg.Result.Generated) != 1 || pkg.Result.Generated[0] != expected {
+		t.Errorf("Expected %s to be generated, got %+v", expected, pkg)
+	}
+}
+
+func TestCompileModuleMissingGoMod(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	_, err := CompileModule(root, GetDefaultConfig())
+	assertValidationError(t, err, "go.mod", true)
+}
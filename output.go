@@ -0,0 +1,237 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// stagingDirPrefix is the prefix of temporary staging directories.
+	stagingDirPrefix = "qtcwrap-stage"
+
+	// outputDirPerm is the permission used for created output directories.
+	outputDirPerm = 0o750
+
+	// generatedFilePerm is the permission used for generated Go files.
+	generatedFilePerm = 0o644
+)
+
+// compileToOutputDir compiles templates in a staging area and moves the
+// generated files into config.OutputDir.
+//
+// The staging area mirrors the template tree below a directory named after
+// OutputDir, so qtc derives the same package names it would use for templates
+// living in the output tree. The package clause of a generated file is only
+// rewritten when its target directory already holds Go code of a different
+// package. Line comments are rewritten to point at the original templates.
+//
+// Nothing is moved into OutputDir if qtc fails.
+func compileToOutputDir(ctx context.Context, config Config) (*Result, error) {
+	return compileStaged(ctx, config, config.OutputDir, true)
+}
+
+// compileStaged compiles a copy of the selected templates in a staging area
+// and installs the generated files below destRoot once every template has
+// compiled successfully.
+//
+// When rewritePackages is set, the package clause of each generated file is
+// adjusted to the package already present in its target directory.
+func compileStaged(ctx context.Context, config Config, destRoot string, rewritePackages bool) (*Result, error) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp("", stagingDirPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(staging)
+	}()
+
+	destAbs, err := filepath.Abs(destRoot)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve output directory %s: %w", destRoot, err)
+	}
+	stageRoot := filepath.Join(staging, filepath.Base(destAbs))
+
+	staged, err := stageTemplates(templateRoot(config), stageRoot, templates)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compile the staged copy instead of the original tree
+	stagedConfig := config
+	stagedConfig.OutputDir = ""
+	stagedConfig.Atomic = false
+	if config.File != "" {
+		stagedConfig.File = staged[0].staged
+	} else {
+		stagedConfig.Dir = stageRoot
+	}
+
+	result := &Result{Templates: templates}
+	if err := runCompiler(ctx, stagedConfig, result); err != nil {
+		unstageDiagnostics(result.Diagnostics, staged)
+		return result, err
+	}
+
+	pending := make([]pendingFile, 0, len(staged))
+	for _, tpl := range staged {
+		dst := filepath.Join(destRoot, tpl.rel+".go")
+		code, err := stagedCode(tpl, dst, rewritePackages)
+		if err != nil {
+			return result, err
+		}
+		pending = append(pending, pendingFile{path: dst, data: code})
+	}
+
+	if err := commitFiles(pending); err != nil {
+		return result, err
+	}
+	for _, file := range pending {
+		result.Generated = append(result.Generated, file.path)
+	}
+	return result, nil
+}
+
+// stagedTemplate links a template to its copy in the staging area.
+type stagedTemplate struct {
+	// source is the template path as selected by the configuration.
+	source string
+
+	// staged is the path of the copy in the staging area.
+	staged string
+
+	// rel is the template path relative to the template root.
+	rel string
+}
+
+// templateRoot returns the directory the template tree is mirrored from.
+func templateRoot(config Config) string {
+	if config.File != "" {
+		return filepath.Dir(config.File)
+	}
+	if config.Dir == "" {
+		return "."
+	}
+	return config.Dir
+}
+
+// stageTemplates copies templates below root into stageRoot, keeping their
+// relative paths.
+func stageTemplates(root, stageRoot string, templates []string) ([]stagedTemplate, error) {
+	staged := make([]stagedTemplate, 0, len(templates))
+	for _, template := range templates {
+		rel, err := filepath.Rel(root, template)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s relative to %s: %w", template, root, err)
+		}
+
+		dst := filepath.Join(stageRoot, rel)
+		if err := copyFile(template, dst); err != nil {
+			return nil, err
+		}
+		staged = append(staged, stagedTemplate{source: template, staged: dst, rel: rel})
+	}
+	return staged, nil
+}
+
+// copyFile copies src to dst, creating parent directories as needed.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", src, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), outputDirPerm); err != nil {
+		return fmt.Errorf("cannot create directory for %s: %w", dst, err)
+	}
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		return fmt.Errorf("cannot write %s: %w", dst, err)
+	}
+	return nil
+}
+
+// stagedCode returns the code generated for a staged template, prepared
+// for installation at dst.
+//
+// Line comments referring to the staged copy are rewritten to the original
+// template. With rewritePackages, the package clause is adjusted to the
+// package of the target directory if it already contains Go code.
+func stagedCode(tpl stagedTemplate, dst string, rewritePackages bool) ([]byte, error) {
+	code, err := os.ReadFile(tpl.staged + ".go")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read generated code for %s: %w", tpl.source, err)
+	}
+	code = bytes.ReplaceAll(code, []byte("//line "+tpl.staged+":"), []byte("//line "+tpl.source+":"))
+
+	if !rewritePackages {
+		return code, nil
+	}
+
+	pkg, err := existingPackage(filepath.Dir(dst))
+	if err != nil {
+		return nil, err
+	}
+	if pkg != "" {
+		if code, err = rewritePackageClause(code, pkg); err != nil {
+			return nil, fmt.Errorf("cannot rewrite package clause for %s: %w", dst, err)
+		}
+	}
+	return code, nil
+}
+
+// existingPackage returns the package name declared by the Go files in dir.
+//
+// Test files are ignored. An empty name is returned if dir does not exist
+// or holds no Go files.
+func existingPackage(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read directory %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		return file.Name.Name, nil
+	}
+	return "", nil
+}
+
+// rewritePackageClause replaces the package name declared by src with pkg.
+func rewritePackageClause(src []byte, pkg string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, err
+	}
+	if file.Name.Name == pkg {
+		return src, nil
+	}
+
+	start := fset.Position(file.Name.Pos()).Offset
+	end := start + len(file.Name.Name)
+
+	rewritten := make([]byte, 0, len(src)-len(file.Name.Name)+len(pkg))
+	rewritten = append(rewritten, src[:start]...)
+	rewritten = append(rewritten, pkg...)
+	return append(rewritten, src[end:]...), nil
+}
@@ -0,0 +1,239 @@
+package qtcwrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// Output directory test constants.
+	genDir           = "gen"
+	helloTemplate    = "{% func Hello(name string) %}Hello, {%s name %}!{% endfunc %}\n"
+	readGeneratedErr = "Failed to read generated file: %v"
+)
+
+// writeTestTemplate writes a template file below dir, creating parent directories.
+func writeTestTemplate(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("Failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf(createSpecificFileErr, name, err)
+	}
+	return path
+}
+
+// requireQtc skips the test when the qtc tool is not installed.
+func requireQtc(t *testing.T) {
+	if !IsQtcAvailable() {
+		t.Skip("qtc tool not available")
+	}
+}
+
+func TestRewritePackageClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		pkg      string
+		expected string
+	}{
+		{
+			name:     "DifferentPackage",
+			src:      "// Code generated by qtc. DO NOT EDIT.\n\npackage templates\n\nimport \"io\"\n",
+			pkg:      "views",
+			expected: "// Code generated by qtc. DO NOT EDIT.\n\npackage views\n\nimport \"io\"\n",
+		},
+		{
+			name:     "SamePackage",
+			src:      "package views\n",
+			pkg:      "views",
+			expected: "package views\n",
+		},
+		{
+			name:     "PackageAfterLineComment",
+			src:      "//line templates/hello.qtpl:1\npackage gen\n",
+			pkg:      "web",
+			expected: "//line templates/hello.qtpl:1\npackage web\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewritePackageClause([]byte(tt.src), tt.pkg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(got))
+			}
+		})
+	}
+
+	t.Run("InvalidSource", func(t *testing.T) {
+		if _, err := rewritePackageClause([]byte("not go code"), "views"); err == nil {
+			t.Error("Expected error for invalid Go source")
+		}
+	})
+}
+
+func TestExistingPackage(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	t.Run("MissingDirectory", func(t *testing.T) {
+		pkg, err := existingPackage(filepath.Join(tempDir, "missing"))
+		assertValidationError(t, err, "", false)
+		if pkg != "" {
+			t.Errorf("Expected empty package, got '%s'", pkg)
+		}
+	})
+
+	t.Run("OnlyTestFiles", func(t *testing.T) {
+		writeTestTemplate(t, tempDir, "views_test.go", "package views_test\n")
+		pkg, err := existingPackage(tempDir)
+		assertValidationError(t, err, "", false)
+		if pkg != "" {
+			t.Errorf("Expected test files to be ignored, got '%s'", pkg)
+		}
+	})
+
+	t.Run("GoFiles", func(t *testing.T) {
+		writeTestTemplate(t, tempDir, "doc.go", "// Package views holds views.\npackage views\n")
+		pkg, err := existingPackage(tempDir)
+		assertValidationError(t, err, "", false)
+		if pkg != "views" {
+			t.Errorf("Expected package 'views', got '%s'", pkg)
+		}
+	})
+}
+
+func TestTemplateRoot(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{"FileMode", Config{File: filepath.Join(templatesDir, testQtplFile), Dir: "ignored"}, templatesDir},
+		{"DirectoryMode", Config{Dir: templatesDir}, templatesDir},
+		{"EmptyDir", Config{}, "."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templateRoot(tt.config); got != tt.expected {
+				t.Errorf("Expected root '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateConfigOutputDir(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+	tempFile := createTempTestFile(t, tempDir, testContent)
+
+	tests := []struct {
+		name      string
+		config    Config
+		errorMsg  string
+		expectErr bool
+	}{
+		{"MissingOutputDir", Config{Dir: tempDir, OutputDir: filepath.Join(tempDir, genDir)}, "", false},
+		{"ExistingOutputDir", Config{Dir: tempDir, OutputDir: tempDir}, "", false},
+		{"OutputDirIsFile", Config{Dir: tempDir, OutputDir: tempFile}, "is not a directory", true},
+		{"FileModeOutputDirIsFile", Config{File: tempFile, OutputDir: tempFile}, "is not a directory", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidationError(t, ValidateConfig(tt.config), tt.errorMsg, tt.expectErr)
+		})
+	}
+}
+
+func TestCompileToOutputDir(t *testing.T) {
+	requireQtc(t)
+
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	srcDir := filepath.Join(tempDir, templatesDir)
+	outDir := filepath.Join(tempDir, genDir)
+	writeTestTemplate(t, srcDir, "hello.qtpl", helloTemplate)
+	writeTestTemplate(t, srcDir, "sub/other.qtpl", helloTemplate)
+	writeTestTemplate(t, outDir, "sub/doc.go", "package views\n")
+
+	result, err := Compile(Config{Dir: srcDir, OutputDir: outDir})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	expectedPackages := map[string]string{
+		filepath.Join(outDir, "hello.qtpl.go"):     "package gen",
+		filepath.Join(outDir, "sub/other.qtpl.go"): "package views",
+	}
+	if len(result.Generated) != len(expectedPackages) {
+		t.Fatalf("Expected %d generated files, got %v", len(expectedPackages), result.Generated)
+	}
+
+	for path, pkg := range expectedPackages {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf(readGeneratedErr, err)
+		}
+		if !strings.Contains(string(code), pkg+"\n") {
+			t.Errorf("Expected %s to declare '%s'", path, pkg)
+		}
+	}
+
+	// Templates must not be compiled in place
+	if _, err := os.Stat(filepath.Join(srcDir, "hello.qtpl.go")); !os.IsNotExist(err) {
+		t.Error("Expected no generated file next to the template")
+	}
+}
+
+func TestCompileToOutputDirLineComments(t *testing.T) {
+	requireQtc(t)
+
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	template := writeTestTemplate(t, tempDir, filepath.Join(templatesDir, "hello.qtpl"), helloTemplate)
+	outDir := filepath.Join(tempDir, genDir)
+
+	if _, err := Compile(Config{File: template, OutputDir: outDir}); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	code, err := os.ReadFile(filepath.Join(outDir, "hello.qtpl.go"))
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+	if !strings.Contains(string(code), "//line "+template+":") {
+		t.Error("Expected line comments to reference the original template")
+	}
+	if strings.Contains(string(code), stagingDirPrefix) {
+		t.Error("Expected no references to the staging directory")
+	}
+}
+
+func TestCompileToOutputDirFailure(t *testing.T) {
+	requireQtc(t)
+
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	srcDir := filepath.Join(tempDir, templatesDir)
+	outDir := filepath.Join(tempDir, genDir)
+	writeTestTemplate(t, srcDir, "broken.qtpl", "{% func Broken( %}")
+
+	if _, err := Compile(Config{Dir: srcDir, OutputDir: outDir}); err == nil {
+		t.Fatal("Expected compilation error")
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Error("Expected output directory to stay untouched on failure")
+	}
+}
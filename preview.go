@@ -0,0 +1,748 @@
+package qtcwrap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultPreviewAddr is the address the preview server listens on when
+	// none is configured.
+	DefaultPreviewAddr = "localhost:8080"
+
+	// previewModulePath is the module path of the scratch module.
+	previewModulePath = "qtcwrap.preview"
+
+	// previewBuildPath serves the current build number for live reload.
+	previewBuildPath = "/_qtcwrap/build"
+
+	// previewListenPrefix starts the line the preview binary prints once it
+	// listens.
+	previewListenPrefix = "listening on "
+
+	// previewReadHeaderTimeout bounds the time to read request headers.
+	previewReadHeaderTimeout = 10 * time.Second
+
+	// previewReloadScript polls the build number and reloads the page when
+	// it changes. It is formatted with the build number of the page.
+	previewReloadScript = `<script>(function(){var b="%d";setInterval(function(){` +
+		`fetch("` + previewBuildPath + `").then(function(r){return r.text()})` +
+		`.then(function(t){if(t!==b){location.reload()}}).catch(function(){})},1000)})();</script>`
+)
+
+// PreviewConfig configures the template preview server.
+type PreviewConfig struct {
+	// Dir is the directory containing the templates to preview. It must lie
+	// inside a Go module that requires quicktemplate.
+	// If empty, defaults to the current directory (".").
+	Dir string
+
+	// Ext specifies the file extension for template files, or several
+	// extensions separated by commas. If empty, the default extension
+	// (.qtpl) is used.
+	Ext string
+
+	// Addr is the address the preview server listens on.
+	// If empty, DefaultPreviewAddr is used.
+	Addr string
+
+	// Fixtures is the directory holding JSON fixture files. The fixture of
+	// template func Name in the template subdirectory rel is read from
+	// <Fixtures>/<rel>/Name.json; its keys are the parameter names.
+	// If empty, fixtures are read from Dir.
+	Fixtures string
+
+	// ScratchDir is the directory of the scratch module the preview server
+	// is built in. If empty, a temporary directory is used and removed when
+	// the preview stops.
+	ScratchDir string
+
+	// Interval is the polling interval of the watch loop.
+	// If zero, DefaultWatchInterval is used.
+	Interval time.Duration
+
+	// Log receives progress and error messages.
+	// If nil, messages are written to os.Stderr.
+	Log io.Writer
+
+	// OnReady, if set, is called with the URL of the preview server once it
+	// listens.
+	OnReady func(url string)
+}
+
+// Preview serves rendered templates over HTTP until ctx is done.
+//
+// The templates are compiled with the embedded backend into a scratch
+// module, together with the hand-written Go files of their packages. A
+// small net/http server listing every exported template func is generated,
+// built and run; it renders each func with the parameters taken from its
+// JSON fixture, which is read on every request. The scratch module joins the
+// module of the templates in a go.work workspace, so templates may import
+// its packages.
+//
+// Templates are watched with Watch: every change recompiles them and
+// rebuilds and restarts the server, and open pages reload automatically.
+// Compilation and build errors are shown in the browser until fixed.
+//
+// Example:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	if err := Preview(ctx, PreviewConfig{Dir: "templates"}); err != nil {
+//	    fmt.Printf("Preview failed: %v\n", err)
+//	}
+func Preview(ctx context.Context, config PreviewConfig) error {
+	p, err := newPreviewer(config)
+	if err != nil {
+		return err
+	}
+	defer p.close()
+
+	addr := config.Addr
+	if addr == "" {
+		addr = DefaultPreviewAddr
+	}
+	var listenConfig net.ListenConfig
+	ln, err := listenConfig.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: p, ReadHeaderTimeout: previewReadHeaderTimeout}
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	serverURL := "http://" + ln.Addr().String()
+	p.logf("serving %s", serverURL)
+	if config.OnReady != nil {
+		config.OnReady(serverURL)
+	}
+
+	compileConfig := Config{Dir: p.root, Ext: config.Ext, OutputDir: p.pkgRoot, Backend: EmbeddedBackend}
+	return Watch(ctx, compileConfig, config.Interval, func(result *Result, err error) {
+		p.reload(ctx, result, err)
+	})
+}
+
+// previewer builds and runs the preview binary and proxies requests to it.
+type previewer struct {
+	// root is the absolute template directory.
+	root string
+
+	// fixtures is the absolute fixture directory.
+	fixtures string
+
+	// scratch is the scratch module directory; pkgRoot mirrors root in it.
+	scratch string
+	pkgRoot string
+
+	// removeScratch is set when the scratch directory is temporary.
+	removeScratch bool
+
+	log io.Writer
+
+	mu      sync.Mutex
+	build   int
+	err     error
+	proxy   http.Handler
+	process *exec.Cmd
+	binary  string
+}
+
+// newPreviewer sets up the scratch module for config.
+func newPreviewer(config PreviewConfig) (*previewer, error) {
+	dir := config.Dir
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %w", dir, err)
+	}
+
+	fixtures := root
+	if config.Fixtures != "" {
+		if fixtures, err = filepath.Abs(config.Fixtures); err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", config.Fixtures, err)
+		}
+	}
+
+	modFile, err := findGoMod(root)
+	if err != nil {
+		return nil, fmt.Errorf("templates must be part of a Go module: %w", err)
+	}
+	module, err := readModule(filepath.Dir(modFile))
+	if err != nil {
+		return nil, err
+	}
+	goVersion, err := goDirective(modFile)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &previewer{root: root, fixtures: fixtures, scratch: config.ScratchDir, log: config.Log}
+	if p.log == nil {
+		p.log = os.Stderr
+	}
+	if p.scratch == "" {
+		if p.scratch, err = os.MkdirTemp("", "qtcwrap-preview"); err != nil {
+			return nil, fmt.Errorf("failed to create scratch directory: %w", err)
+		}
+		p.removeScratch = true
+	}
+	p.pkgRoot = filepath.Join(p.scratch, filepath.Base(root))
+
+	goMod := fmt.Sprintf("module %s\n\ngo %s\n", previewModulePath, goVersion)
+	goWork := fmt.Sprintf("go %s\n\nuse (\n\t.\n\t%s\n)\n", goVersion, strconv.Quote(filepath.ToSlash(module.Dir)))
+	for name, content := range map[string]string{goModFile: goMod, goWorkFile: goWork} {
+		if err := writeScratchFile(filepath.Join(p.scratch, name), []byte(content)); err != nil {
+			p.close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// close stops the preview binary and removes a temporary scratch module.
+func (p *previewer) close() {
+	p.mu.Lock()
+	process := p.process
+	p.process = nil
+	p.mu.Unlock()
+
+	stopProcess(process)
+	if p.removeScratch {
+		_ = os.RemoveAll(p.scratch)
+	}
+}
+
+// logf writes a progress message.
+func (p *previewer) logf(format string, args ...any) {
+	_, _ = fmt.Fprintf(p.log, "qtcwrap preview: "+format+"\n", args...)
+}
+
+// reload rebuilds and restarts the preview binary after a compilation.
+//
+// On failure the error is shown to the browser instead of the previews;
+// the previous binary keeps running until a build succeeds.
+func (p *previewer) reload(ctx context.Context, result *Result, err error) {
+	p.mu.Lock()
+	build := p.build + 1
+	p.mu.Unlock()
+
+	var proxy http.Handler
+	var process *exec.Cmd
+	var binary string
+	if err == nil {
+		proxy, process, binary, err = p.rebuild(ctx, result, build)
+	}
+
+	p.mu.Lock()
+	oldProcess, oldBinary := p.process, p.binary
+	p.build = build
+	p.err = err
+	if err == nil {
+		p.proxy, p.process, p.binary = proxy, process, binary
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.logf("%v", err)
+		return
+	}
+	stopProcess(oldProcess)
+	if oldBinary != "" {
+		_ = os.Remove(oldBinary)
+	}
+	p.logf("build %d ready with %d templates", build, len(result.Templates))
+}
+
+// rebuild prepares the scratch module for result, builds the preview
+// binary and starts it.
+func (p *previewer) rebuild(ctx context.Context, result *Result, build int) (http.Handler, *exec.Cmd, string, error) {
+	if err := p.syncPackages(result); err != nil {
+		return nil, nil, "", err
+	}
+
+	packages, err := previewPackages(p.pkgRoot)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	code, err := previewMain(p.pkgRoot, packages)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := writeScratchFile(filepath.Join(p.scratch, "main.go"), code); err != nil {
+		return nil, nil, "", err
+	}
+
+	binary := filepath.Join(p.scratch, "bin", fmt.Sprintf("preview-%d", build))
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	// #nosec G204 -- the go command builds the generated scratch module
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", binary, ".")
+	cmd.Dir = p.scratch
+	cmd.Env = append(os.Environ(), "GOWORK="+filepath.Join(p.scratch, goWorkFile), "GOFLAGS=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, "", fmt.Errorf("building preview server failed: %w\n%s", err, output)
+	}
+
+	process, target, err := p.start(ctx, binary, build)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+		writePreviewError(w, build, err)
+	}
+	return proxy, process, binary, nil
+}
+
+// start runs the preview binary and waits for the address it listens on.
+func (p *previewer) start(ctx context.Context, binary string, build int) (*exec.Cmd, *url.URL, error) {
+	// #nosec G204 -- binary is the preview server built in the scratch module
+	cmd := exec.CommandContext(ctx, binary, "-addr", "127.0.0.1:0", "-fixtures", p.fixtures, "-build", strconv.Itoa(build))
+	cmd.Stderr = p.log
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot start preview server: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("cannot start preview server: %w", err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, previewListenPrefix) {
+		stopProcess(cmd)
+		return nil, nil, fmt.Errorf("preview server did not start: %q", line)
+	}
+	target, err := url.Parse(strings.TrimSpace(strings.TrimPrefix(line, previewListenPrefix)))
+	if err != nil {
+		stopProcess(cmd)
+		return nil, nil, fmt.Errorf("preview server reported an invalid address: %w", err)
+	}
+
+	go func() {
+		_, _ = io.Copy(p.log, reader)
+	}()
+	return cmd, target, nil
+}
+
+// ServeHTTP serves the build number, build errors, or proxies to the
+// preview binary.
+func (p *previewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	build, err, proxy := p.build, p.err, p.proxy
+	p.mu.Unlock()
+
+	switch {
+	case r.URL.Path == previewBuildPath:
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = fmt.Fprint(w, build)
+	case err != nil:
+		writePreviewError(w, build, err)
+	case proxy == nil:
+		writePreviewError(w, build, errors.New("the preview server is being built"))
+	default:
+		proxy.ServeHTTP(w, r)
+	}
+}
+
+// writePreviewError renders err as a page that reloads once a new build is
+// available.
+func writePreviewError(w http.ResponseWriter, build int, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = fmt.Fprintf(w, "<!DOCTYPE html>\n<title>qtcwrap preview</title>\n<pre>%s</pre>\n", html.EscapeString(err.Error()))
+	_, _ = fmt.Fprintf(w, previewReloadScript, build)
+}
+
+// syncPackages makes the scratch packages match the template packages: Go
+// files that were not generated by the compilation are removed, and the
+// hand-written Go files of every template package are copied.
+func (p *previewer) syncPackages(result *Result) error {
+	keep := make(map[string]bool, len(result.Generated))
+	for _, generated := range result.Generated {
+		keep[generated] = true
+	}
+
+	err := filepath.WalkDir(p.pkgRoot, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(file, ".go") && !keep[file] {
+			return os.Remove(file)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot clean scratch packages: %w", err)
+	}
+
+	dirs := make(map[string]bool)
+	templates := make(map[string]bool, len(result.Templates))
+	for _, template := range result.Templates {
+		dirs[filepath.Dir(template)] = true
+		templates[template] = true
+	}
+
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("cannot read template directory %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			src := filepath.Join(dir, name)
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") ||
+				templates[strings.TrimSuffix(src, ".go")] {
+				continue
+			}
+
+			rel, err := filepath.Rel(p.root, src)
+			if err != nil {
+				return fmt.Errorf("cannot resolve %s relative to %s: %w", src, p.root, err)
+			}
+			if err := copyFile(src, filepath.Join(p.pkgRoot, rel)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// previewPackage is a scratch package with template funcs to preview.
+type previewPackage struct {
+	// rel is the package directory relative to the package root, using
+	// forward slashes.
+	rel string
+
+	// funcs lists the template funcs of the package.
+	funcs []templateFunc
+}
+
+// previewPackages discovers the template funcs of every package below root.
+func previewPackages(root string) ([]previewPackage, error) {
+	var packages []previewPackage
+	err := filepath.WalkDir(root, func(dir string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+
+		funcs, err := discoverTemplateFuncs(dir)
+		if err != nil || len(funcs) == 0 {
+			return err
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return fmt.Errorf("cannot resolve %s relative to %s: %w", dir, root, err)
+		}
+		packages = append(packages, previewPackage{rel: filepath.ToSlash(rel), funcs: funcs})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover template funcs: %w", err)
+	}
+	return packages, nil
+}
+
+// previewImport is an import of the generated preview server.
+type previewImport struct {
+	Alias string
+	Path  string
+}
+
+// previewEntry is a template func listed by the preview server.
+type previewEntry struct {
+	ID        string
+	Signature string
+	Supported bool
+	Params    []previewParam
+	Call      string
+}
+
+// previewParam is a parameter decoded from a fixture.
+type previewParam struct {
+	Name string
+	Type string
+}
+
+// previewMain generates the main file of the preview server for the
+// packages below pkgRoot.
+func previewMain(pkgRoot string, packages []previewPackage) ([]byte, error) {
+	importPaths := make(map[string]string)
+	var imports []previewImport
+	alias := func(importPath, prefix string) string {
+		if name, ok := importPaths[importPath]; ok {
+			return name
+		}
+		name := fmt.Sprintf("%s%d", prefix, len(imports))
+		importPaths[importPath] = name
+		imports = append(imports, previewImport{Alias: name, Path: importPath})
+		return name
+	}
+
+	var entries []previewEntry
+	for _, pkg := range packages {
+		pkgPath := path.Join(previewModulePath, filepath.Base(pkgRoot), pkg.rel)
+
+		for _, fn := range pkg.funcs {
+			entry := previewEntry{ID: path.Join(pkg.rel, fn.Name), Signature: TemplateFunc{Params: fn.params()}.Signature()}
+
+			// Imports are only added for funcs the server can render, so
+			// every import is used
+			entry.Supported = true
+			for _, param := range fn.Params {
+				if _, ok := qualifyType(param.expr, "", fn.imports, func(string) string { return "" }); !ok {
+					entry.Supported = false
+				}
+			}
+			if !entry.Supported {
+				entries = append(entries, entry)
+				continue
+			}
+
+			pkgAlias := alias(pkgPath, "t")
+			args := make([]string, 0, len(fn.Params)+1)
+			args = append(args, "w")
+			for i, param := range fn.Params {
+				typ, _ := qualifyType(param.expr, pkgAlias, fn.imports, func(importPath string) string {
+					return alias(importPath, "i")
+				})
+
+				arg := fmt.Sprintf("args.P%d", i)
+				if param.Variadic {
+					typ = "[]" + typ
+					arg += "..."
+				}
+				entry.Params = append(entry.Params, previewParam{Name: param.Name, Type: typ})
+				args = append(args, arg)
+			}
+			entry.Call = fmt.Sprintf("%s.Write%s(%s)", pkgAlias, fn.Name, strings.Join(args, ", "))
+			entries = append(entries, entry)
+		}
+	}
+
+	var buf bytes.Buffer
+	data := struct {
+		Imports      []previewImport
+		Entries      []previewEntry
+		ReloadScript string
+	}{imports, entries, previewReloadScript}
+	if err := previewMainTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("cannot generate preview server: %w", err)
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot format preview server: %w", err)
+	}
+	return code, nil
+}
+
+// writeScratchFile writes a file of the scratch module.
+func writeScratchFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), outputDirPerm); err != nil {
+		return fmt.Errorf("cannot create directory for %s: %w", file, err)
+	}
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return fmt.Errorf("cannot write %s: %w", file, err)
+	}
+	return nil
+}
+
+// stopProcess kills a running process and waits for it to exit.
+func stopProcess(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+}
+
+// goDirective returns the Go version declared by a go.mod file.
+func goDirective(modFile string) (string, error) {
+	lines, err := readDirectiveLines(modFile)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if version, ok := strings.CutPrefix(line, "go "); ok {
+			return strings.TrimSpace(version), nil
+		}
+	}
+	// Modules without a go directive are treated as Go 1.16 by the go
+	// command, which predates workspaces
+	return "1.18", nil
+}
+
+// previewMainTemplate generates the main file of the preview server.
+var previewMainTemplate = template.Must(template.New("preview").Parse(`// Code generated by qtcwrap preview. DO NOT EDIT.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+{{range .Imports}}
+	{{.Alias}} {{printf "%q" .Path}}
+{{- end}}
+)
+
+var (
+	addr     = flag.String("addr", "127.0.0.1:0", "listen address")
+	fixtures = flag.String("fixtures", ".", "directory with JSON fixtures")
+	build    = flag.Int("build", 0, "build number used for live reload")
+)
+
+const reloadScript = {{printf "%q" .ReloadScript}}
+
+type preview struct {
+	id     string
+	params string
+	render func(w io.Writer, data []byte) error
+}
+
+var previews = []preview{
+{{- range .Entries}}
+	{
+		id:     {{printf "%q" .ID}},
+		params: {{printf "%q" .Signature}},
+{{- if .Supported}}
+		render: func(w io.Writer, data []byte) error {
+			var args struct {
+{{- range $i, $p := .Params}}
+				P{{$i}} {{$p.Type}} ` + "`" + `json:{{printf "%q" $p.Name}}` + "`" + `
+{{- end}}
+			}
+			if err := json.Unmarshal(data, &args); err != nil {
+				return err
+			}
+			{{.Call}}
+			return nil
+		},
+{{- end}}
+	},
+{{- end}}
+}
+
+func main() {
+	flag.Parse()
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("listening on http://%s\n", ln.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveIndex)
+	mux.HandleFunc("/render/", serveRender)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	log.Fatal(server.Serve(ln))
+}
+
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<!DOCTYPE html>\n<title>qtcwrap preview</title>\n<h1>Templates</h1>\n<ul>\n")
+	for _, p := range previews {
+		id, params := html.EscapeString(p.id), html.EscapeString(p.params)
+		if p.render == nil {
+			fmt.Fprintf(w, "<li>%s(%s) <em>unsupported parameter types</em></li>\n", id, params)
+			continue
+		}
+		fmt.Fprintf(w, "<li><a href=\"/render/%s\">%s</a>(%s) <small>%s</small></li>\n", id, id, params, html.EscapeString(fixturePath(p.id)))
+	}
+	fmt.Fprint(w, "</ul>\n")
+	fmt.Fprintf(w, reloadScript, *build)
+}
+
+func serveRender(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/render/")
+	for _, p := range previews {
+		if p.id != id || p.render == nil {
+			continue
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		body, err := render(p)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "<!DOCTYPE html>\n<title>%s</title>\n<pre>%s</pre>\n", html.EscapeString(id), html.EscapeString(err.Error()))
+		} else {
+			w.Write(body)
+		}
+		fmt.Fprintf(w, reloadScript, *build)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func render(p preview) (body []byte, err error) {
+	fixture := fixturePath(p.id)
+	data, err := os.ReadFile(fixture)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte("{}")
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("template panicked: %v", r)
+		}
+	}()
+
+	var buf bytes.Buffer
+	if err := p.render(&buf, data); err != nil {
+		return nil, fmt.Errorf("cannot use fixture %s: %w", fixture, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func fixturePath(id string) string {
+	return filepath.Join(*fixtures, filepath.FromSlash(id)+".json")
+}
+`))
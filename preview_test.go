@@ -0,0 +1,133 @@
+package qtcwrap
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewMain(t *testing.T) {
+	corpus := copyCorpus(t)
+	if _, err := Compile(Config{Dir: corpus, Backend: EmbeddedBackend}); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	packages, err := previewPackages(corpus)
+	if err != nil {
+		t.Fatalf("previewPackages failed: %v", err)
+	}
+	if len(packages) != 3 {
+		t.Fatalf("Expected 3 packages with template funcs, got %+v", packages)
+	}
+
+	code, err := previewMain(corpus, packages)
+	if err != nil {
+		t.Fatalf("previewMain failed: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "main.go", code, 0); err != nil {
+		t.Fatalf("Generated preview server does not parse: %v", err)
+	}
+
+	for _, expected := range []string{
+		`t0 "qtcwrap.preview/corpus"`,
+		"t0.WriteGreeting(w, args.P0, args.P1)",
+		"P0 string `json:\"name\"`",
+		`id:     "layout/PageTemplate"`,
+		"t2.WritePageTemplate(w, args.P0)",
+	} {
+		if !strings.Contains(string(code), expected) {
+			t.Errorf("Expected preview server to contain %q", expected)
+		}
+	}
+}
+
+func TestGoDirective(t *testing.T) {
+	dir := createTempTestDir(t)
+	defer cleanupTempDir(t, dir)
+
+	modFile := writeTestTemplate(t, dir, goModFile, testModuleGoMod)
+	if version, err := goDirective(modFile); err != nil || version != "1.24" {
+		t.Errorf("Expected go 1.24, got %q: %v", version, err)
+	}
+
+	writeTestTemplate(t, dir, goModFile, "module m\n")
+	if version, err := goDirective(modFile); err != nil || version != "1.18" {
+		t.Errorf("Expected workspace-capable default, got %q: %v", version, err)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping preview build in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not available")
+	}
+
+	root := createTestModule(t)
+	writeTestTemplate(t, root, "views/page.qtpl", "{% func Page(title string) %}<h1>{%s title %}</h1>{%s siteName() %}{% endfunc %}\n")
+	writeTestTemplate(t, root, "views/helpers.go", "package views\n\nfunc siteName() string { return \"site\" }\n")
+	writeTestTemplate(t, root, "views/Page.json", `{"title": "From fixture"}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ready := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Preview(ctx, PreviewConfig{
+			Dir:      filepath.Join(root, viewsDir),
+			Addr:     "127.0.0.1:0",
+			Interval: 50 * time.Millisecond,
+			Log:      io.Discard,
+			OnReady: func(url string) {
+				ready <- url
+			},
+		})
+	}()
+
+	var serverURL string
+	select {
+	case serverURL = <-ready:
+	case err := <-done:
+		t.Fatalf("Preview failed: %v", err)
+	}
+
+	waitForPage(t, serverURL+"/", "Page</a>(title string)")
+	waitForPage(t, serverURL+"/render/Page", "<h1>From fixture</h1>site")
+
+	writeTestTemplate(t, root, "views/page.qtpl", "{% func Page(title string) %}<h2>{%s title %}</h2>{% endfunc %}\n")
+	waitForPage(t, serverURL+"/render/Page", "<h2>From fixture</h2>")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected preview to stop cleanly, got %v", err)
+	}
+}
+
+// waitForPage polls url until its body contains expected.
+func waitForPage(t *testing.T, url, expected string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Minute)
+	var body string
+	for time.Now().Before(deadline) {
+		if resp, err := http.Get(url); err == nil { // #nosec G107 -- test server URL
+			data, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			body = string(data)
+			if strings.Contains(body, expected) {
+				return
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %q at %s, last body:\n%s", expected, url, body)
+}
@@ -9,17 +9,39 @@
 // - Single file template compilation
 // - Skipping line comments for cleaner generated code
 // - Custom file extensions
+// - Redirecting generated code into a separate output directory
+// - Atomic, all-or-nothing directory compilation
+// - An embedded compiler backend that does not require the qtc binary
+// - Source maps from generated Go lines back to template lines
+// - Type-checking generated code with errors mapped back to templates
+// - Module-wide compilation grouped by package import path
+// - A persistent build cache keyed by compiler version and flags
+// - Compiler version checks against bounds and the module's quicktemplate version
+// - Concurrency-safe compilation with per-directory locking
+// - A Compiler built with functional options, with pluggable qtc runners and loggers
+// - QTCWRAP_* environment variables overriding the configuration in CI
+// - Retries with backoff for transient qtc failures
+// - Dry runs listing the planned qtc invocations and written files
+// - Streaming compilation events as JSON lines for IDEs and CI dashboards
+// - SARIF and JUnit reports of diagnostics for CI systems
+// - Watching templates and previewing them in the browser with sample data
+// - Template size and complexity statistics with thresholds for CI
+// - A security audit of raw and wrongly escaped outputs with an allowlist
+// - Extracting translatable strings into gettext and JSON catalogs
+// - Coverage instrumentation with HTML and cover-profile reports of template lines
 // - Proper error handling and warning suppression
 package qtcwrap
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Config represents the configuration options for the qtc compiler.
@@ -49,8 +71,9 @@ type Config struct {
 	// When false, line comments are preserved for a better debugging experience.
 	SkipLineComments bool
 
-	// Ext specifies the file extension for template files.
-	// If empty, qtc uses its default extension (.qtpl).
+	// Ext specifies the file extension for template files, or several
+	// extensions separated by commas, such as ".qtpl,.qtxt". qtc is run
+	// once per extension. If empty, qtc uses its default extension (.qtpl).
 	// This field is ignored if File is specified.
 	Ext string
 
@@ -58,6 +81,80 @@ type Config struct {
 	// When specified, Dir and Ext fields are ignored.
 	// The file path should be relative to the current working directory.
 	File string
+
+	// OutputDir specifies a directory that receives the generated Go files.
+	// If empty, generated files are placed next to their templates, as qtc does.
+	// When set, templates are compiled in a staging area and the generated
+	// files are moved into a mirrored directory structure under OutputDir.
+	OutputDir string
+
+	// Atomic enables all-or-nothing compilation.
+	// When true, templates are compiled in a temporary copy of the tree and the
+	// generated files are only swapped into place once every template compiled
+	// successfully. On failure the existing generated code is left untouched.
+	// Compilation into OutputDir is always all-or-nothing.
+	Atomic bool
+
+	// Backend selects how templates are compiled.
+	// If empty, ExecBackend is used and the qtc binary must be in PATH.
+	// EmbeddedBackend compiles in-process using quicktemplate's parser.
+	Backend Backend
+
+	// SourceMaps enables writing a source map side file next to every
+	// generated file, mapping generated Go lines to template lines.
+	// This keeps generated code traceable when SkipLineComments is true.
+	SourceMaps bool
+
+	// PostBuildCheck enables type-checking the packages that received
+	// generated code. Errors, such as bad Go expressions inside templates,
+	// are mapped back to template positions and fail the compilation.
+	PostBuildCheck bool
+
+	// CacheDir specifies a persistent build cache directory, similar to
+	// GOCACHE. If empty, no cache is used. When set, generated files are
+	// stored keyed by template content, compiler version and compiler
+	// arguments, and restored without running the compiler when every
+	// selected template is found in the cache.
+	CacheDir string
+
+	// MinQtcVersion and MaxQtcVersion bound the accepted compiler version,
+	// both inclusively, such as "v1.7.0". If empty, any version is accepted.
+	MinQtcVersion string
+	MaxQtcVersion string
+
+	// MatchModuleVersion requires the compiler version to equal the
+	// github.com/valyala/quicktemplate version in the go.mod file governing
+	// the templates, so generated code matches its runtime library.
+	MatchModuleVersion bool
+
+	// Retries is the number of times a compiler run failing transiently,
+	// such as with a temporary file warning, is retried. If zero, temporary
+	// file warnings are suppressed instead. When the retries are exhausted,
+	// the compilation fails with a *RetryError.
+	Retries int
+
+	// RetryBackoff is the wait before the first retry, doubled for every
+	// further retry. If zero, DefaultRetryBackoff is used.
+	RetryBackoff time.Duration
+
+	// DryRun plans the compilation without running the compiler or writing
+	// files. The configuration is validated and templates are discovered,
+	// and the result reports the planned compiler invocations and the files
+	// that would be written or overwritten.
+	DryRun bool
+
+	// Qtc specifies the qtc binary used by the exec backend, either a path
+	// or a command name looked up in PATH. If empty, "qtc" is used.
+	Qtc string
+
+	// Coverage instruments the generated code with counters for every
+	// template block, such as func bodies, if and else branches, loop
+	// bodies and switch cases. The counters are collected by the
+	// qtcwrapcover package, so the module of the templates must require
+	// this module, and reported with ReadCoverage. Instrumentation keeps
+	// the line layout of the generated code, so line comments and source
+	// maps stay valid.
+	Coverage bool
 }
 
 // QtcWrap executes the qtc compiler with default configuration.
@@ -73,12 +170,7 @@ type Config struct {
 //
 //	QtcWrap()  // Compiles all .qtpl files in current directory
 func QtcWrap() {
-	WithConfig(Config{
-		Dir:              ".",
-		SkipLineComments: true,
-		Ext:              "",
-		File:             "",
-	})
+	WithConfig(GetDefaultConfig())
 }
 
 // WithConfig executes the qtc compiler with the specified configuration.
@@ -123,31 +215,353 @@ func QtcWrap() {
 //	}
 //	WithConfig(config)
 func WithConfig(config Config) {
-	// Validate qtc tool availability
-	if err := validateQtcTool(); err != nil {
-		fmt.Printf("qtc tool validation failed: %v\n", err)
-		return
+	compiler := New(FromConfig(config), WithLogger(stdoutLogger{}))
+	config = compiler.Config()
+
+	// Validate qtc tool availability; dry runs do not start qtc
+	if !config.DryRun {
+		if err := validateBackend(config); err != nil {
+			fmt.Printf("qtc tool validation failed: %v\n", err)
+			return
+		}
+	}
+
+	// Compile templates and report the outcome
+	result, err := compiler.Compile(context.Background())
+	if result != nil && config.DryRun {
+		PrintDryRun(os.Stdout, result)
+	}
+
+	var qtcErr *QtcError
+	var retryErr *RetryError
+	switch {
+	case errors.As(err, &retryErr):
+		fmt.Println(err)
+	case errors.As(err, &qtcErr):
+		handleQtcError(qtcErr.Stderr, qtcErr.Err)
+	case err != nil:
+		fmt.Println(err)
 	}
+}
 
-	// Build command arguments based on configuration
-	args := buildArgs(config)
+// stdoutLogger is the Logger used by WithConfig. It prints every message on
+// a line of its own.
+type stdoutLogger struct{}
 
-	// Execute qtc command
-	executeQtc(args)
+// Printf implements Logger.
+func (stdoutLogger) Printf(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
 }
 
-// validateQtcTool checks if the qtc command is available in the system PATH.
+// Result describes the outcome of a template compilation.
+//
+// Paths are reported the same way they were supplied in the Config, so
+// relative configurations produce relative paths.
+type Result struct {
+	// Templates lists the template files that were compiled.
+	Templates []string
+
+	// Generated lists the Go files written by the compilation.
+	// Generated[i] holds the code of Templates[i].
+	Generated []string
+
+	// Warnings lists qtc warnings that were suppressed, such as
+	// temporary file warnings.
+	Warnings []string
+
+	// Diagnostics lists problems found in the templates: template errors
+	// reported by the compiler and problems found in the generated code.
+	Diagnostics []Diagnostic
+
+	// Cached lists the generated files that were restored from the build
+	// cache instead of being compiled.
+	Cached []string
+
+	// Invocations lists the planned compiler runs of a dry run.
+	Invocations []Invocation
+
+	// Overwritten lists the generated files of a dry run that already exist
+	// and would be replaced.
+	Overwritten []string
+
+	// Attempts lists every compiler run of a compilation with retries,
+	// including the failed ones that were retried.
+	Attempts []Attempt
+
+	// EnvOverrides lists the Config fields whose effective value was set
+	// by a QTCWRAP_* environment variable, see EnvPrefix. All other fields
+	// keep the value set in code, by flags or by directives.
+	EnvOverrides []EnvOverride
+}
+
+// QtcError reports a failed qtc invocation.
+//
+// It carries the arguments qtc was started with and everything it wrote to
+// stderr, so callers can present the compiler's own diagnostics.
+type QtcError struct {
+	// Args holds the command-line arguments passed to qtc.
+	Args []string
+
+	// Stderr holds the output qtc wrote to stderr.
+	Stderr string
+
+	// Err is the underlying execution error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *QtcError) Error() string {
+	if msg := strings.TrimSpace(e.Stderr); msg != "" {
+		return fmt.Sprintf("qtc execution failed: %v: %s", e.Err, msg)
+	}
+	return fmt.Sprintf("qtc execution failed: %v", e.Err)
+}
+
+// Unwrap returns the underlying execution error.
+func (e *QtcError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the failure is a temporary file warning.
+//
+// Temporary file warnings are suppressed by WithConfig and Compile instead
+// of being reported as compilation errors.
+func (e *QtcError) Temporary() bool {
+	return isTemporaryFileWarning([]byte(e.Stderr))
+}
+
+// Compile executes the qtc compiler with the specified configuration and
+// returns the outcome instead of printing it.
+//
+// It follows the same semantics as WithConfig: File takes precedence over
+// Dir and Ext, and temporary file warnings are suppressed and reported in
+// Result.Warnings. When OutputDir is set, templates are compiled in a staging
+// area and the generated files are moved into OutputDir; nothing is moved if
+// qtc fails. When Atomic is set, in-place compilation gets the same
+// all-or-nothing guarantee. With SourceMaps, a source map side file is
+// written for every generated file. With PostBuildCheck, the generated
+// packages are type-checked and a *CheckError is returned if they do not
+// compile. With CacheDir, generated files are restored from the build cache
+// when possible and listed in Result.Cached. Version constraints are checked
+// with CheckQtcVersion before anything is compiled. With DryRun, nothing is
+// compiled: Result.Generated lists the files that would be written and
+// Result.Invocations the planned compiler runs. Concurrent compilations of
+// overlapping directories, such as the same template directory or a
+// directory and its parent, are serialized, also across processes; see
+// Compiler.
+//
+// Example:
+//
+//	result, err := Compile(Config{Dir: "templates", OutputDir: "gen"})
+//	if err != nil {
+//	    fmt.Printf("Compilation failed: %v\n", err)
+//	    return
+//	}
+//	fmt.Printf("Generated %d files\n", len(result.Generated))
+func Compile(config Config) (*Result, error) {
+	return NewCompiler(config).Compile(context.Background())
+}
+
+// compileContext implements Compile. It waits for concurrent compilations
+// of overlapping directories until ctx is done.
+func compileContext(ctx context.Context, config Config) (*Result, error) {
+	if config.DryRun {
+		return dryRun(config)
+	}
+
+	if err := CheckQtcVersion(config); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockDirs(ctx, compileDirs(config))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	compile := compileInstrumented
+	if config.CacheDir != "" {
+		compile = compileCached
+	}
+
+	result, err := compile(ctx, config)
+	if err != nil {
+		return result, err
+	}
+
+	if config.SourceMaps {
+		if err := writeSourceMaps(result, config.SkipLineComments); err != nil {
+			return result, err
+		}
+	}
+
+	if config.PostBuildCheck {
+		diagnostics, err := postBuildCheck(result, config.SkipLineComments)
+		result.Diagnostics = append(result.Diagnostics, diagnostics...)
+		if err != nil {
+			return result, err
+		}
+		if len(diagnostics) > 0 {
+			return result, &CheckError{Diagnostics: diagnostics}
+		}
+	}
+	return result, nil
+}
+
+// compileEach compiles the templates selected by each configuration, such
+// as the files of a package compiled one at a time. Every configuration is
+// compiled even if an earlier one fails; the failures are joined into the
+// returned error.
+//
+// With PostBuildCheck, the packages that received generated code are
+// type-checked once, after every configuration was compiled, so templates
+// calling funcs of templates compiled later do not fail. Nothing is
+// type-checked if any compilation failed.
+func compileEach(ctx context.Context, configs []Config) (*Result, error) {
+	merged := &Result{}
+	var errs []error
+	var dirs []string
+	check := false
+	for _, config := range configs {
+		check = check || (config.PostBuildCheck && !config.DryRun)
+		dirs = append(dirs, compileDirs(config)...)
+
+		config.PostBuildCheck = false
+		result, err := compileContext(ctx, config)
+		mergeResult(merged, result)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !check || len(errs) > 0 {
+		return merged, errors.Join(errs...)
+	}
+
+	unlock, err := lockDirs(ctx, dirs)
+	if err != nil {
+		return merged, err
+	}
+	defer unlock()
+
+	diagnostics, err := postBuildCheck(merged, configs[0].SkipLineComments)
+	merged.Diagnostics = append(merged.Diagnostics, diagnostics...)
+	if err != nil {
+		return merged, err
+	}
+	if len(diagnostics) > 0 {
+		return merged, &CheckError{Diagnostics: diagnostics}
+	}
+	return merged, nil
+}
+
+// compileInstrumented compiles the templates and, with Coverage, injects
+// coverage counters into the generated files.
+func compileInstrumented(ctx context.Context, config Config) (*Result, error) {
+	result, err := compileTemplates(ctx, config)
+	if err != nil || !config.Coverage {
+		return result, err
+	}
+	return result, instrumentCoverage(result, config.SkipLineComments)
+}
+
+// compileTemplates dispatches the compilation to the mode selected by the
+// configuration.
+func compileTemplates(ctx context.Context, config Config) (*Result, error) {
+	if config.OutputDir != "" {
+		return compileToOutputDir(ctx, config)
+	}
+	if config.Atomic {
+		return compileAtomic(ctx, config)
+	}
+
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Templates: templates}
+	if err := runCompiler(ctx, config, result); err != nil {
+		return result, err
+	}
+
+	for _, template := range templates {
+		result.Generated = append(result.Generated, template+".go")
+	}
+	return result, nil
+}
+
+// runCompiler compiles templates in place with the configured backend and
+// records suppressed warnings and template errors in the result.
+//
+// Without retries, temporary file warnings are suppressed. With retries,
+// transient failures are retried instead and fail the compilation once the
+// retries are exhausted.
+func runCompiler(ctx context.Context, config Config, result *Result) error {
+	var err error
+	if config.Retries > 0 {
+		err = runWithRetries(ctx, config, result)
+	} else {
+		err = runBackend(ctx, config)
+	}
+
+	var qtcErr *QtcError
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) && errors.As(err, &qtcErr) && qtcErr.Temporary() {
+		result.Warnings = append(result.Warnings, qtcErr.Stderr)
+		return nil
+	}
+	if err != nil {
+		result.Diagnostics = append(result.Diagnostics, compileDiagnostics(err)...)
+	}
+	return err
+}
+
+// configTemplates lists the template files selected by the configuration.
+//
+// In single file mode this is the file itself; in directory mode the
+// directory is searched the same way qtc does.
+func configTemplates(config Config) ([]string, error) {
+	if config.File != "" {
+		return []string{config.File}, nil
+	}
+
+	dir := config.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return FindTemplateFiles(dir, config.Ext)
+}
+
+// validateQtcTool checks if the qtc binary is available: a path must
+// point to an executable, a command name must be found in the system PATH.
 //
 // This function attempts to locate the qtc executable to ensure it's available
 // before attempting to run template compilation.
 //
 // Returns an error if qtc is not found or not executable.
-func validateQtcTool() error {
-	_, err := exec.LookPath("qtc")
-	if err != nil {
+func validateQtcTool(binary string) error {
+	_, err := exec.LookPath(binary)
+	if err == nil {
+		return nil
+	}
+	if binary == defaultQtcBinary {
 		return fmt.Errorf("qtc command not found in PATH: %w", err)
 	}
-	return nil
+	return fmt.Errorf("qtc binary %s not found: %w", binary, err)
+}
+
+// qtcBinary returns the qtc binary selected by the configuration.
+func qtcBinary(config Config) string {
+	if config.Qtc != "" {
+		return config.Qtc
+	}
+	return defaultQtcBinary
+}
+
+// envQtcBinary returns the qtc binary selected by the environment, for
+// functions that do not take a configuration.
+func envQtcBinary() string {
+	return qtcBinary(Config{Qtc: os.Getenv(EnvPrefix + "QTC")})
 }
 
 // buildArgs constructs command-line arguments for the qtc tool based on configuration.
@@ -185,16 +599,20 @@ func buildArgs(config Config) []string {
 // This function handles the actual execution of the qtc tool, including:
 // - Setting up proper stdout/stderr handling
 // - Executing the command with security considerations
-// - Processing errors and warnings
-// - Suppressing common temporary file warnings
+// - Capturing stderr for error reporting
 //
-// The function uses proper error handling to distinguish between temporary
-// file warnings (which are suppressed) and actual compilation errors.
-func executeQtc(args []string) {
+// Returns a *QtcError if qtc fails. Callers decide whether the failure is a
+// temporary file warning that should be suppressed.
+func executeQtc(args []string) error {
+	return executeQtcContext(context.Background(), defaultQtcBinary, args)
+}
+
+// executeQtcContext runs binary like executeQtc and kills it once ctx is
+// done.
+func executeQtcContext(ctx context.Context, binary string, args []string) error {
 	// Create command with security considerations
-	// #nosec G204 -- args are constructed internally from validated config; safe from injection
-	// nolint:noctx
-	cmd := exec.Command("qtc", args...)
+	// #nosec G204 -- the binary is configured by the caller and args are constructed internally from validated config
+	cmd := exec.CommandContext(ctx, binary, args...)
 
 	// Set up output handling
 	cmd.Stdout = os.Stdout
@@ -203,31 +621,20 @@ func executeQtc(args []string) {
 
 	// Execute command
 	if err := cmd.Run(); err != nil {
-		handleQtcError(stderr, err)
+		return &QtcError{Args: args, Stderr: stderr.String(), Err: err}
 	}
+	return nil
 }
 
-// handleQtcError processes errors from qtc execution.
-//
-// This function analyzes stderr output to distinguish between:
-// - Temporary file warnings (suppressed with informative message)
-// - Actual compilation errors (reported to user)
-// - Tool execution errors (reported to user)
-//
-// The function implements intelligent error filtering to reduce noise
-// while preserving important error information.
-func handleQtcError(stderr bytes.Buffer, err error) {
-	msg := stderr.String()
-
-	// Check if this is a temporary file warning that should be suppressed
-	if isTemporaryFileWarning(stderr.Bytes()) {
-		fmt.Printf("[qtc warning suppressed] %s\n", msg)
-		return
-	}
-
-	// Handle actual errors
-	if msg != "" {
-		fmt.Print(msg)
+// handleQtcError reports a failed qtc execution to the user.
+//
+// The stderr output of qtc is printed when there is any, since it holds
+// the template errors; otherwise the execution error is printed.
+// Temporary file warnings are filtered out before qtc failures reach this
+// point.
+func handleQtcError(stderr string, err error) {
+	if stderr != "" {
+		fmt.Print(stderr)
 	} else {
 		fmt.Printf("qtc execution failed: %v\n", err)
 	}
@@ -268,12 +675,7 @@ func isTemporaryFileWarning(stderr []byte) bool {
 //	config.Ext = ".qtpl"
 //	WithConfig(config)
 func GetDefaultConfig() Config {
-	return Config{
-		Dir:              ".",
-		SkipLineComments: true,
-		Ext:              "",
-		File:             "",
-	}
+	return defaultConfig()
 }
 
 // CompileDirectory compiles all template files in the specified directory.
@@ -337,6 +739,8 @@ func CompileWithExtension(dir, ext string) {
 // This function can be used to verify qtc availability before attempting
 // compilation, allowing for graceful degradation or alternative approaches.
 //
+// The binary can be changed with the QTCWRAP_QTC environment variable.
+//
 // Returns true if qtc is available, false otherwise.
 //
 // Example:
@@ -347,16 +751,19 @@ func CompileWithExtension(dir, ext string) {
 //	    fmt.Println("qtc not available, skipping template compilation")
 //	}
 func IsQtcAvailable() bool {
-	return validateQtcTool() == nil
+	return validateQtcTool(envQtcBinary()) == nil
 }
 
 // GetQtcVersion returns the version of the qtc tool if available.
 //
 // This function executes 'qtc -version' to retrieve version information,
-// which can be useful for compatibility checks or debugging.
+// which can be useful for compatibility checks or debugging. Releases of
+// qtc that do not support the flag are identified by the quicktemplate
+// module version recorded in the build information of the binary. The
+// binary can be changed with the QTCWRAP_QTC environment variable.
 //
 // Returns the version string or an error if qtc is not available or
-// the version cannot be determined.
+// the version cannot be determined. Use ParseVersion to interpret it.
 //
 // Example:
 //
@@ -367,18 +774,32 @@ func IsQtcAvailable() bool {
 //	    fmt.Printf("Using qtc version: %s\n", version)
 //	}
 func GetQtcVersion() (string, error) {
-	if err := validateQtcTool(); err != nil {
+	return qtcVersion(envQtcBinary())
+}
+
+// qtcVersion implements GetQtcVersion for the given qtc binary.
+func qtcVersion(binary string) (string, error) {
+	if err := validateQtcTool(binary); err != nil {
 		return "", err
 	}
 
+	// #nosec G204 -- the binary is configured by the caller and takes no other input
 	// nolint:noctx
-	cmd := exec.Command("qtc", "-version")
+	cmd := exec.Command(binary, "-version")
 	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to get qtc version: %w", err)
+	if err == nil {
+		return strings.TrimSpace(string(output)), nil
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	path, lookErr := exec.LookPath(binary)
+	if lookErr != nil {
+		return "", fmt.Errorf("failed to get qtc version: %w", err)
+	}
+	version, buildErr := qtcBuildVersion(path)
+	if buildErr != nil {
+		return "", fmt.Errorf("failed to get qtc version: %w", errors.Join(err, buildErr))
+	}
+	return version, nil
 }
 
 // ValidateConfig checks if the provided configuration is valid.
@@ -389,8 +810,17 @@ func GetQtcVersion() (string, error) {
 // Validation rules:
 // - If File is specified, it must exist and be readable
 // - If Dir is specified, it must exist and be a directory
-// - Ext should start with a dot if specified
+// - Every extension listed in Ext should start with a dot
 // - File and Dir cannot both be empty
+// - If OutputDir is specified and exists, it must be a directory
+// - Backend must be empty, ExecBackend or EmbeddedBackend
+// - MinQtcVersion and MaxQtcVersion must be valid versions in order
+// - Retries and RetryBackoff must not be negative
+// - If Qtc is specified for the exec backend, the binary must exist
+//
+// The configuration is validated with the overrides of the environment
+// applied, see EnvPrefix. Errors about a value set by an environment
+// variable name the variable, such as "(set by QTCWRAP_DIR)".
 //
 // Returns an error if the configuration is invalid.
 //
@@ -403,12 +833,84 @@ func GetQtcVersion() (string, error) {
 //	}
 //	WithConfig(config)
 func ValidateConfig(config Config) error {
+	config, err := ApplyEnv(config)
+	if err != nil {
+		return err
+	}
+
+	err = validateConfig(config)
+	var fieldErr *fieldError
+	if !errors.As(err, &fieldErr) {
+		return err
+	}
+	if source := envSource(fieldErr.field); source != "" {
+		return fmt.Errorf("%w (set by %s)", fieldErr.err, source)
+	}
+	return fieldErr.err
+}
+
+// fieldError reports an invalid value of a Config field.
+type fieldError struct {
+	// field is the name of the Config field.
+	field string
+
+	// err describes the problem.
+	err error
+}
+
+// Error implements the error interface.
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// invalidField returns a *fieldError for field, or nil if err is nil.
+func invalidField(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fieldError{field: field, err: err}
+}
+
+// validateConfig implements ValidateConfig for a configuration with the
+// environment already applied. Problems with a single field are reported
+// as *fieldError.
+func validateConfig(config Config) error {
+	// Validate retry settings
+	if config.Retries < 0 {
+		return invalidField("Retries", fmt.Errorf("retries must not be negative: %d", config.Retries))
+	}
+	if config.RetryBackoff < 0 {
+		return invalidField("RetryBackoff", fmt.Errorf("retry backoff must not be negative: %s", config.RetryBackoff))
+	}
+
+	// Validate backend selection
+	switch config.Backend {
+	case "", ExecBackend:
+		if config.Qtc != "" {
+			if err := validateQtcTool(config.Qtc); err != nil {
+				return invalidField("Qtc", err)
+			}
+		}
+	case EmbeddedBackend:
+	default:
+		return invalidField("Backend", fmt.Errorf("unknown backend %q", config.Backend))
+	}
+
+	if err := validateVersionRange(config.MinQtcVersion, config.MaxQtcVersion); err != nil {
+		return err
+	}
+
 	// Validate file mode
 	if config.File != "" {
 		if _, err := os.Stat(config.File); err != nil {
-			return fmt.Errorf("file %s is not accessible: %w", config.File, err)
+			return invalidField("File", fmt.Errorf("file %s is not accessible: %w", config.File, err))
 		}
-		return nil
+		return invalidField("OutputDir", validateOutputDir(config.OutputDir))
 	}
 
 	// Validate directory mode
@@ -418,16 +920,57 @@ func ValidateConfig(config Config) error {
 
 	// Check if directory exists
 	if info, err := os.Stat(config.Dir); err != nil {
-		return fmt.Errorf("directory %s is not accessible: %w", config.Dir, err)
+		return invalidField("Dir", fmt.Errorf("directory %s is not accessible: %w", config.Dir, err))
 	} else if !info.IsDir() {
-		return fmt.Errorf("%s is not a directory", config.Dir)
+		return invalidField("Dir", fmt.Errorf("%s is not a directory", config.Dir))
 	}
 
 	// Validate extension format
-	if config.Ext != "" && !strings.HasPrefix(config.Ext, ".") {
-		return fmt.Errorf("extension must start with a dot: %s", config.Ext)
+	if err := validateExt(config.Ext); err != nil {
+		return invalidField("Ext", err)
+	}
+
+	return invalidField("OutputDir", validateOutputDir(config.OutputDir))
+}
+
+// validateVersionRange checks that the configured version bounds parse and
+// do not exclude each other.
+func validateVersionRange(minVersion, maxVersion string) error {
+	var low, high Version
+	var err error
+	if minVersion != "" {
+		if low, err = ParseVersion(minVersion); err != nil {
+			return invalidField("MinQtcVersion", fmt.Errorf("invalid minimum qtc version: %w", err))
+		}
+	}
+	if maxVersion != "" {
+		if high, err = ParseVersion(maxVersion); err != nil {
+			return invalidField("MaxQtcVersion", fmt.Errorf("invalid maximum qtc version: %w", err))
+		}
+	}
+	if minVersion != "" && maxVersion != "" && low.Compare(high) > 0 {
+		return invalidField("MinQtcVersion", fmt.Errorf("minimum qtc version %s is greater than maximum version %s", low, high))
+	}
+	return nil
+}
+
+// validateOutputDir checks that an output directory, if it already exists,
+// is a directory. Missing output directories are created during compilation.
+func validateOutputDir(dir string) error {
+	if dir == "" {
+		return nil
 	}
 
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("output directory %s is not accessible: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("output path %s is not a directory", dir)
+	}
 	return nil
 }
 
@@ -451,9 +994,13 @@ func CompileWithValidation(config Config) error {
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
 
-	// Validate qtc tool
-	if err := validateQtcTool(); err != nil {
-		return fmt.Errorf("qtc tool validation failed: %w", err)
+	// Validate the qtc tool of the effective configuration, with the
+	// environment applied; dry runs do not start qtc
+	effective := NewCompiler(config).Config()
+	if !effective.DryRun {
+		if err := validateBackend(effective); err != nil {
+			return fmt.Errorf("qtc tool validation failed: %w", err)
+		}
 	}
 
 	// Compile templates
@@ -468,7 +1015,11 @@ func CompileWithValidation(config Config) error {
 //
 // Parameters:
 // - dir: Directory to search in
-// - ext: File extension to filter by (optional, defaults to ".qtpl")
+// - ext: File extensions to filter by, separated by commas (optional, defaults to ".qtpl")
+//
+// A file matches if its name ends with one of the extensions, with a leading
+// dot added where missing, so "qtpl" matches "home.qtpl" but not
+// "home.xqtpl".
 //
 // Returns a slice of file paths or an error if the directory cannot be accessed.
 //
@@ -484,16 +1035,14 @@ func CompileWithValidation(config Config) error {
 //	    }
 //	}
 func FindTemplateFiles(dir, ext string) ([]string, error) {
-	if ext == "" {
-		ext = ".qtpl"
-	}
+	exts := templateExts(ext)
 
 	var files []string
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && strings.HasSuffix(path, ext) {
+		if !info.IsDir() && hasTemplateExt(info.Name(), exts) {
 			files = append(files, path)
 		}
 		return nil
@@ -5,9 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/valksor/go-qtcwrap/internal/fakeqtc"
 )
 
 const (
@@ -182,13 +186,18 @@ func TestGetDefaultConfig(t *testing.T) {
 
 func TestValidateQtcTool(t *testing.T) {
 	t.Run("ValidateQtcTool", func(t *testing.T) {
-		err := validateQtcTool()
+		err := validateQtcTool(defaultQtcBinary)
 
 		// This test will pass if qtc is available, skip if not
 		if err != nil {
 			t.Skipf("qtc tool not available: %v", err)
 		}
 	})
+
+	t.Run("MissingBinary", func(t *testing.T) {
+		binary := filepath.Join(t.TempDir(), "qtc")
+		assertValidationError(t, validateQtcTool(binary), binary, true)
+	})
 }
 
 func TestIsQtcAvailable(t *testing.T) {
@@ -741,11 +750,6 @@ func TestHandleQtcError(t *testing.T) {
 		stderr         string
 		expectedOutput string
 	}{
-		{
-			name:           "TemporaryFileWarning",
-			stderr:         "open .tmp/test.qtpl: no such file or directory",
-			expectedOutput: "[qtc warning suppressed]",
-		},
 		{
 			name:           "ActualError",
 			stderr:         syntaxErrorMsg,
@@ -761,7 +765,6 @@ func TestHandleQtcError(t *testing.T) {
 	for _, testT := range tests {
 		t.Run(testT.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			stderr := bytes.NewBufferString(testT.stderr)
 			err := errors.New("exit status 1")
 
 			// Capture output by temporarily redirecting stdout
@@ -769,7 +772,7 @@ func TestHandleQtcError(t *testing.T) {
 			rFile, wFile, _ := os.Pipe()
 			os.Stdout = wFile
 
-			handleQtcError(*stderr, err)
+			handleQtcError(testT.stderr, err)
 
 			if err := wFile.Close(); err != nil {
 				t.Fatalf(closeWriterErr, err)
@@ -789,55 +792,172 @@ func TestHandleQtcError(t *testing.T) {
 	}
 }
 
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	rFile, wFile, _ := os.Pipe()
+	os.Stdout = wFile
+
+	done := make(chan error)
+	go func() {
+		_, err := buf.ReadFrom(rFile)
+		done <- err
+	}()
+
+	fn()
+
+	if err := wFile.Close(); err != nil {
+		t.Fatalf(closeWriterErr, err)
+	}
+	os.Stdout = oldStdout
+	if err := <-done; err != nil {
+		t.Fatalf(readFromPipeErr, err)
+	}
+	return buf.String()
+}
+
 func TestExecuteQtc(t *testing.T) {
-	t.Run("ExecuteQtcWithInvalidArgs", func(t *testing.T) {
-		// Test with invalid arguments that should fail
-		args := []string{"-invalid-flag"}
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+	fake := fakeqtc.Build(t, fakeqtc.Script{})
+	fake.Install(t)
 
-		// Capture output
-		var buf bytes.Buffer
-		oldStdout := os.Stdout
-		rFile, wFile, _ := os.Pipe()
-		os.Stdout = wFile
+	tests := []struct {
+		name           string
+		script         fakeqtc.Script
+		expectedStdout string
+		expectedStderr string
+		expectedCode   int
+	}{
+		{
+			name:           "Success",
+			script:         fakeqtc.Script{Stdout: "compiled\n"},
+			expectedStdout: "compiled\n",
+		},
+		{
+			name:           "Failure",
+			script:         fakeqtc.Script{Stderr: syntaxErrorMsg, ExitCode: 1},
+			expectedStderr: syntaxErrorMsg,
+			expectedCode:   1,
+		},
+		{
+			name:           "FailureWithoutStderr",
+			script:         fakeqtc.Script{ExitCode: 2},
+			expectedStderr: "",
+			expectedCode:   2,
+		},
+	}
 
-		executeQtc(args)
+	for _, testT := range tests {
+		t.Run(testT.name, func(t *testing.T) {
+			fake.SetScript(t, testT.script)
+			fake.Reset(t)
+			args := []string{dirTemplatesArg, skipCommentsArg}
 
-		if err := wFile.Close(); err != nil {
-			t.Fatalf(closeWriterErr, err)
-		}
-		os.Stdout = oldStdout
-		if _, err := buf.ReadFrom(rFile); err != nil {
-			t.Fatalf(readFromPipeErr, err)
-		}
+			var err error
+			stdout := captureStdout(t, func() {
+				err = executeQtc(args)
+			})
 
-		// The function should handle the error gracefully
-		// We can't test much more without qtc being available
-	})
+			if stdout != testT.expectedStdout {
+				t.Errorf("Expected qtc stdout %q to be passed through, got %q", testT.expectedStdout, stdout)
+			}
+
+			var qtcErr *QtcError
+			switch {
+			case testT.expectedCode == 0 && err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case testT.expectedCode != 0 && !errors.As(err, &qtcErr):
+				t.Errorf("Expected QtcError, got %v", err)
+			case testT.expectedCode != 0:
+				var exitErr *exec.ExitError
+				if !errors.As(qtcErr, &exitErr) || exitErr.ExitCode() != testT.expectedCode {
+					t.Errorf("Expected exit code %d, got %v", testT.expectedCode, qtcErr.Err)
+				}
+				if qtcErr.Stderr != testT.expectedStderr {
+					t.Errorf("Expected stderr %q, got %q", testT.expectedStderr, qtcErr.Stderr)
+				}
+				if !reflect.DeepEqual(qtcErr.Args, args) {
+					t.Errorf("Expected args %v in error, got %v", args, qtcErr.Args)
+				}
+			}
+
+			calls := fake.Calls(t)
+			if len(calls) != 1 || !reflect.DeepEqual(calls[0].Args, args) {
+				t.Errorf("Expected qtc to be run once with %v, got %v", args, calls)
+			}
+		})
+	}
 }
 
 func TestWithConfig(t *testing.T) {
-	t.Run("WithValidConfig", func(t *testing.T) {
-		// Create a temporary directory for testing
-		tempDir, err := os.MkdirTemp("", "qtcwrap_test")
-		if err != nil {
-			t.Fatalf(createTempDirErr, err)
-		}
-		defer func() {
-			if err := os.RemoveAll(tempDir); err != nil {
-				t.Fatalf(removeTempDirErr, err)
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+	fake := fakeqtc.Build(t, fakeqtc.Script{})
+	fake.Install(t)
+
+	tests := []struct {
+		name           string
+		script         fakeqtc.Script
+		expectedOutput string
+		generated      bool
+	}{
+		{
+			name:      "Success",
+			script:    fakeqtc.Script{Generate: true},
+			generated: true,
+		},
+		{
+			name:           "CompilationError",
+			script:         fakeqtc.Script{Stderr: syntaxErrorMsg, ExitCode: 1},
+			expectedOutput: syntaxErrorMsg,
+		},
+		{
+			name:           "TemporaryFileWarning",
+			script:         fakeqtc.Script{Generate: true, Stderr: "open .tmp/test.qtpl: no such file or directory", ExitCode: 1},
+			expectedOutput: "[qtc warning suppressed]",
+			generated:      true,
+		},
+	}
+
+	for _, testT := range tests {
+		t.Run(testT.name, func(t *testing.T) {
+			fake.SetScript(t, testT.script)
+			fake.Reset(t)
+			tempDir := t.TempDir()
+			createTempTestFile(t, tempDir, testContent)
+
+			config := Config{
+				Dir:              tempDir,
+				SkipLineComments: true,
+				Ext:              qtplExt,
 			}
-		}()
+			output := captureStdout(t, func() {
+				WithConfig(config)
+			})
 
-		config := Config{
-			Dir:              tempDir,
-			SkipLineComments: true,
-			Ext:              "",
-			File:             "",
-		}
+			if testT.expectedOutput == "" && output != "" {
+				t.Errorf("Expected no output, got %q", output)
+			}
+			if !strings.Contains(output, testT.expectedOutput) {
+				t.Errorf("Expected output to contain %q, got %q", testT.expectedOutput, output)
+			}
 
-		// This should not panic
-		WithConfig(config)
-	})
+			_, err := os.Stat(filepath.Join(tempDir, testQtplFile+goExt))
+			if generated := err == nil; generated != testT.generated {
+				t.Errorf("Expected generated file: %v, got %v", testT.generated, generated)
+			}
+
+			expected := []string{"-dir=" + tempDir, "-ext=" + qtplExt, skipCommentsArg}
+			calls := fake.Calls(t)
+			if len(calls) != 1 || !reflect.DeepEqual(calls[0].Args, expected) {
+				t.Errorf("Expected qtc to be run once with %v, got %v", expected, calls)
+			}
+		})
+	}
 }
 
 func TestConfigPrecedence(t *testing.T) {
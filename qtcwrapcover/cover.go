@@ -0,0 +1,216 @@
+// Package qtcwrapcover collects the template coverage counters injected by
+// qtcwrap into generated code compiled with Config.Coverage.
+//
+// Instrumented code registers the blocks of its template when the package
+// is initialized and counts every execution of a block. The counters are
+// written as a cover profile, such as from TestMain, and turned into a
+// report with "qtcwrap cover".
+//
+// It supports:
+// - Counting template block executions safely from concurrent handlers
+// - Writing counters in a cover-profile format keyed by template lines
+// - Writing one profile per test binary into a directory named by QTCWRAP_COVERDIR
+//
+// Example:
+//
+//	func TestMain(m *testing.M) {
+//	    os.Exit(qtcwrapcover.RunTests(m))
+//	}
+//
+// Run "QTCWRAP_COVERDIR=cover go test ./..." and then
+// "qtcwrap cover -html cover.html cover" to see which template lines the
+// tests rendered.
+//
+// The package has no dependencies outside the standard library, since it
+// is linked into every binary built from instrumented code.
+package qtcwrapcover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EnvDir is the environment variable naming the directory RunTests writes
+// profiles to.
+const EnvDir = "QTCWRAP_COVERDIR"
+
+// Block is a run of consecutive template lines executed together.
+type Block struct {
+	// StartLine and EndLine are the first and last template line of the
+	// block, both inclusive.
+	StartLine int
+	EndLine   int
+}
+
+// Counters counts the executions of the blocks of one template.
+type Counters struct {
+	// template is the template name recorded in profiles.
+	template string
+
+	// blocks lists the blocks of the template.
+	blocks []Block
+
+	// counts holds the number of executions of each block.
+	counts []atomic.Uint32
+}
+
+// registry holds the counters of every instrumented template linked into
+// the binary, in registration order.
+var registry struct {
+	sync.Mutex
+	counters []*Counters
+}
+
+// Register registers the blocks of a template and returns their counters.
+// It is called by instrumented code during package initialization; the
+// template is named by its import path, such as
+// "example.com/app/templates/home.qtpl", or by its absolute path outside a
+// module.
+func Register(template string, blocks []Block) *Counters {
+	c := &Counters{
+		template: template,
+		blocks:   blocks,
+		counts:   make([]atomic.Uint32, len(blocks)),
+	}
+	registry.Lock()
+	registry.counters = append(registry.counters, c)
+	registry.Unlock()
+	return c
+}
+
+// Hit counts an execution of the blocks first to last, both inclusive. It
+// is safe for concurrent use.
+func (c *Counters) Hit(first, last int) {
+	for i := first; i <= last && i < len(c.counts); i++ {
+		c.counts[i].Add(1)
+	}
+}
+
+// Profile is a snapshot of the counters of a template.
+type Profile struct {
+	// Template is the template name given to Register.
+	Template string
+
+	// Blocks lists the blocks of the template.
+	Blocks []Block
+
+	// Counts holds the number of executions of each block.
+	Counts []uint32
+}
+
+// Profiles returns a snapshot of the counters of every registered template.
+func Profiles() []Profile {
+	registry.Lock()
+	defer registry.Unlock()
+
+	profiles := make([]Profile, 0, len(registry.counters))
+	for _, c := range registry.counters {
+		profile := Profile{Template: c.template, Blocks: c.blocks, Counts: make([]uint32, len(c.counts))}
+		for i := range c.counts {
+			profile.Counts[i] = c.counts[i].Load()
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+// Reset sets all counters to zero.
+func Reset() {
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, c := range registry.counters {
+		for i := range c.counts {
+			c.counts[i].Store(0)
+		}
+	}
+}
+
+// WriteProfile writes the counters in the format of Go cover profiles:
+//
+//	mode: count
+//	example.com/app/templates/home.qtpl:3.1,6.1 3 12
+//
+// Every line holds a block, spanning from the start of its first template
+// line to the start of the line after its last one, the number of template
+// lines of the block and its execution count.
+func WriteProfile(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "mode: count")
+	for _, profile := range Profiles() {
+		for i, block := range profile.Blocks {
+			fmt.Fprintf(bw, "%s:%d.1,%d.1 %d %d\n", profile.Template, block.StartLine, block.EndLine+1, block.EndLine-block.StartLine+1, profile.Counts[i])
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot write coverage profile: %w", err)
+	}
+	return nil
+}
+
+// WriteFile writes the counters to a profile file, replacing it if it
+// exists.
+//
+// Example:
+//
+//	if err := qtcwrapcover.WriteFile("templates.cover"); err != nil {
+//	    fmt.Printf("Cannot write template coverage: %v\n", err)
+//	}
+func WriteFile(path string) error {
+	f, err := os.Create(path) // #nosec G304 -- the profile path is chosen by the caller
+	if err != nil {
+		return fmt.Errorf("cannot create coverage profile: %w", err)
+	}
+	if err := WriteProfile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write coverage profile %s: %w", path, err)
+	}
+	return nil
+}
+
+// WriteDir writes the counters to a new profile file in dir and returns its
+// path. File names are unique per process, so every test binary of
+// "go test ./..." can write to the same directory.
+func WriteDir(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("cannot create coverage directory: %w", err)
+	}
+	name := "qtcwrapcover." + strconv.Itoa(os.Getpid()) + "." + strconv.FormatInt(time.Now().UnixNano(), 10) + ".out"
+	path := filepath.Join(dir, name)
+	return path, WriteFile(path)
+}
+
+// RunTests runs the tests of m, usually a *testing.M, and writes the
+// counters to the directory named by QTCWRAP_COVERDIR, if it is set. It
+// returns the exit code for os.Exit; a profile that cannot be written
+// fails the run.
+//
+// Example:
+//
+//	func TestMain(m *testing.M) {
+//	    os.Exit(qtcwrapcover.RunTests(m))
+//	}
+func RunTests(m interface{ Run() int }) int {
+	code := m.Run()
+	dir := os.Getenv(EnvDir)
+	if dir == "" {
+		return code
+	}
+	if _, err := WriteDir(dir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
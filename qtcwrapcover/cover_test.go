@@ -0,0 +1,144 @@
+package qtcwrapcover
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeTests is a stand-in for *testing.M.
+type fakeTests struct {
+	code int
+}
+
+func (m fakeTests) Run() int {
+	return m.code
+}
+
+func TestCountersHit(t *testing.T) {
+	Reset()
+	counters := Register("example.com/app/hit.qtpl", []Block{{StartLine: 1, EndLine: 2}, {StartLine: 4, EndLine: 4}, {StartLine: 6, EndLine: 9}})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counters.Hit(0, 1)
+		}()
+	}
+	wg.Wait()
+	counters.Hit(1, 1)
+	counters.Hit(2, 5)
+
+	profile := findProfile(t, "example.com/app/hit.qtpl")
+	expected := []uint32{10, 11, 1}
+	for i, count := range expected {
+		if profile.Counts[i] != count {
+			t.Errorf("Expected count %d of block %d, got %d", count, i, profile.Counts[i])
+		}
+	}
+
+	Reset()
+	if profile := findProfile(t, "example.com/app/hit.qtpl"); profile.Counts[1] != 0 {
+		t.Errorf("Expected reset counters, got %v", profile.Counts)
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	Reset()
+	counters := Register("example.com/app/profile.qtpl", []Block{{StartLine: 3, EndLine: 5}, {StartLine: 8, EndLine: 8}})
+	counters.Hit(0, 0)
+	counters.Hit(0, 0)
+
+	var buf bytes.Buffer
+	if err := WriteProfile(&buf); err != nil {
+		t.Fatalf("WriteProfile failed: %v", err)
+	}
+
+	got := buf.String()
+	for _, expected := range []string{
+		"mode: count\n",
+		"example.com/app/profile.qtpl:3.1,6.1 3 2\n",
+		"example.com/app/profile.qtpl:8.1,9.1 1 0\n",
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Expected profile to contain %q, got:\n%s", expected, got)
+		}
+	}
+	if !strings.HasPrefix(got, "mode: count\n") {
+		t.Errorf("Expected profile to start with the mode line, got:\n%s", got)
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	Register("example.com/app/run.qtpl", []Block{{StartLine: 1, EndLine: 1}})
+
+	tests := []struct {
+		name     string
+		dir      bool
+		code     int
+		expected int
+		files    int
+	}{
+		{name: "NoDir", code: 0, expected: 0},
+		{name: "Passed", dir: true, code: 0, expected: 0, files: 1},
+		{name: "Failed", dir: true, code: 3, expected: 3, files: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "cover")
+			if tt.dir {
+				t.Setenv(EnvDir, dir)
+			} else {
+				t.Setenv(EnvDir, "")
+			}
+
+			if code := RunTests(fakeTests{code: tt.code}); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, code)
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != tt.files {
+				t.Fatalf("Expected %d profile(s), got %d", tt.files, len(entries))
+			}
+			if tt.files > 0 {
+				data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+				if err != nil {
+					t.Fatalf("Cannot read profile: %v", err)
+				}
+				if !strings.Contains(string(data), "example.com/app/run.qtpl:1.1,2.1 1 ") {
+					t.Errorf("Expected profile to contain the registered template, got:\n%s", data)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTestsWriteError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatalf("Cannot create file: %v", err)
+	}
+	t.Setenv(EnvDir, file)
+
+	if code := RunTests(fakeTests{}); code != 1 {
+		t.Errorf("Expected exit code 1 for an unwritable profile, got %d", code)
+	}
+}
+
+// findProfile returns the profile of a registered template.
+func findProfile(t *testing.T, template string) Profile {
+	t.Helper()
+	for _, profile := range Profiles() {
+		if profile.Template == template {
+			return profile
+		}
+	}
+	t.Fatalf("Template %s is not registered", template)
+	return Profile{}
+}
@@ -0,0 +1,43 @@
+package qtcwraptest
+
+import (
+	"testing"
+
+	"github.com/valksor/go-qtcwrap/internal/fakeqtc"
+)
+
+// QtcScript describes how a fake qtc behaves: its stdout, stderr and exit
+// code, its -version output and the files it generates.
+type QtcScript = fakeqtc.Script
+
+// QtcCall records an invocation of a fake qtc.
+type QtcCall = fakeqtc.Call
+
+// FakeQtc is a fake qtc executable built by BuildFakeQtc.
+//
+// Its SetScript method changes the behavior of later invocations, Install
+// puts it first in PATH for the rest of the test, Calls returns the
+// recorded invocations and Reset forgets them.
+type FakeQtc = fakeqtc.Fake
+
+// BuildFakeQtc compiles a fake qtc executable from Go source into a
+// temporary directory, configured with script.
+//
+// The fake records its arguments and working directory, writes the scripted
+// stdout and stderr and exits with the scripted code. With Generate set, it
+// writes a generated file next to every template selected by its -dir,
+// -ext and -file arguments, like qtc does. This makes build tooling that
+// runs qtc testable without installing qtc. The test is skipped if the go
+// command is not available.
+//
+// Example:
+//
+//	fake := BuildFakeQtc(t, QtcScript{Stderr: "template.qtpl:3: unexpected tag", ExitCode: 1})
+//	fake.Install(t)
+//	_, err := qtcwrap.Compile(qtcwrap.Config{Dir: "templates"})
+//	// err is a *qtcwrap.QtcError holding the scripted stderr
+//	calls := fake.Calls(t)  // calls[0].Args == []string{"-dir=templates"}
+func BuildFakeQtc(t testing.TB, script QtcScript) *FakeQtc {
+	t.Helper()
+	return fakeqtc.Build(t, script)
+}
@@ -0,0 +1,45 @@
+package qtcwraptest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	qtcwrap "github.com/valksor/go-qtcwrap"
+)
+
+func TestBuildFakeQtc(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+
+	fake := BuildFakeQtc(t, QtcScript{Stderr: "hello.qtpl:1: unexpected tag\n", ExitCode: 1})
+	fake.Install(t)
+
+	dir := t.TempDir()
+	writeFixtureFile(t, filepath.Join(dir, "hello.qtpl"), helloTemplate)
+
+	config := qtcwrap.Config{Dir: dir, SkipLineComments: true}
+	_, err := qtcwrap.Compile(config)
+	var qtcErr *qtcwrap.QtcError
+	if !errors.As(err, &qtcErr) || qtcErr.Stderr != "hello.qtpl:1: unexpected tag\n" {
+		t.Fatalf("Expected QtcError with scripted stderr, got %v", err)
+	}
+
+	fake.SetScript(t, QtcScript{Generate: true})
+	fake.Reset(t)
+	if _, err := qtcwrap.Compile(config); err != nil {
+		t.Fatalf("Expected scripted success, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hello.qtpl.go")); err != nil {
+		t.Errorf("Expected generated file: %v", err)
+	}
+
+	calls := fake.Calls(t)
+	expected := []string{"-dir=" + dir, "-skipLineComments"}
+	if len(calls) != 1 || !reflect.DeepEqual(calls[0].Args, expected) {
+		t.Errorf("Expected one call with %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,132 @@
+package qtcwraptest
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	qtcwrap "github.com/valksor/go-qtcwrap"
+)
+
+const (
+	// FixtureModule is the module path of the temporary module created by
+	// CompileFixtures.
+	FixtureModule = "qtcwrap.fixtures"
+
+	// fixtureGoVersion is the go directive of the temporary module.
+	fixtureGoVersion = "1.24"
+)
+
+// Fixture is a temporary module holding compiled fixture templates.
+type Fixture struct {
+	// Dir is the root directory of the temporary module.
+	Dir string
+
+	// Config is the configuration the templates were compiled with.
+	Config qtcwrap.Config
+}
+
+// Path returns the location of a fixture file, given by its slash-separated
+// path relative to the module root.
+func (f *Fixture) Path(name string) string {
+	return filepath.Join(f.Dir, filepath.FromSlash(name))
+}
+
+// generatedPath returns where the code of the fixture template name is
+// generated.
+func (f *Fixture) generatedPath(name string) string {
+	if f.Config.OutputDir != "" {
+		return filepath.Join(f.Config.OutputDir, filepath.FromSlash(name)+".go")
+	}
+	return f.Path(name) + ".go"
+}
+
+// Generated returns the Go code generated for the fixture template name.
+// The test fails if the file does not exist.
+//
+// Example:
+//
+//	code := fixture.Generated(t, "views/page.qtpl")
+//	AssertGolden(t, "page.qtpl.go", code)
+func (f *Fixture) Generated(t testing.TB, name string) []byte {
+	t.Helper()
+
+	code, err := os.ReadFile(f.generatedPath(name)) // #nosec G304 -- path lies inside the fixture module
+	if err != nil {
+		t.Fatalf("Failed to read code generated for %s: %v", name, err)
+	}
+	return code
+}
+
+// CompileFixtures writes templates into a temporary module and compiles
+// them with qtcwrap.Compile.
+//
+// templates maps slash-separated paths relative to the module root, such as
+// "views/page.qtpl", to template sources. The module is named FixtureModule
+// and removed when the test ends. config.Dir is set to the module root and
+// a relative config.OutputDir is resolved against it. If config.Backend is
+// empty and qtc is not in PATH, the embedded backend is used, so fixtures
+// compile on machines without qtc. The config is used as given: QTCWRAP_*
+// environment variables, such as QTCWRAP_DIR, are cleared for the rest of
+// the test, so like t.Setenv, CompileFixtures cannot be used in parallel
+// tests while any of them is set. The test fails if the compilation fails
+// or the code of any template is not generated.
+//
+// Example:
+//
+//	fixture := CompileFixtures(t, qtcwrap.Config{SkipLineComments: true}, map[string]string{
+//	    "views/hello.qtpl": "{% func Hello(name string) %}Hello, {%s name %}!{% endfunc %}",
+//	})
+//	AssertGolden(t, "hello", fixture.Generated(t, "views/hello.qtpl"))
+func CompileFixtures(t testing.TB, config qtcwrap.Config, templates map[string]string) *Fixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	goMod := "module " + FixtureModule + "\n\ngo " + fixtureGoVersion + "\n"
+	writeFixtureFile(t, filepath.Join(dir, "go.mod"), goMod)
+
+	names := make([]string, 0, len(templates))
+	for name, source := range templates {
+		writeFixtureFile(t, filepath.Join(dir, filepath.FromSlash(name)), source)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config.Dir = dir
+	config.File = ""
+	if config.OutputDir != "" && !filepath.IsAbs(config.OutputDir) {
+		config.OutputDir = filepath.Join(dir, config.OutputDir)
+	}
+	if config.Backend == "" && !qtcwrap.IsQtcAvailable() {
+		config.Backend = qtcwrap.EmbeddedBackend
+	}
+
+	for _, override := range qtcwrap.EnvOverrides() {
+		t.Setenv(override.Var, "")
+	}
+	if _, err := qtcwrap.Compile(config); err != nil {
+		t.Fatalf("Failed to compile fixture templates: %v", err)
+	}
+
+	fixture := &Fixture{Dir: dir, Config: config}
+	for _, name := range names {
+		if _, err := os.Stat(fixture.generatedPath(name)); err != nil {
+			t.Fatalf("Fixture template %s was not compiled: %v", name, err)
+		}
+	}
+	return fixture
+}
+
+// writeFixtureFile writes a file of the fixture module, creating its
+// directory as needed.
+func writeFixtureFile(t testing.TB, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatalf("Failed to create fixture directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write fixture file %s: %v", path, err)
+	}
+}
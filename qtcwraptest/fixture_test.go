@@ -0,0 +1,73 @@
+package qtcwraptest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	qtcwrap "github.com/valksor/go-qtcwrap"
+)
+
+const helloTemplate = "{% func Hello(name string) %}Hello, {%s name %}!{% endfunc %}\n"
+
+func TestCompileFixtures(t *testing.T) {
+	tests := []struct {
+		name   string
+		config qtcwrap.Config
+	}{
+		{
+			name:   "InPlace",
+			config: qtcwrap.Config{SkipLineComments: true},
+		},
+		{
+			name:   "OutputDir",
+			config: qtcwrap.Config{SkipLineComments: true, OutputDir: "gen"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := CompileFixtures(t, tt.config, map[string]string{
+				"views/hello.qtpl": helloTemplate,
+			})
+
+			goMod, err := os.ReadFile(fixture.Path("go.mod"))
+			if err != nil {
+				t.Fatalf("Failed to read fixture go.mod: %v", err)
+			}
+			if !strings.HasPrefix(string(goMod), "module "+FixtureModule+"\n") {
+				t.Errorf("Expected fixture module %s, got %q", FixtureModule, goMod)
+			}
+
+			code := string(fixture.Generated(t, "views/hello.qtpl"))
+			for _, want := range []string{"package views", "func StreamHello(", "func WriteHello(", "func Hello("} {
+				if !strings.Contains(code, want) {
+					t.Errorf("Expected generated code to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileFixturesFailure(t *testing.T) {
+	r := record(t, func(tb testing.TB) {
+		CompileFixtures(tb, qtcwrap.Config{Backend: qtcwrap.EmbeddedBackend}, map[string]string{
+			"views/broken.qtpl": "{% func Broken() %}",
+		})
+	})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "Failed to compile fixture templates") || !strings.Contains(r.errors[0], "broken.qtpl") {
+		t.Errorf("Expected the compile error of views/broken.qtpl, got %v", r.errors)
+	}
+}
+
+func TestCompileFixturesIgnoresEnv(t *testing.T) {
+	t.Setenv(qtcwrap.EnvPrefix+"DIR", t.TempDir())
+	t.Setenv(qtcwrap.EnvPrefix+"OUTPUT_DIR", t.TempDir())
+
+	fixture := CompileFixtures(t, qtcwrap.Config{SkipLineComments: true}, map[string]string{
+		"views/hello.qtpl": helloTemplate,
+	})
+	if _, err := os.Stat(fixture.Path("views/hello.qtpl.go")); err != nil {
+		t.Errorf("Expected the fixture to be compiled in place despite the environment: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Package qtcwraptest provides helpers for testing QuickTemplate templates
+// and the tooling built around qtcwrap.
+//
+// It supports:
+// - Golden-file snapshot assertions for rendered template output
+// - A -qtcwraptest.update flag rewriting golden files with the current output
+// - HTML normalization so whitespace changes do not break snapshots
+// - Compiling fixture templates in a temporary module during tests
+//
+// Example:
+//
+//	func TestHomePage(t *testing.T) {
+//	    got := qtcwraptest.Stream(func(qw *quicktemplate.Writer) {
+//	        templates.StreamHome(qw, "Welcome")
+//	    })
+//	    qtcwraptest.AssertGolden(t, "home", got)
+//	}
+//
+// Run "go test -qtcwraptest.update" to create or refresh the golden files.
+// Test packages declaring a boolean -update flag of their own can use
+// "go test -update" as well.
+package qtcwraptest
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/valyala/quicktemplate"
+)
+
+const (
+	// GoldenDir is the directory golden files are stored in, relative to
+	// the package under test.
+	GoldenDir = "testdata"
+
+	// GoldenExt is the extension of golden files.
+	GoldenExt = ".golden"
+
+	// goldenFilePerm is the permission used for golden files.
+	goldenFilePerm = 0o644
+)
+
+// update rewrites golden files instead of comparing against them. The flag
+// is namespaced like the flags of the testing package, so it does not clash
+// with an -update flag declared by the package under test.
+var update = flag.Bool("qtcwraptest.update", false, "rewrite golden files with the current template output")
+
+// updating reports whether golden files are rewritten: with
+// -qtcwraptest.update, or with a boolean -update flag declared by the
+// package under test. The flags are looked up when an assertion runs, after
+// they have been parsed.
+func updating() bool {
+	if *update {
+		return true
+	}
+	if f := flag.Lookup("update"); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			enabled, _ := getter.Get().(bool)
+			return enabled
+		}
+	}
+	return false
+}
+
+// Stream renders template output written by fn, such as a call to a
+// generated StreamX function, and returns it.
+//
+// Example:
+//
+//	got := Stream(func(qw *quicktemplate.Writer) {
+//	    templates.StreamPage(qw, "Title")
+//	})
+func Stream(fn func(qw *quicktemplate.Writer)) []byte {
+	var buf bytes.Buffer
+	qw := quicktemplate.AcquireWriter(&buf)
+	defer quicktemplate.ReleaseWriter(qw)
+
+	fn(qw)
+	return buf.Bytes()
+}
+
+// GoldenPath returns the path of the golden file for name.
+func GoldenPath(name string) string {
+	return filepath.Join(GoldenDir, filepath.FromSlash(name)+GoldenExt)
+}
+
+// AssertGolden compares got with the golden file for name.
+//
+// Both sides are normalized with NormalizeHTML, so differences in
+// insignificant whitespace are ignored, and a line diff of the normalized
+// output is reported on mismatch. When the test binary runs with
+// -qtcwraptest.update, or with a boolean -update flag declared by the
+// package under test, the golden file is written with got instead and the
+// assertion passes.
+//
+// Example:
+//
+//	AssertGolden(t, "emails/welcome", output)  // testdata/emails/welcome.golden
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	path := GoldenPath(name)
+	if updating() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("Failed to create golden directory for %s: %v", path, err)
+		}
+		// #nosec G306 -- golden files are checked in like any other test data
+		if err := os.WriteFile(path, got, goldenFilePerm); err != nil {
+			t.Fatalf("Failed to update golden file %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path) // #nosec G304 -- golden files live below the package under test
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s (run with -qtcwraptest.update to create it): %v", path, err)
+	}
+
+	normalizedWant, normalizedGot := NormalizeHTML(string(want)), NormalizeHTML(string(got))
+	if normalizedWant != normalizedGot {
+		t.Errorf("Output does not match golden file %s (run with -qtcwraptest.update to accept it):\n%s",
+			path, Diff(normalizedWant, normalizedGot))
+	}
+}
+
+// AssertGoldenString is AssertGolden for string output, such as the result
+// of a generated X function.
+func AssertGoldenString(t testing.TB, name, got string) {
+	t.Helper()
+	AssertGolden(t, name, []byte(got))
+}
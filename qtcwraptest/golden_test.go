@@ -0,0 +1,165 @@
+package qtcwraptest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/valyala/quicktemplate"
+)
+
+// recorder captures the failures reported through testing.TB.
+type recorder struct {
+	testing.TB
+	errors []string
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+	r.failed = true
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// record runs fn with a recorder, like a subtest whose failures are
+// inspected instead of reported.
+func record(t *testing.T, fn func(tb testing.TB)) *recorder {
+	r := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(r)
+	}()
+	<-done
+	return r
+}
+
+// streamPage renders the page compared with testdata/page.golden.
+func streamPage(qw *quicktemplate.Writer, title string, items ...string) {
+	qw.N().S("<!DOCTYPE html><html><body><h1>")
+	qw.E().S(title)
+	qw.N().S("</h1><ul>")
+	for _, item := range items {
+		qw.N().S("<li>")
+		qw.E().S(item)
+		qw.N().S("</li>")
+	}
+	qw.N().S("</ul></body></html>")
+}
+
+// packageUpdate stands in for the -update flag many test packages declare.
+// Declaring it panics if qtcwraptest registers -update itself.
+var packageUpdate = flag.Bool("update", false, "rewrite golden files")
+
+// setUpdate enables -qtcwraptest.update for the duration of a test.
+func setUpdate(t *testing.T) {
+	*update = true
+	t.Cleanup(func() {
+		*update = false
+	})
+}
+
+func TestStream(t *testing.T) {
+	got := Stream(func(qw *quicktemplate.Writer) {
+		qw.E().S("<b>")
+		qw.N().D(42)
+	})
+	if string(got) != "&lt;b&gt;42" {
+		t.Errorf("Expected escaped output, got %q", got)
+	}
+}
+
+func TestGoldenPath(t *testing.T) {
+	expected := filepath.Join("testdata", "emails", "welcome.golden")
+	if got := GoldenPath("emails/welcome"); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []string
+		failure string
+	}{
+		{
+			name:  "Match",
+			items: []string{"one", "two"},
+		},
+		{
+			name:    "Mismatch",
+			items:   []string{"one", "three"},
+			failure: "- two\n+ three\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Stream(func(qw *quicktemplate.Writer) {
+				streamPage(qw, "Hello, World!", tt.items...)
+			})
+			r := record(t, func(tb testing.TB) {
+				AssertGolden(tb, "page", got)
+			})
+
+			if tt.failure == "" {
+				if r.failed {
+					t.Errorf("Expected output to match, got %v", r.errors)
+				}
+				return
+			}
+			if len(r.errors) != 1 || !strings.Contains(r.errors[0], tt.failure) {
+				t.Errorf("Expected failure containing %q, got %v", tt.failure, r.errors)
+			}
+		})
+	}
+}
+
+func TestAssertGoldenMissing(t *testing.T) {
+	r := record(t, func(tb testing.TB) {
+		AssertGoldenString(tb, "missing", "output")
+	})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "-qtcwraptest.update") {
+		t.Errorf("Expected a hint to run with -qtcwraptest.update, got %v", r.errors)
+	}
+}
+
+func TestUpdatingWithPackageFlag(t *testing.T) {
+	if updating() {
+		t.Fatal("Expected golden files not to be rewritten by default")
+	}
+	if err := flag.Set("update", "true"); err != nil {
+		t.Fatalf("Failed to set -update: %v", err)
+	}
+	t.Cleanup(func() {
+		*packageUpdate = false
+	})
+	if !updating() {
+		t.Error("Expected the -update flag of the package under test to rewrite golden files")
+	}
+}
+
+func TestAssertGoldenUpdate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	setUpdate(t)
+
+	AssertGoldenString(t, "nested/page", "<p>new</p>")
+
+	data, err := os.ReadFile(filepath.Join("testdata", "nested", "page.golden"))
+	if err != nil {
+		t.Fatalf("Failed to read updated golden file: %v", err)
+	}
+	if string(data) != "<p>new</p>" {
+		t.Errorf("Expected raw output in golden file, got %q", data)
+	}
+}
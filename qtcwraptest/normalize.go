@@ -0,0 +1,88 @@
+package qtcwraptest
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// tagPattern matches HTML tags, comments and doctypes.
+	tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+	// spacePattern matches runs of whitespace.
+	spacePattern = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeHTML rewrites HTML into a canonical form for comparisons.
+//
+// Every tag and every text run is put on a line of its own, whitespace
+// inside tags and text is collapsed to single spaces, and whitespace-only
+// text between tags is dropped. The result keeps the content and order of
+// the document while ignoring indentation and line breaks, and makes line
+// diffs readable. Plain text without tags is normalized the same way.
+//
+// Example:
+//
+//	NormalizeHTML("<ul>\n  <li>a</li>\n</ul>")  // "<ul>\n<li>\na\n</li>\n</ul>"
+func NormalizeHTML(s string) string {
+	var lines []string
+	addText := func(text string) {
+		if text = strings.TrimSpace(spacePattern.ReplaceAllString(text, " ")); text != "" {
+			lines = append(lines, text)
+		}
+	}
+
+	last := 0
+	for _, loc := range tagPattern.FindAllStringIndex(s, -1) {
+		addText(s[last:loc[0]])
+		tag := spacePattern.ReplaceAllString(s[loc[0]:loc[1]], " ")
+		tag = strings.Replace(tag, "< ", "<", 1)
+		tag = strings.Replace(tag, " >", ">", 1)
+		tag = strings.Replace(tag, " />", "/>", 1)
+		lines = append(lines, tag)
+		last = loc[1]
+	}
+	addText(s[last:])
+
+	return strings.Join(lines, "\n")
+}
+
+// Diff returns a line diff turning want into got. Removed lines are
+// prefixed with "-", added lines with "+" and common lines with a space.
+func Diff(want, got string) string {
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,92 @@
+package qtcwraptest
+
+import "testing"
+
+func TestNormalizeHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Indentation",
+			input:    "<ul>\n  <li>a</li>\n</ul>\n",
+			expected: "<ul>\n<li>\na\n</li>\n</ul>",
+		},
+		{
+			name:     "TextWhitespace",
+			input:    "<p>  Hello,\n\t World!  </p>",
+			expected: "<p>\nHello, World!\n</p>",
+		},
+		{
+			name:     "TagWhitespace",
+			input:    "<a\n   href=\"/\"  class=\"x\" >home</a>",
+			expected: "<a href=\"/\" class=\"x\">\nhome\n</a>",
+		},
+		{
+			name:     "SelfClosing",
+			input:    "<br  />",
+			expected: "<br/>",
+		},
+		{
+			name:     "PlainText",
+			input:    "  Hello,\n World \n",
+			expected: "Hello, World",
+		},
+		{
+			name:     "Empty",
+			input:    " \n ",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeHTML(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     string
+		got      string
+		expected string
+	}{
+		{
+			name:     "Equal",
+			want:     "a\nb",
+			got:      "a\nb",
+			expected: "  a\n  b\n",
+		},
+		{
+			name:     "Changed",
+			want:     "a\nb\nc",
+			got:      "a\nx\nc",
+			expected: "  a\n- b\n+ x\n  c\n",
+		},
+		{
+			name:     "Added",
+			want:     "a",
+			got:      "a\nb",
+			expected: "  a\n+ b\n",
+		},
+		{
+			name:     "Removed",
+			want:     "a\nb",
+			got:      "b",
+			expected: "- a\n  b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.want, tt.got); got != tt.expected {
+				t.Errorf("Expected diff %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package qtcwrap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// sarifVersion and sarifSchema identify the SARIF format written by
+	// Report.WriteSARIF.
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// sarifRootBase is the base URI of the repository root, which code
+	// scanning services resolve to their checkout.
+	sarifRootBase = "%SRCROOT%"
+
+	// reportToolName and reportToolURI describe qtcwrap in reports.
+	reportToolName = "qtcwrap"
+	reportToolURI  = "https://github.com/valksor/go-qtcwrap"
+)
+
+// ruleDescriptions describes the rules reported by qtcwrap itself.
+var ruleDescriptions = map[string]string{
+	RuleCompile:       "Template does not compile",
+	RuleTypeCheck:     "Generated code does not type-check",
+	RuleComplexity:    "Template exceeds a complexity threshold",
+	RuleRawOutput:     "Value is written without escaping",
+	RuleOutputContext: "Escaping does not suit the HTML context",
+	RuleUntranslated:  "Text is not wrapped for translation",
+}
+
+// Report turns the outcome of a compilation into reports for CI systems.
+//
+// Reports are built from Result.Diagnostics, so problems found by other
+// tools, such as lint findings, can be included by appending them to the
+// result first. File paths are written relative to Root, so CI systems can
+// attach problems to the files of a pull request.
+type Report struct {
+	// Result is the compilation result. It may be nil if compilation failed
+	// before any template was selected.
+	Result *Result
+
+	// Err is the compilation error, if any. It is reported as a failure of
+	// its own when no error diagnostic explains it.
+	Err error
+
+	// Root is the repository root paths are made relative to. If empty,
+	// the nearest directory containing .git above the working directory is
+	// used, or the working directory if there is none.
+	Root string
+}
+
+// WriteSARIF writes the report in the SARIF 2.1.0 format used by code
+// scanning services.
+//
+// Every diagnostic becomes a result of its rule, with the level derived from
+// its severity. A compilation error without diagnostics is reported as a
+// tool execution notification.
+//
+// Example:
+//
+//	result, err := Compile(Config{Dir: "templates", PostBuildCheck: true})
+//	f, _ := os.Create("qtcwrap.sarif")
+//	defer f.Close()
+//	if err := (Report{Result: result, Err: err}).WriteSARIF(f); err != nil {
+//	    fmt.Printf("Cannot write report: %v\n", err)
+//	}
+func (r Report) WriteSARIF(w io.Writer) error {
+	root, err := r.root()
+	if err != nil {
+		return err
+	}
+	diagnostics := r.diagnostics()
+
+	var rules []sarifRule
+	ruleIndex := make(map[string]int)
+	for _, diagnostic := range diagnostics {
+		if _, ok := ruleIndex[diagnostic.Rule]; ok {
+			continue
+		}
+		ruleIndex[diagnostic.Rule] = len(rules)
+		description := ruleDescriptions[diagnostic.Rule]
+		if description == "" {
+			description = diagnostic.Rule
+		}
+		rules = append(rules, sarifRule{ID: diagnostic.Rule, ShortDescription: sarifMessage{Text: description}})
+	}
+
+	results := make([]sarifResult, 0, len(diagnostics))
+	for _, diagnostic := range diagnostics {
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifact(root, diagnostic.File),
+		}}
+		if diagnostic.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: diagnostic.Line, StartColumn: diagnostic.Column}
+		}
+		results = append(results, sarifResult{
+			RuleID:    diagnostic.Rule,
+			RuleIndex: ruleIndex[diagnostic.Rule],
+			Level:     sarifLevel(diagnostic.Severity),
+			Message:   sarifMessage{Text: diagnostic.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	invocation := sarifInvocation{ExecutionSuccessful: r.Err == nil}
+	if r.unexplained() {
+		invocation.ToolExecutionNotifications = []sarifNotification{{
+			Level:   "error",
+			Message: sarifMessage{Text: r.Err.Error()},
+		}}
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool:        sarifTool{Driver: sarifDriver{Name: reportToolName, InformationURI: reportToolURI, Rules: rules}},
+			Invocations: []sarifInvocation{invocation},
+			Results:     results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return fmt.Errorf("cannot write SARIF report: %w", err)
+	}
+	return nil
+}
+
+// WriteJUnit writes the report as JUnit XML, as shown by the test tabs of
+// CI systems.
+//
+// Every compiled template becomes a test case, failed by its error
+// diagnostics; warnings are attached as output. Diagnostics of files that
+// are not templates, and a compilation error without diagnostics, get test
+// cases of their own.
+//
+// Example:
+//
+//	result, err := Compile(Config{Dir: "templates"})
+//	f, _ := os.Create("qtcwrap-junit.xml")
+//	defer f.Close()
+//	if err := (Report{Result: result, Err: err}).WriteJUnit(f); err != nil {
+//	    fmt.Printf("Cannot write report: %v\n", err)
+//	}
+func (r Report) WriteJUnit(w io.Writer) error {
+	root, err := r.root()
+	if err != nil {
+		return err
+	}
+
+	var templates []string
+	if r.Result != nil {
+		templates = r.Result.Templates
+	}
+
+	cases := make([]junitTestCase, 0, len(templates))
+	caseIndex := make(map[string]int)
+	addCase := func(file string) int {
+		name := reportPath(root, file)
+		if i, ok := caseIndex[name]; ok {
+			return i
+		}
+		caseIndex[name] = len(cases)
+		classname := reportToolName
+		if dir := path.Dir(name); dir != "." && dir != "/" {
+			classname += "." + strings.ReplaceAll(strings.TrimPrefix(dir, "/"), "/", ".")
+		}
+		cases = append(cases, junitTestCase{Name: name, ClassName: classname})
+		return len(cases) - 1
+	}
+	for _, template := range templates {
+		addCase(template)
+	}
+
+	for _, diagnostic := range r.diagnostics() {
+		tc := &cases[addCase(diagnostic.File)]
+		diagnostic.File = tc.Name
+		text := diagnostic.String()
+		if diagnostic.Severity == SeverityWarning {
+			tc.SystemOut = strings.TrimPrefix(tc.SystemOut+"\n"+text, "\n")
+			continue
+		}
+		tc.Failures = append(tc.Failures, junitFailure{Message: diagnostic.Message, Type: diagnostic.Rule, Text: text})
+	}
+
+	if r.unexplained() {
+		cases = append(cases, junitTestCase{
+			Name:      "compile",
+			ClassName: reportToolName,
+			Failures:  []junitFailure{{Message: r.Err.Error(), Type: RuleCompile, Text: r.Err.Error()}},
+		})
+	}
+
+	failures := 0
+	for _, tc := range cases {
+		if len(tc.Failures) > 0 {
+			failures++
+		}
+	}
+	suite := junitTestSuite{Name: reportToolName, Tests: len(cases), Failures: failures, TestCases: cases}
+	suites := junitTestSuites{Name: reportToolName, Tests: suite.Tests, Failures: suite.Failures, Suites: []junitTestSuite{suite}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("cannot write JUnit report: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("cannot write JUnit report: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("cannot write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// diagnostics returns the diagnostics of the result, ordered by file and
+// position.
+func (r Report) diagnostics() []Diagnostic {
+	if r.Result == nil {
+		return nil
+	}
+	diagnostics := append([]Diagnostic(nil), r.Result.Diagnostics...)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics
+}
+
+// unexplained reports whether the compilation failed without an error
+// diagnostic describing why.
+func (r Report) unexplained() bool {
+	if r.Err == nil {
+		return false
+	}
+	for _, diagnostic := range r.diagnostics() {
+		if diagnostic.Severity != SeverityWarning {
+			return false
+		}
+	}
+	return true
+}
+
+// root returns the absolute directory paths are reported relative to.
+func (r Report) root() (string, error) {
+	if r.Root != "" {
+		root, err := filepath.Abs(r.Root)
+		if err != nil {
+			return "", fmt.Errorf("cannot resolve report root %s: %w", r.Root, err)
+		}
+		return root, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine working directory: %w", err)
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("cannot find repository root: %w", err)
+		}
+		if filepath.Dir(dir) == dir {
+			return wd, nil
+		}
+	}
+}
+
+// reportPath returns file relative to root with forward slashes. Files
+// outside root are reported with their absolute path.
+func reportPath(root, file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// sarifArtifact returns the SARIF location of file. Files below root are
+// relative to sarifRootBase; files outside root get an absolute file URI,
+// since they cannot be resolved against the repository checkout.
+func sarifArtifact(root, file string) sarifArtifactLocation {
+	name := reportPath(root, file)
+	if !filepath.IsAbs(filepath.FromSlash(name)) {
+		return sarifArtifactLocation{URI: name, URIBaseID: sarifRootBase}
+	}
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return sarifArtifactLocation{URI: (&url.URL{Scheme: "file", Path: name}).String()}
+}
+
+// sarifLevel maps a severity to a SARIF result level.
+func sarifLevel(severity Severity) string {
+	if severity == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// SARIF 2.1.0 document structure, limited to the properties qtcwrap writes.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+
+	sarifRun struct {
+		Tool        sarifTool         `json:"tool"`
+		Invocations []sarifInvocation `json:"invocations"`
+		Results     []sarifResult     `json:"results"`
+	}
+
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules,omitempty"`
+	}
+
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+
+	sarifInvocation struct {
+		ExecutionSuccessful        bool                `json:"executionSuccessful"`
+		ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+	}
+
+	sarifNotification struct {
+		Level   string       `json:"level"`
+		Message sarifMessage `json:"message"`
+	}
+
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		RuleIndex int             `json:"ruleIndex"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+
+	sarifArtifactLocation struct {
+		URI       string `json:"uri"`
+		URIBaseID string `json:"uriBaseId,omitempty"`
+	}
+
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+)
+
+// JUnit XML document structure, as understood by common CI systems.
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Errors    int             `xml:"errors,attr"`
+		TestCases []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string         `xml:"name,attr"`
+		ClassName string         `xml:"classname,attr"`
+		Failures  []junitFailure `xml:"failure,omitempty"`
+		SystemOut string         `xml:"system-out,omitempty"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
@@ -0,0 +1,219 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reportFixture returns a failed compilation result below root.
+func reportFixture(root string) Report {
+	return Report{
+		Result: &Result{
+			Templates: []string{
+				filepath.Join(root, "views", "a.qtpl"),
+				filepath.Join(root, "views", "b.qtpl"),
+			},
+			Diagnostics: []Diagnostic{
+				{File: filepath.Join(root, "views", "b.qtpl"), Line: 7, Rule: RuleTypeCheck, Severity: SeverityError, Message: "undefined: title"},
+				{File: filepath.Join(root, "views", "a.qtpl"), Line: 3, Column: 8, Rule: RuleCompile, Severity: SeverityError, Message: "empty if condition"},
+				{File: filepath.Join(root, "views", "a.qtpl"), Line: 1, Rule: "lint", Severity: SeverityWarning, Message: "unused parameter"},
+			},
+		},
+		Err:  errors.New("compilation failed"),
+		Root: root,
+	}
+}
+
+func TestReportWriteSARIF(t *testing.T) {
+	root := t.TempDir()
+
+	var buf bytes.Buffer
+	if err := reportFixture(root).WriteSARIF(&buf); err != nil {
+		t.Fatalf("Failed to write SARIF: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if log.Version != sarifVersion || len(log.Runs) != 1 {
+		t.Fatalf("Expected one SARIF %s run, got %+v", sarifVersion, log)
+	}
+	run := log.Runs[0]
+
+	var rules []string
+	for _, rule := range run.Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+	if expected := []string{"lint", RuleCompile, RuleTypeCheck}; !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected rules %v, got %v", expected, rules)
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(run.Results))
+	}
+	first := run.Results[0]
+	location := first.Locations[0].PhysicalLocation
+	if first.Level != "warning" || location.ArtifactLocation.URI != "views/a.qtpl" || location.ArtifactLocation.URIBaseID != sarifRootBase || location.Region.StartLine != 1 {
+		t.Errorf("Expected warning at views/a.qtpl:1, got %+v", first)
+	}
+	for _, result := range run.Results {
+		if run.Tool.Driver.Rules[result.RuleIndex].ID != result.RuleID {
+			t.Errorf("Expected rule index of %s to match, got %d", result.RuleID, result.RuleIndex)
+		}
+	}
+
+	invocation := run.Invocations[0]
+	if invocation.ExecutionSuccessful || len(invocation.ToolExecutionNotifications) != 0 {
+		t.Errorf("Expected failed invocation explained by diagnostics, got %+v", invocation)
+	}
+}
+
+func TestReportWriteSARIFOutsideRoot(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "shared", "layout.qtpl")
+	report := reportFixture(t.TempDir())
+	report.Result.Diagnostics = []Diagnostic{{File: outside, Line: 2, Rule: RuleCompile, Severity: SeverityError, Message: "unexpected tag"}}
+
+	var buf bytes.Buffer
+	if err := report.WriteSARIF(&buf); err != nil {
+		t.Fatalf("Failed to write SARIF: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	artifact := log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation
+	expected := "file://" + filepath.ToSlash(outside)
+	if !strings.HasPrefix(expected, "file:///") {
+		expected = "file:///" + filepath.ToSlash(outside)
+	}
+	if artifact.URI != expected || artifact.URIBaseID != "" {
+		t.Errorf("Expected file URI %s without base, got %+v", expected, artifact)
+	}
+	if strings.Contains(buf.String(), sarifRootBase) {
+		t.Errorf("Expected no %s base for files outside the root, got %s", sarifRootBase, buf.String())
+	}
+}
+
+func TestReportWriteSARIFUnexplainedError(t *testing.T) {
+	var buf bytes.Buffer
+	report := Report{Err: errors.New("qtc command not found in PATH"), Root: t.TempDir()}
+	if err := report.WriteSARIF(&buf); err != nil {
+		t.Fatalf("Failed to write SARIF: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	notifications := log.Runs[0].Invocations[0].ToolExecutionNotifications
+	if len(notifications) != 1 || notifications[0].Message.Text != "qtc command not found in PATH" {
+		t.Errorf("Expected error notification, got %+v", notifications)
+	}
+	if !strings.Contains(buf.String(), `"results": []`) {
+		t.Errorf("Expected empty results array, got %s", buf.String())
+	}
+}
+
+func TestReportWriteJUnit(t *testing.T) {
+	root := t.TempDir()
+	report := reportFixture(root)
+	report.Result.Diagnostics = append(report.Result.Diagnostics,
+		Diagnostic{File: filepath.Join(root, "views", "helpers.go"), Line: 2, Rule: RuleTypeCheck, Severity: SeverityError, Message: "undefined: x"})
+
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatalf("Failed to write JUnit: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("Expected XML header, got %q", buf.String())
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("Expected valid XML, got %v", err)
+	}
+	if suites.Tests != 3 || suites.Failures != 3 || len(suites.Suites) != 1 {
+		t.Fatalf("Expected 3 failed tests in one suite, got %+v", suites)
+	}
+
+	cases := suites.Suites[0].TestCases
+	var names []string
+	for _, tc := range cases {
+		names = append(names, tc.Name)
+	}
+	if expected := []string{"views/a.qtpl", "views/b.qtpl", "views/helpers.go"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected test cases %v, got %v", expected, names)
+	}
+
+	a := cases[0]
+	if a.ClassName != "qtcwrap.views" || len(a.Failures) != 1 || a.Failures[0].Type != RuleCompile {
+		t.Errorf("Expected one compile failure for views/a.qtpl, got %+v", a)
+	}
+	if a.Failures[0].Text != "views/a.qtpl:3:8: empty if condition" {
+		t.Errorf("Expected failure with relative position, got %q", a.Failures[0].Text)
+	}
+	if a.SystemOut != "views/a.qtpl:1: unused parameter" {
+		t.Errorf("Expected warning as output, got %q", a.SystemOut)
+	}
+}
+
+func TestReportWriteJUnitSuccess(t *testing.T) {
+	root := t.TempDir()
+	report := Report{Result: &Result{Templates: []string{filepath.Join(root, "home.qtpl")}}, Root: root}
+
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Fatalf("Failed to write JUnit: %v", err)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("Expected valid XML, got %v", err)
+	}
+	cases := suites.Suites[0].TestCases
+	if suites.Failures != 0 || len(cases) != 1 || cases[0].Name != "home.qtpl" || cases[0].ClassName != "qtcwrap" {
+		t.Errorf("Expected one passing test case, got %+v", suites)
+	}
+}
+
+func TestReportRoot(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o750); err != nil {
+		t.Fatalf(createTempDirErr, err)
+	}
+	nested := filepath.Join(repo, "web", templatesDir)
+	if err := os.MkdirAll(nested, 0o750); err != nil {
+		t.Fatalf(createTempDirErr, err)
+	}
+	t.Chdir(nested)
+
+	root, err := Report{}.root()
+	if err != nil {
+		t.Fatalf("Failed to determine root: %v", err)
+	}
+	expected, _ := filepath.EvalSymlinks(repo)
+	if resolved, _ := filepath.EvalSymlinks(root); resolved != expected {
+		t.Errorf("Expected repository root %s, got %s", expected, root)
+	}
+
+	if got := reportPath(root, "home.qtpl"); got != "web/templates/home.qtpl" {
+		t.Errorf("Expected path relative to repository root, got %s", got)
+	}
+}
+
+func TestReportPathOutsideRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "repo")
+	outside := filepath.Join(filepath.Dir(root), "other.qtpl")
+	if got := reportPath(root, outside); got != filepath.ToSlash(outside) {
+		t.Errorf("Expected absolute path for files outside root, got %s", got)
+	}
+}
@@ -0,0 +1,145 @@
+package qtcwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// DefaultRetryBackoff is the wait before the first retry when
+// Config.RetryBackoff is not set.
+const DefaultRetryBackoff = 200 * time.Millisecond
+
+// Attempt records a single compiler run of a compilation with retries.
+type Attempt struct {
+	// Number is the 1-based number of the attempt.
+	Number int
+
+	// Err is the failure of the attempt, or nil if it succeeded.
+	Err error
+
+	// Transient reports whether the failure was classified as transient
+	// and therefore retried, unless it was the last attempt.
+	Transient bool
+
+	// Duration is how long the compiler ran.
+	Duration time.Duration
+
+	// Backoff is the wait before the next attempt, or zero if there was
+	// none.
+	Backoff time.Duration
+}
+
+// RetryError reports a compilation that still failed transiently after
+// every attempt allowed by Config.Retries.
+type RetryError struct {
+	// Attempts is the number of attempts that were made.
+	Attempts int
+
+	// Err is the failure of the last attempt.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("compilation failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+// Unwrap returns the failure of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// runWithRetries runs the configured backend, retrying transient failures
+// up to config.Retries times, and records every attempt in the result.
+//
+// Before a retry, the waiting time doubles, starting at config.RetryBackoff,
+// and temporary files left behind by the failed run are removed. When the
+// last attempt fails transiently, a *RetryError wrapping its failure is
+// returned; other failures are returned as they are. A run failing once ctx
+// is done, such as a qtc process killed on cancellation or by WithTimeout,
+// is not retried and its failure is returned wrapped with the context error.
+// Waiting stops early with the context error once ctx is done.
+func runWithRetries(ctx context.Context, config Config, result *Result) error {
+	backoff := config.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	for number := 1; ; number++ {
+		started := time.Now()
+		err := runBackend(ctx, config)
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil && !errors.Is(err, ctxErr) {
+			err = fmt.Errorf("%w: %w", ctxErr, err)
+		}
+		attempt := Attempt{Number: number, Err: err, Transient: isTransient(err), Duration: time.Since(started)}
+
+		switch {
+		case err == nil || !attempt.Transient:
+			result.Attempts = append(result.Attempts, attempt)
+			return err
+		case number > config.Retries:
+			result.Attempts = append(result.Attempts, attempt)
+			return &RetryError{Attempts: number, Err: err}
+		}
+
+		attempt.Backoff = backoff
+		result.Attempts = append(result.Attempts, attempt)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		removeStaleTempFiles(config)
+	}
+}
+
+// isTransient reports whether a compiler failure may succeed when retried:
+// temporary file warnings, qtc processes killed by a signal, and errors
+// that report themselves as temporary. Cancellation and deadline errors are
+// permanent, even when they come with a killed qtc process.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var qtcErr *QtcError
+	if errors.As(err, &qtcErr) {
+		var exitErr *exec.ExitError
+		if errors.As(qtcErr.Err, &exitErr) && !exitErr.Exited() {
+			return true
+		}
+		return qtcErr.Temporary()
+	}
+
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// removeStaleTempFiles removes the temporary files a failed compiler run
+// may have left next to the generated files. Errors are ignored, since the
+// next attempt overwrites the files anyway.
+func removeStaleTempFiles(config Config) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return
+	}
+	for _, template := range templates {
+		_ = os.Remove(template + ".go.tmp")
+	}
+}
+
+// sleepContext waits for d to pass or ctx to be done, whichever happens
+// first, and returns the context error in the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,242 @@
+package qtcwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valksor/go-qtcwrap/internal/fakeqtc"
+)
+
+// temporaryStderr is qtc output classified as a temporary file warning.
+const temporaryStderr = "open templates/.tmp/test.qtpl: no such file or directory"
+
+func TestCompileRetries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+	fake := fakeqtc.Build(t, fakeqtc.Script{})
+	fake.Install(t)
+
+	transient := fakeqtc.Script{Stderr: temporaryStderr, ExitCode: 1}
+	tests := []struct {
+		name      string
+		script    func(tmp string) fakeqtc.Script
+		retries   int
+		attempts  int
+		retryErr  bool
+		failed    bool
+		warnings  int
+		transient []bool
+	}{
+		{
+			name: "TransientThenSuccess",
+			script: func(tmp string) fakeqtc.Script {
+				first := transient
+				first.Files = map[string]string{tmp: "partial"}
+				return fakeqtc.Script{Generate: true, First: []fakeqtc.Script{first}}
+			},
+			retries:   2,
+			attempts:  2,
+			transient: []bool{true, false},
+		},
+		{
+			name: "Exhausted",
+			script: func(string) fakeqtc.Script {
+				return transient
+			},
+			retries:   2,
+			attempts:  3,
+			retryErr:  true,
+			failed:    true,
+			transient: []bool{true, true, true},
+		},
+		{
+			name: "NotTransient",
+			script: func(string) fakeqtc.Script {
+				return fakeqtc.Script{Stderr: syntaxErrorMsg, ExitCode: 1}
+			},
+			retries:   2,
+			attempts:  1,
+			failed:    true,
+			transient: []bool{false},
+		},
+		{
+			name: "WithoutRetries",
+			script: func(string) fakeqtc.Script {
+				return transient
+			},
+			warnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			template := writeTestTemplate(t, dir, testQtplFile, helloTemplate)
+			tmp := template + ".go.tmp"
+
+			fake.Reset(t)
+			fake.SetScript(t, tt.script(tmp))
+
+			config := Config{Dir: dir, Retries: tt.retries, RetryBackoff: time.Millisecond}
+			result, err := Compile(config)
+
+			if (err != nil) != tt.failed {
+				t.Fatalf("Expected failure %v, got %v", tt.failed, err)
+			}
+			var retryErr *RetryError
+			if errors.As(err, &retryErr) != tt.retryErr {
+				t.Errorf("Expected RetryError %v, got %v", tt.retryErr, err)
+			}
+			if tt.retryErr {
+				var qtcErr *QtcError
+				if retryErr.Attempts != tt.attempts || !errors.As(err, &qtcErr) {
+					t.Errorf("Expected RetryError of %d attempts wrapping QtcError, got %v", tt.attempts, err)
+				}
+			}
+
+			if len(result.Attempts) != tt.attempts {
+				t.Fatalf("Expected %d attempts, got %+v", tt.attempts, result.Attempts)
+			}
+			backoff := time.Millisecond
+			for i, attempt := range result.Attempts {
+				if attempt.Number != i+1 || attempt.Transient != tt.transient[i] {
+					t.Errorf("Unexpected attempt %d: %+v", i+1, attempt)
+				}
+				last := i == len(result.Attempts)-1
+				if (last && attempt.Backoff != 0) || (!last && attempt.Backoff != backoff) {
+					t.Errorf("Unexpected backoff of attempt %d: %s", i+1, attempt.Backoff)
+				}
+				backoff *= 2
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("Expected %d suppressed warnings, got %v", tt.warnings, result.Warnings)
+			}
+
+			expectedCalls := max(tt.attempts, 1)
+			if calls := fake.Calls(t); len(calls) != expectedCalls {
+				t.Errorf("Expected %d qtc runs, got %d", expectedCalls, len(calls))
+			}
+			if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+				t.Errorf("Expected stale temporary file to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	killed := exec.Command(shell, "-c", "kill -9 $$").Run()
+	exited := exec.Command(shell, "-c", "exit 1").Run()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Nil"},
+		{name: "TemporaryFileWarning", err: &QtcError{Stderr: temporaryStderr, Err: exited}, expected: true},
+		{name: "Crash", err: &QtcError{Err: killed}, expected: true},
+		{name: "CompileError", err: &QtcError{Stderr: syntaxErrorMsg, Err: exited}},
+		{name: "Other", err: errors.New(syntaxErrorMsg)},
+		{name: "Wrapped", err: &RetryError{Attempts: 1, Err: &QtcError{Stderr: temporaryStderr}}, expected: true},
+		{name: "Canceled", err: fmt.Errorf("%w: %w", context.Canceled, &QtcError{Err: killed})},
+		{name: "DeadlineExceeded", err: fmt.Errorf("%w: %w", context.DeadlineExceeded, &QtcError{Stderr: temporaryStderr, Err: exited})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompileRetriesCanceled(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	killed := exec.Command(shell, "-c", "kill -9 $$").Run()
+
+	dir := t.TempDir()
+	writeTestTemplate(t, dir, testQtplFile, helloTemplate)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	runner := RunnerFunc(func(ctx context.Context, args []string) error {
+		calls++
+		cancel()
+		return &QtcError{Args: args, Err: killed}
+	})
+	logger := &logRecorder{}
+
+	config := Config{Dir: dir, SkipLineComments: true, Retries: 2, RetryBackoff: time.Millisecond}
+	result, err := New(FromConfig(config), WithRunner(runner), WithLogger(logger)).Compile(ctx)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation to be reported, got %v", err)
+	}
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		t.Errorf("Expected no RetryError for a canceled run, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single run, got %d", calls)
+	}
+	if result == nil || len(result.Attempts) != 1 || result.Attempts[0].Transient || result.Attempts[0].Backoff != 0 {
+		t.Fatalf("Expected one permanent attempt without backoff, got %+v", result)
+	}
+	for _, message := range logger.messages {
+		if strings.Contains(message, "retrying") {
+			t.Errorf("Expected no retry to be logged, got %q", message)
+		}
+	}
+}
+
+func TestValidateConfigRetries(t *testing.T) {
+	dir := t.TempDir()
+	for _, config := range []Config{{Dir: dir, Retries: -1}, {Dir: dir, RetryBackoff: -time.Second}} {
+		if err := ValidateConfig(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+	if err := ValidateConfig(Config{Dir: filepath.Clean(dir), Retries: 3, RetryBackoff: time.Second}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestWithConfigRetriesExhausted(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the fake qtc is slow")
+	}
+	fake := fakeqtc.Build(t, fakeqtc.Script{Stderr: temporaryStderr, ExitCode: 1})
+	fake.Install(t)
+
+	dir := t.TempDir()
+	writeTestTemplate(t, dir, testQtplFile, helloTemplate)
+
+	output := captureStdout(t, func() {
+		WithConfig(Config{Dir: dir, Retries: 1, RetryBackoff: time.Millisecond})
+	})
+
+	expected := "[qtc retry] attempt 1 failed, retrying in 1ms: qtc execution failed"
+	if !strings.Contains(output, expected) {
+		t.Errorf("Expected output to contain %q, got %q", expected, output)
+	}
+	if !strings.Contains(output, "compilation failed after 2 attempts") || strings.Contains(output, "[qtc warning suppressed]") {
+		t.Errorf("Expected exhausted retries to be reported as failure, got %q", output)
+	}
+}
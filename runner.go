@@ -0,0 +1,68 @@
+package qtcwrap
+
+import "context"
+
+// Runner runs the qtc compiler with command-line arguments built from the
+// configuration.
+//
+// The default Runner starts the qtc binary selected by Config.Qtc. A custom Runner,
+// installed with WithRunner, can run qtc in a container, on a remote
+// machine or not at all in tests. Returning a *QtcError lets failures take
+// part in warning suppression, retries and template diagnostics like those
+// of the default Runner. Runners are only used by the exec backend.
+//
+// Example:
+//
+//	runner := RunnerFunc(func(ctx context.Context, args []string) error {
+//	    cmd := exec.CommandContext(ctx, "docker", append([]string{"run", "qtc"}, args...)...)
+//	    return cmd.Run()
+//	})
+//	compiler := New(WithDir("templates"), WithRunner(runner))
+type Runner interface {
+	// Run runs qtc with args and returns once it has exited. It should stop
+	// qtc when ctx is done.
+	Run(ctx context.Context, args []string) error
+}
+
+// RunnerFunc adapts an ordinary function to the Runner interface.
+type RunnerFunc func(ctx context.Context, args []string) error
+
+// Run calls f(ctx, args).
+func (f RunnerFunc) Run(ctx context.Context, args []string) error {
+	return f(ctx, args)
+}
+
+// binaryRunner returns the default Runner, starting binary.
+func binaryRunner(binary string) Runner {
+	return RunnerFunc(func(ctx context.Context, args []string) error {
+		return executeQtcContext(ctx, binary, args)
+	})
+}
+
+// Logger receives progress messages of a Compiler, such as suppressed
+// warnings, retries and removed files. *log.Logger implements Logger.
+type Logger interface {
+	// Printf logs a message formatted like fmt.Sprintf. The message does
+	// not end with a newline.
+	Printf(format string, args ...any)
+}
+
+// runnerKey is the context key of the Runner used by a compilation.
+//
+// The Runner travels in the context rather than in Config so that Config
+// stays comparable.
+type runnerKey struct{}
+
+// withRunner returns a context whose compilations use runner.
+func withRunner(ctx context.Context, runner Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, runner)
+}
+
+// contextRunner returns the Runner installed in ctx, or the default Runner
+// starting binary.
+func contextRunner(ctx context.Context, binary string) Runner {
+	if runner, ok := ctx.Value(runnerKey{}).(Runner); ok && runner != nil {
+		return runner
+	}
+	return binaryRunner(binary)
+}
@@ -0,0 +1,326 @@
+package qtcwrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sourceMapExt is appended to a generated file name to form its source map.
+const sourceMapExt = ".map"
+
+// lineDirectivePrefix starts the line comments written by qtc.
+const lineDirectivePrefix = "//line "
+
+// goPositionPattern matches Go source positions such as "foo.qtpl.go:12" or
+// "/abs/path/foo.qtpl.go:12:7" in compiler errors and stack traces.
+var goPositionPattern = regexp.MustCompile(`([^\s:"'()]+\.go):(\d+)(?::(\d+))?`)
+
+// Position identifies a line in a template file.
+type Position struct {
+	// File is the template path.
+	File string `json:"file"`
+
+	// Line is the 1-based line number.
+	Line int `json:"line"`
+}
+
+// String returns the position in the usual "file:line" form.
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// SourceMap maps the lines of a generated Go file back to its template.
+//
+// Source maps make generated code traceable even when it was compiled with
+// SkipLineComments. They can be kept in memory or written next to the
+// generated file as a JSON side file.
+type SourceMap struct {
+	// Generated is the path of the generated Go file.
+	Generated string `json:"generated"`
+
+	// Template is the path of the template file.
+	Template string `json:"template"`
+
+	// Lines holds the template line of each generated line: Lines[i] belongs
+	// to generated line i+1. Zero means the line has no template counterpart.
+	Lines []int `json:"lines"`
+}
+
+// TemplatePosition returns the template position of a generated line.
+//
+// The second return value is false if the line is out of range or has no
+// template counterpart, such as the header comment of a generated file.
+func (m *SourceMap) TemplatePosition(line int) (Position, bool) {
+	if line < 1 || line > len(m.Lines) || m.Lines[line-1] == 0 {
+		return Position{}, false
+	}
+	return Position{File: m.Template, Line: m.Lines[line-1]}, true
+}
+
+// BuildSourceMap computes the source map of the Go file generated for a
+// template.
+//
+// The template is compiled in memory with line comments, which are used to
+// compute the template line of every generated line. The map describes the
+// file qtc writes with the given skipLineComments setting; generated is
+// recorded as the path of that file.
+//
+// Example:
+//
+//	sourceMap, err := BuildSourceMap("templates/home.qtpl", "templates/home.qtpl.go", true)
+//	if err != nil {
+//	    fmt.Printf("Cannot build source map: %v\n", err)
+//	    return
+//	}
+//	pos, ok := sourceMap.TemplatePosition(42)
+func BuildSourceMap(template, generated string, skipLineComments bool) (*SourceMap, error) {
+	code, err := generateCode(template, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := mapGeneratedLines(code, skipLineComments)
+	if err != nil {
+		return nil, fmt.Errorf("cannot map generated code for %s: %w", template, err)
+	}
+	return &SourceMap{Generated: generated, Template: template, Lines: lines}, nil
+}
+
+// mapGeneratedLines computes the template line of every line of code, which
+// must contain qtc line comments.
+//
+// Line comments follow Go's semantics: the line after a comment has the
+// given line number and each following line increments it. With
+// skipLineComments, the line comments themselves are dropped from the
+// result, mirroring the code qtc writes without them.
+func mapGeneratedLines(code []byte, skipLineComments bool) ([]int, error) {
+	directives, err := lineDirectives(code)
+	if err != nil {
+		return nil, err
+	}
+
+	count := strings.Count(string(code), "\n")
+	if len(code) > 0 && code[len(code)-1] != '\n' {
+		count++
+	}
+
+	lines := make([]int, 0, count)
+	current := 0
+	for line := 1; line <= count; line++ {
+		if next, ok := directives[line]; ok {
+			current = next
+			if !skipLineComments {
+				lines = append(lines, current)
+			}
+			continue
+		}
+
+		lines = append(lines, current)
+		if current > 0 {
+			current++
+		}
+	}
+	return lines, nil
+}
+
+// lineDirectives returns the line comments in code, keyed by the line they
+// appear on, with the template line they announce as value.
+func lineDirectives(code []byte) (map[int]int, error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(code))
+
+	var scanErr error
+	var s scanner.Scanner
+	s.Init(file, code, func(pos token.Position, msg string) {
+		if scanErr == nil {
+			scanErr = fmt.Errorf("%s: %s", pos, msg)
+		}
+	}, scanner.ScanComments)
+
+	directives := make(map[int]int)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT || !strings.HasPrefix(lit, lineDirectivePrefix) {
+			continue
+		}
+
+		position := fset.PositionFor(pos, false)
+		if position.Column != 1 {
+			continue
+		}
+		colon := strings.LastIndex(lit, ":")
+		if colon < 0 {
+			continue
+		}
+		line, err := strconv.Atoi(lit[colon+1:])
+		if err != nil {
+			continue
+		}
+		directives[position.Line] = line
+	}
+	return directives, scanErr
+}
+
+// WriteSourceMap writes a source map as JSON next to its generated file.
+//
+// The side file is named after the generated file with a ".map" suffix,
+// for example "home.qtpl.go.map".
+func WriteSourceMap(m *SourceMap) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("cannot encode source map for %s: %w", m.Generated, err)
+	}
+
+	path := m.Generated + sourceMapExt
+	// #nosec G306 -- source maps are generated artifacts like the Go files they describe
+	if err := os.WriteFile(path, data, generatedFilePerm); err != nil {
+		return fmt.Errorf("cannot write source map %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReadSourceMap reads a source map side file written by WriteSourceMap.
+func ReadSourceMap(path string) (*SourceMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read source map %s: %w", path, err)
+	}
+
+	var m SourceMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot decode source map %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// writeSourceMaps writes the source map of every generated file in result.
+func writeSourceMaps(result *Result, skipLineComments bool) error {
+	for i, template := range result.Templates {
+		if i >= len(result.Generated) {
+			break
+		}
+
+		sourceMap, err := BuildSourceMap(template, result.Generated[i], skipLineComments)
+		if err != nil {
+			return err
+		}
+		if err := WriteSourceMap(sourceMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SourceMaps is a collection of source maps used to translate positions in
+// generated code back to templates.
+type SourceMaps struct {
+	maps []*SourceMap
+}
+
+// NewSourceMaps creates a collection from in-memory source maps.
+func NewSourceMaps(maps ...*SourceMap) *SourceMaps {
+	return &SourceMaps{maps: maps}
+}
+
+// LoadSourceMaps reads all source map side files below dir.
+//
+// Example:
+//
+//	maps, err := LoadSourceMaps("templates")
+//	if err != nil {
+//	    fmt.Printf("Cannot load source maps: %v\n", err)
+//	    return
+//	}
+//	fmt.Println(maps.Translate(buildOutput))
+func LoadSourceMaps(dir string) (*SourceMaps, error) {
+	files, err := FindTemplateFiles(dir, ".go"+sourceMapExt)
+	if err != nil {
+		return nil, err
+	}
+
+	maps := make([]*SourceMap, 0, len(files))
+	for _, file := range files {
+		m, err := ReadSourceMap(file)
+		if err != nil {
+			return nil, err
+		}
+		maps = append(maps, m)
+	}
+	return NewSourceMaps(maps...), nil
+}
+
+// Lookup returns the source map for a generated file.
+//
+// Absolute paths, as found in stack traces, and paths relative to the
+// current directory are matched against the generated file paths. Other
+// relative paths, as printed by the Go compiler for a package, are matched
+// by suffix.
+func (s *SourceMaps) Lookup(generated string) (*SourceMap, bool) {
+	abs, err := filepath.Abs(generated)
+	if err != nil {
+		return nil, false
+	}
+	suffix := string(filepath.Separator) + filepath.Clean(generated)
+
+	var bySuffix *SourceMap
+	for _, m := range s.maps {
+		mapAbs, err := filepath.Abs(m.Generated)
+		if err != nil {
+			continue
+		}
+		if mapAbs == abs {
+			return m, true
+		}
+		if !filepath.IsAbs(generated) && strings.HasSuffix(mapAbs, suffix) && bySuffix == nil {
+			bySuffix = m
+		}
+	}
+	return bySuffix, bySuffix != nil
+}
+
+// Position returns the template position of a line in a generated file.
+func (s *SourceMaps) Position(generated string, line int) (Position, bool) {
+	m, ok := s.Lookup(generated)
+	if !ok {
+		return Position{}, false
+	}
+	return m.TemplatePosition(line)
+}
+
+// Translate rewrites positions in generated code to template positions.
+//
+// It accepts Go compiler errors, vet output and panic stack traces. Every
+// "file.go:line" or "file.go:line:column" reference to a known generated
+// file is replaced by "template:line"; columns are dropped since they refer
+// to generated code. Other text is returned unchanged.
+//
+// Example:
+//
+//	// ./home.qtpl.go:42:9: undefined: title
+//	// becomes
+//	// templates/home.qtpl:7: undefined: title
+//	fmt.Println(maps.Translate(string(buildOutput)))
+func (s *SourceMaps) Translate(text string) string {
+	return goPositionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := goPositionPattern.FindStringSubmatch(match)
+		line, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return match
+		}
+		pos, ok := s.Position(parts[1], line)
+		if !ok {
+			return match
+		}
+		return pos.String()
+	})
+}
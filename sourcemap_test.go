@@ -0,0 +1,181 @@
+package qtcwrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	// Source map test constants.
+	controlTemplate = "control.qtpl"
+	itemsExpr       = "items[0]"
+)
+
+// generatedLine returns the 1-based number of the first line in file that
+// contains substr.
+func generatedLine(t *testing.T, file, substr string) int {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf(readGeneratedErr, err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.Contains(line, substr) {
+			return i + 1
+		}
+	}
+	t.Fatalf("Expected %s to contain %q", file, substr)
+	return 0
+}
+
+func TestMapGeneratedLines(t *testing.T) {
+	code := []byte("// header\n\n//line a.qtpl:1\npackage a\n//line a.qtpl:5\nfunc A() {\n\tprintln(`x\ny`)\n}\n")
+
+	tests := []struct {
+		name             string
+		skipLineComments bool
+		expected         []int
+	}{
+		{"WithLineComments", false, []int{0, 0, 1, 1, 5, 5, 6, 7, 8}},
+		{"WithoutLineComments", true, []int{0, 0, 1, 5, 6, 7, 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := mapGeneratedLines(code, tt.skipLineComments)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, lines)
+			}
+			for i := range lines {
+				if lines[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, lines)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSourceMap(t *testing.T) {
+	for _, skipLineComments := range []bool{true, false} {
+		dir := copyCorpus(t)
+		template := filepath.Join(dir, controlTemplate)
+
+		if _, err := Compile(Config{File: template, SkipLineComments: skipLineComments, Backend: EmbeddedBackend}); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+
+		sourceMap, err := BuildSourceMap(template, template+goExt, skipLineComments)
+		if err != nil {
+			t.Fatalf("BuildSourceMap failed: %v", err)
+		}
+
+		line := generatedLine(t, template+goExt, itemsExpr)
+		pos, ok := sourceMap.TemplatePosition(line)
+		if !ok {
+			t.Fatalf("Expected generated line %d to be mapped", line)
+		}
+		if pos.File != template || pos.Line != 9 {
+			t.Errorf("Expected %s:9, got %s (skipLineComments=%t)", template, pos, skipLineComments)
+		}
+
+		if _, ok := sourceMap.TemplatePosition(1); ok {
+			t.Error("Expected header comment not to be mapped")
+		}
+		if _, ok := sourceMap.TemplatePosition(len(sourceMap.Lines) + 1); ok {
+			t.Error("Expected out of range line not to be mapped")
+		}
+	}
+}
+
+func TestCompileWithSourceMaps(t *testing.T) {
+	dir := copyCorpus(t)
+
+	result, err := Compile(Config{Dir: dir, SkipLineComments: true, Backend: EmbeddedBackend, SourceMaps: true})
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	for _, generated := range result.Generated {
+		if _, err := os.Stat(generated + sourceMapExt); err != nil {
+			t.Errorf("Expected source map for %s: %v", generated, err)
+		}
+	}
+
+	maps, err := LoadSourceMaps(dir)
+	if err != nil {
+		t.Fatalf("LoadSourceMaps failed: %v", err)
+	}
+
+	generated := filepath.Join(dir, controlTemplate+goExt)
+	line := generatedLine(t, generated, itemsExpr)
+	pos, ok := maps.Position(generated, line)
+	if !ok || pos.Line != 9 {
+		t.Errorf("Expected loaded source map to map line %d to 9, got %v (%t)", line, pos, ok)
+	}
+}
+
+func TestReadSourceMapErrors(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	invalid := writeTestTemplate(t, tempDir, "invalid.qtpl.go.map", "not json")
+
+	if _, err := ReadSourceMap(filepath.Join(tempDir, "missing.map")); err == nil {
+		t.Error("Expected error for missing source map")
+	}
+	assertValidationError(t, func() error {
+		_, err := ReadSourceMap(invalid)
+		return err
+	}(), "cannot decode source map", true)
+}
+
+func TestSourceMapsTranslate(t *testing.T) {
+	tempDir := createTempTestDir(t)
+	defer cleanupTempDir(t, tempDir)
+
+	generated := filepath.Join(tempDir, "views", "home.qtpl.go")
+	maps := NewSourceMaps(&SourceMap{
+		Generated: generated,
+		Template:  "views/home.qtpl",
+		Lines:     []int{0, 0, 3, 4, 7},
+	})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "CompilerError",
+			input:    "views/home.qtpl.go:4:9: undefined: title",
+			expected: "views/home.qtpl:4: undefined: title",
+		},
+		{
+			name:     "PanicStackTrace",
+			input:    "main.StreamHome(...)\n\t" + generated + ":5 +0x1d",
+			expected: "main.StreamHome(...)\n\tviews/home.qtpl:7 +0x1d",
+		},
+		{
+			name:     "UnmappedLine",
+			input:    "views/home.qtpl.go:1:1: expected package",
+			expected: "views/home.qtpl.go:1:1: expected package",
+		},
+		{
+			name:     "UnknownFile",
+			input:    "main.go:12:3: undefined: x",
+			expected: "main.go:12:3: undefined: x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maps.Translate(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
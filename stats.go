@@ -0,0 +1,251 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// TemplateStats holds size and complexity metrics of a single template.
+type TemplateStats struct {
+	// Template is the path of the template.
+	Template string `json:"template"`
+
+	// Lines is the number of lines of the template.
+	Lines int `json:"lines"`
+
+	// Funcs is the number of template funcs declared with {% func %}.
+	Funcs int `json:"funcs"`
+
+	// OutputTags is the number of tags writing output, such as {%s %},
+	// {%d %} and template func calls with {%= %}.
+	OutputTags int `json:"outputTags"`
+
+	// RawOutputs is the number of output tags writing values without
+	// escaping, such as {%s= %}.
+	RawOutputs int `json:"rawOutputs"`
+
+	// MaxDepth is the deepest nesting of for, if and switch blocks.
+	MaxDepth int `json:"maxDepth"`
+
+	// MaxDepthLine is the template line where MaxDepth is first reached,
+	// or zero if the template has no control flow.
+	MaxDepthLine int `json:"maxDepthLine,omitempty"`
+
+	// GeneratedBytes is the size of the Go code generated for the template.
+	GeneratedBytes int `json:"generatedBytes"`
+}
+
+// Stats holds the metrics of a set of templates.
+type Stats struct {
+	// Templates holds the metrics of every template, in discovery order.
+	Templates []TemplateStats `json:"templates"`
+
+	// Total sums the metrics of all templates. MaxDepth is the deepest
+	// nesting found in any template; Template and MaxDepthLine are empty.
+	Total TemplateStats `json:"total"`
+}
+
+// Thresholds bounds the metrics of a single template. Zero disables a
+// bound.
+type Thresholds struct {
+	// MaxLines bounds TemplateStats.Lines.
+	MaxLines int
+
+	// MaxFuncs bounds TemplateStats.Funcs.
+	MaxFuncs int
+
+	// MaxOutputTags bounds TemplateStats.OutputTags.
+	MaxOutputTags int
+
+	// MaxRawOutputs bounds TemplateStats.RawOutputs.
+	MaxRawOutputs int
+
+	// MaxDepth bounds TemplateStats.MaxDepth.
+	MaxDepth int
+
+	// MaxGeneratedBytes bounds TemplateStats.GeneratedBytes.
+	MaxGeneratedBytes int
+}
+
+// CollectStats measures the templates selected by config.
+//
+// Tags are counted by scanning the templates the way quicktemplate's
+// parser does, and every template is compiled in memory with the embedded
+// backend to measure the generated code, so neither qtc nor generated
+// files are needed. A template that does not compile fails the collection.
+//
+// Example:
+//
+//	stats, err := CollectStats(Config{Dir: "templates", SkipLineComments: true})
+//	if err != nil {
+//	    fmt.Printf("Cannot collect statistics: %v\n", err)
+//	    return
+//	}
+//	_ = stats.WriteCSV(os.Stdout)
+//	if err := stats.Check(Thresholds{MaxDepth: 4, MaxRawOutputs: 0}); err != nil {
+//	    fmt.Println(err)
+//	}
+func CollectStats(config Config) (*Stats, error) {
+	templates, err := configTemplates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	for _, template := range templates {
+		ts, err := templateStats(template, config.SkipLineComments)
+		if err != nil {
+			return nil, err
+		}
+		stats.Templates = append(stats.Templates, ts)
+
+		stats.Total.Lines += ts.Lines
+		stats.Total.Funcs += ts.Funcs
+		stats.Total.OutputTags += ts.OutputTags
+		stats.Total.RawOutputs += ts.RawOutputs
+		stats.Total.GeneratedBytes += ts.GeneratedBytes
+		stats.Total.MaxDepth = max(stats.Total.MaxDepth, ts.MaxDepth)
+	}
+	return stats, nil
+}
+
+// templateStats measures a single template.
+func templateStats(template string, skipLineComments bool) (TemplateStats, error) {
+	src, err := os.ReadFile(template) // #nosec G304 -- templates are selected by the caller's configuration
+	if err != nil {
+		return TemplateStats{}, fmt.Errorf("cannot read template %s: %w", template, err)
+	}
+
+	tags, err := scanTags(src)
+	if err != nil {
+		return TemplateStats{}, fmt.Errorf("cannot scan template %s: %w", template, err)
+	}
+
+	code, err := generateCode(template, skipLineComments)
+	if err != nil {
+		return TemplateStats{}, err
+	}
+
+	ts := TemplateStats{Template: template, Lines: countLines(src), GeneratedBytes: len(code)}
+	depth := 0
+	for _, tag := range tags {
+		switch {
+		case tag.name == "func":
+			ts.Funcs++
+		case tag.name == "for" || tag.name == "if" || tag.name == "switch":
+			depth++
+			if depth > ts.MaxDepth {
+				ts.MaxDepth, ts.MaxDepthLine = depth, tag.line
+			}
+		case tag.name == "endfor" || tag.name == "endif" || tag.name == "endswitch":
+			depth--
+		case tag.isOutputTag():
+			ts.OutputTags++
+			if tag.isRawOutput() {
+				ts.RawOutputs++
+			}
+		}
+	}
+	return ts, nil
+}
+
+// countLines returns the number of lines of src. A final line without a
+// trailing newline counts as a line.
+func countLines(src []byte) int {
+	lines := bytes.Count(src, []byte("\n"))
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// Check compares every template with the thresholds and returns a
+// *CheckError with one RuleComplexity diagnostic per exceeded bound, or
+// nil if all templates are within bounds. The diagnostics can be written
+// with Report to fail CI builds.
+//
+// Example:
+//
+//	err := stats.Check(Thresholds{MaxLines: 500, MaxDepth: 4})
+//	var checkErr *CheckError
+//	if errors.As(err, &checkErr) {
+//	    _ = Report{Result: &Result{Diagnostics: checkErr.Diagnostics}}.WriteSARIF(f)
+//	}
+func (s *Stats) Check(thresholds Thresholds) error {
+	var diagnostics []Diagnostic
+	for _, ts := range s.Templates {
+		limits := []struct {
+			metric string
+			value  int
+			limit  int
+			line   int
+		}{
+			{"lines", ts.Lines, thresholds.MaxLines, 0},
+			{"funcs", ts.Funcs, thresholds.MaxFuncs, 0},
+			{"output tags", ts.OutputTags, thresholds.MaxOutputTags, 0},
+			{"raw outputs", ts.RawOutputs, thresholds.MaxRawOutputs, 0},
+			{"nesting depth", ts.MaxDepth, thresholds.MaxDepth, ts.MaxDepthLine},
+			{"generated bytes", ts.GeneratedBytes, thresholds.MaxGeneratedBytes, 0},
+		}
+
+		for _, l := range limits {
+			if l.limit <= 0 || l.value <= l.limit {
+				continue
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     ts.Template,
+				Line:     l.line,
+				Rule:     RuleComplexity,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("%s: %d exceeds the limit of %d", l.metric, l.value, l.limit),
+			})
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		return &CheckError{Diagnostics: diagnostics}
+	}
+	return nil
+}
+
+// statsColumns lists the CSV columns written by WriteCSV.
+var statsColumns = []string{"template", "lines", "funcs", "output_tags", "raw_outputs", "max_depth", "generated_bytes"}
+
+// WriteCSV writes one CSV record per template, preceded by a header
+// record. The totals are not included.
+func (s *Stats) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(statsColumns); err != nil {
+		return fmt.Errorf("cannot write statistics: %w", err)
+	}
+	for _, ts := range s.Templates {
+		record := []string{ts.Template}
+		for _, value := range []int{ts.Lines, ts.Funcs, ts.OutputTags, ts.RawOutputs, ts.MaxDepth, ts.GeneratedBytes} {
+			record = append(record, strconv.Itoa(value))
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("cannot write statistics: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("cannot write statistics: %w", err)
+	}
+	return nil
+}
+
+// WriteJSON writes the statistics, including the totals, as an indented
+// JSON document.
+func (s *Stats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("cannot write statistics: %w", err)
+	}
+	return nil
+}
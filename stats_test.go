@@ -0,0 +1,156 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectStats(t *testing.T) {
+	stats, err := CollectStats(Config{Dir: corpusDir, SkipLineComments: true})
+	if err != nil {
+		t.Fatalf("CollectStats failed: %v", err)
+	}
+
+	expected := map[string]TemplateStats{
+		"basic.qtpl":          {Lines: 8, Funcs: 1, OutputTags: 9, RawOutputs: 1},
+		controlTemplate:       {Lines: 26, Funcs: 1, OutputTags: 3, MaxDepth: 3, MaxDepthLine: 13},
+		"emails/welcome.qtpl": {Funcs: 1},
+		"layout/page.qtpl":    {Funcs: 3},
+	}
+	if len(stats.Templates) != len(expected) {
+		t.Fatalf("Expected %d templates, got %+v", len(expected), stats.Templates)
+	}
+
+	var total int
+	for _, ts := range stats.Templates {
+		rel, _ := filepath.Rel(corpusDir, ts.Template)
+		want, ok := expected[filepath.ToSlash(rel)]
+		if !ok {
+			t.Errorf("Unexpected template %s", ts.Template)
+			continue
+		}
+		if ts.Funcs != want.Funcs {
+			t.Errorf("%s: expected %d funcs, got %d", rel, want.Funcs, ts.Funcs)
+		}
+		if want.Lines > 0 && (ts.Lines != want.Lines || ts.OutputTags != want.OutputTags || ts.RawOutputs != want.RawOutputs ||
+			ts.MaxDepth != want.MaxDepth || ts.MaxDepthLine != want.MaxDepthLine) {
+			t.Errorf("%s: expected %+v, got %+v", rel, want, ts)
+		}
+		if ts.GeneratedBytes == 0 {
+			t.Errorf("%s: expected the generated code size", rel)
+		}
+		total += ts.Lines
+	}
+
+	if stats.Total.Lines != total || stats.Total.MaxDepth != 3 || stats.Total.Funcs != 6 {
+		t.Errorf("Unexpected totals %+v", stats.Total)
+	}
+}
+
+func TestCollectStatsErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("MissingDir", func(t *testing.T) {
+		if _, err := CollectStats(Config{Dir: filepath.Join(dir, "missing")}); err == nil {
+			t.Error("Expected an error for a missing directory")
+		}
+	})
+
+	t.Run("BrokenTemplate", func(t *testing.T) {
+		writeTestTemplate(t, dir, "broken.qtpl", brokenTemplate)
+		if _, err := CollectStats(Config{Dir: dir}); err == nil {
+			t.Error("Expected an error for a broken template")
+		}
+	})
+}
+
+func TestStatsCheck(t *testing.T) {
+	stats := &Stats{Templates: []TemplateStats{
+		{Template: "a.qtpl", Lines: 10, Funcs: 2, OutputTags: 5, RawOutputs: 1, MaxDepth: 4, MaxDepthLine: 7, GeneratedBytes: 900},
+		{Template: "b.qtpl", Lines: 3, Funcs: 1},
+	}}
+
+	tests := []struct {
+		name       string
+		thresholds Thresholds
+		expected   []string
+	}{
+		{"Unlimited", Thresholds{}, nil},
+		{"WithinBounds", Thresholds{MaxLines: 10, MaxDepth: 4}, nil},
+		{"Lines", Thresholds{MaxLines: 5}, []string{"a.qtpl: lines: 10 exceeds the limit of 5"}},
+		{"Depth", Thresholds{MaxDepth: 3}, []string{"a.qtpl:7: nesting depth: 4 exceeds the limit of 3"}},
+		{
+			name:       "Several",
+			thresholds: Thresholds{MaxFuncs: 1, MaxOutputTags: 4, MaxRawOutputs: 0, MaxGeneratedBytes: 800},
+			expected: []string{
+				"a.qtpl: funcs: 2 exceeds the limit of 1",
+				"a.qtpl: output tags: 5 exceeds the limit of 4",
+				"a.qtpl: generated bytes: 900 exceeds the limit of 800",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := stats.Check(tt.thresholds)
+			if tt.expected == nil {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var checkErr *CheckError
+			if !errors.As(err, &checkErr) {
+				t.Fatalf("Expected a *CheckError, got %v", err)
+			}
+			if len(checkErr.Diagnostics) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, checkErr.Diagnostics)
+			}
+			for i, diagnostic := range checkErr.Diagnostics {
+				if diagnostic.String() != tt.expected[i] || diagnostic.Rule != RuleComplexity {
+					t.Errorf("Expected %q, got %+v", tt.expected[i], diagnostic)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsExport(t *testing.T) {
+	stats := &Stats{
+		Templates: []TemplateStats{{Template: "a.qtpl", Lines: 10, Funcs: 2, OutputTags: 5, RawOutputs: 1, MaxDepth: 2, MaxDepthLine: 4, GeneratedBytes: 900}},
+		Total:     TemplateStats{Lines: 10, Funcs: 2, OutputTags: 5, RawOutputs: 1, MaxDepth: 2, GeneratedBytes: 900},
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := stats.WriteCSV(&buf); err != nil {
+			t.Fatalf("WriteCSV failed: %v", err)
+		}
+		expected := "template,lines,funcs,output_tags,raw_outputs,max_depth,generated_bytes\na.qtpl,10,2,5,1,2,900\n"
+		if buf.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := stats.WriteJSON(&buf); err != nil {
+			t.Fatalf("WriteJSON failed: %v", err)
+		}
+		if !strings.Contains(buf.String(), `"rawOutputs": 1`) {
+			t.Errorf("Expected camel-case fields, got %s", buf.String())
+		}
+		var decoded Stats
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		if len(decoded.Templates) != 1 || decoded.Templates[0] != stats.Templates[0] || decoded.Total != stats.Total {
+			t.Errorf("Expected %+v, got %+v", stats, decoded)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package qtcwrap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// templateTag is a {% ... %} tag found in a template.
+type templateTag struct {
+	// name is the tag name, such as "func", "s=" or "endif". A precision
+	// suffix, as in "f.2", is removed.
+	name string
+
+	// value holds the tag contents following the name.
+	value string
+
+	// line is the 1-based template line the tag starts on.
+	line int
+
+	// text holds the template text between the previous tag and this one,
+	// including the contents of a preceding plain block.
+	text string
+}
+
+// outputTags lists the names of tags that write output, as accepted by
+// quicktemplate's parser.
+var outputTags = map[string]bool{
+	"s": true, "v": true, "d": true, "dl": true, "dul": true, "f": true, "q": true, "z": true, "j": true, "u": true,
+	"s=": true, "v=": true, "d=": true, "dl=": true, "dul=": true, "f=": true, "q=": true, "z=": true, "j=": true, "u=": true,
+	"sz": true, "qz": true, "jz": true, "uz": true,
+	"sz=": true, "qz=": true, "jz=": true, "uz=": true,
+	"=": true, "=h": true, "=u": true, "=uh": true, "=q": true, "=qh": true, "=j": true, "=jh": true,
+}
+
+// isOutputTag reports whether the tag writes output.
+func (t templateTag) isOutputTag() bool {
+	return outputTags[t.name]
+}
+
+// isRawOutput reports whether the tag writes a value without escaping,
+// such as {%s= %}. Calls of template funcs, such as {%= %}, are not raw,
+// since the called func escapes its own output.
+func (t templateTag) isRawOutput() bool {
+	return t.isOutputTag() && len(t.name) > 1 && strings.HasSuffix(t.name, "=")
+}
+
+// skippedBlock describes a block whose contents are not parsed as
+// template code.
+type skippedBlock struct {
+	// end is the name of the tag ending the block.
+	end string
+
+	// text reports whether the contents are written as template text.
+	text bool
+}
+
+// skippedBlocks maps tags starting a skipped block to its description.
+var skippedBlocks = map[string]skippedBlock{
+	"plain":   {end: "endplain", text: true},
+	"comment": {end: "endcomment"},
+}
+
+// scanTags returns the tags of a template in source order, the way
+// quicktemplate's scanner finds them: a tag runs from "{%" to the next
+// "%}", and the contents of plain and comment blocks are skipped.
+// Whitespace trimming markers, as in "{%- if x -%}", are removed.
+func scanTags(src []byte) ([]templateTag, error) {
+	var tags []templateTag
+	line := 1
+	textStart := 0
+	var skip *skippedBlock
+	for pos := 0; ; {
+		start := bytes.Index(src[pos:], []byte("{%"))
+		if start < 0 {
+			break
+		}
+		start += pos
+		line += bytes.Count(src[pos:start], []byte("\n"))
+
+		end := bytes.Index(src[start+2:], []byte("%}"))
+		if end < 0 {
+			if skip != nil {
+				break
+			}
+			return tags, fmt.Errorf("line %d: unterminated tag", line)
+		}
+		end += start + 2
+		tag := parseTag(src[start+2:end], line)
+		line += bytes.Count(src[start+2:end], []byte("\n"))
+		pos = end + 2
+
+		if skip != nil {
+			if tag.name != skip.end {
+				continue
+			}
+			if skip.text {
+				tag.text = string(src[textStart:start])
+			}
+			skip = nil
+		} else {
+			tag.text = string(src[textStart:start])
+		}
+		textStart = pos
+
+		if block, ok := skippedBlocks[tag.name]; ok {
+			skip = &block
+		}
+		tags = append(tags, tag)
+	}
+
+	if skip != nil {
+		return tags, fmt.Errorf("line %d: missing %s tag", line, skip.end)
+	}
+	return tags, nil
+}
+
+// parseTag splits the contents of a tag between "{%" and "%}" into its
+// name and value.
+func parseTag(contents []byte, line int) templateTag {
+	text := strings.TrimSpace(string(contents))
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "-"), "-"))
+
+	name, value := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, value = text[:i], text[i+1:]
+	}
+	if prefix, precision, ok := strings.Cut(name, "."); ok {
+		name = prefix
+		if strings.HasSuffix(precision, "=") {
+			name += "="
+		}
+	}
+	return templateTag{name: name, value: strings.TrimSpace(value), line: line}
+}
+
+// parseTagCode parses the Go code of a tag: the expression of an output
+// tag, or the statement of a for, if, elseif, switch, case or code tag. It
+// returns nil for other tags and for code that does not parse.
+//
+// Line 1 of fset positions is the first line of the tag value, so
+// tag.line+position.Line-1 is the template line of a node.
+func parseTagCode(fset *token.FileSet, tag templateTag) ast.Node {
+	if _, ok := tagEscaping[tag.name]; ok {
+		expr, err := parser.ParseExprFrom(fset, "", tag.value, 0)
+		if err != nil {
+			return nil
+		}
+		return expr
+	}
+
+	var stmt string
+	switch tag.name {
+	case "for", "if", "switch":
+		stmt = tag.name + " " + tag.value + " {}"
+	case "elseif":
+		stmt = "if " + tag.value + " {}"
+	case "case":
+		stmt = "switch { case " + tag.value + ": }"
+	case "code":
+		stmt = tag.value
+	default:
+		return nil
+	}
+	file, err := parser.ParseFile(fset, "", "package p; func _() {"+stmt+"\n}", 0)
+	if err != nil {
+		return nil
+	}
+	return file
+}
@@ -0,0 +1,113 @@
+package qtcwrap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []templateTag
+	}{
+		{"NoTags", "plain text\n", nil},
+		{
+			name: "NameAndValue",
+			src:  "{% func Page(p string) %}\n\t{%s= p %}\n{% endfunc %}",
+			expected: []templateTag{
+				{name: "func", value: "Page(p string)", line: 1},
+				{name: "s=", value: "p", line: 2, text: "\n\t"},
+				{name: "endfunc", line: 3, text: "\n"},
+			},
+		},
+		{
+			name:     "TrimMarkers",
+			src:      "{%- if ok -%}{%-endif-%}",
+			expected: []templateTag{{name: "if", value: "ok", line: 1}, {name: "endif", line: 1}},
+		},
+		{"Precision", "{%f.2 price %}", []templateTag{{name: "f", value: "price", line: 1}}},
+		{"RawPrecision", "{%f.2= price %}", []templateTag{{name: "f=", value: "price", line: 1}}},
+		{
+			name:     "MultilineTag",
+			src:      "{% if a &&\n\tb %}\n{% endif %}",
+			expected: []templateTag{{name: "if", value: "a &&\n\tb", line: 1}, {name: "endif", line: 3, text: "\n"}},
+		},
+		{
+			name: "SkippedBlocks",
+			src:  "{% plain %}<b>{%s x %}{% endplain %}\n{% comment %}\n{% for %}\n{% endcomment %}",
+			expected: []templateTag{
+				{name: "plain", line: 1},
+				{name: "endplain", line: 1, text: "<b>{%s x %}"},
+				{name: "comment", line: 2, text: "\n"},
+				{name: "endcomment", line: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := scanTags([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(tags) != len(tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, tags)
+			}
+			for i := range tt.expected {
+				if tags[i] != tt.expected[i] {
+					t.Errorf("Tag %d: expected %+v, got %+v", i, tt.expected[i], tags[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScanTagsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{"UnterminatedTag", "text\n{% if x ", "line 2: unterminated tag"},
+		{"MissingEndTag", "{% comment %}\n{%s x %}\n", "line 2: missing endcomment tag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := scanTags([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestTemplateTagOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output bool
+		raw    bool
+	}{
+		{"s", true, false},
+		{"s=", true, true},
+		{"dul=", true, true},
+		{"qz=", true, true},
+		{"=", true, false},
+		{"=h", true, false},
+		{"if", false, false},
+		{"func", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := templateTag{name: tt.name}
+			if tag.isOutputTag() != tt.output {
+				t.Errorf("Expected isOutputTag %v", tt.output)
+			}
+			if tag.isRawOutput() != tt.raw {
+				t.Errorf("Expected isRawOutput %v", tt.raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Code generated by qtc from "basic.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+// Basic template covering plain output tags.
+//
+
+package corpus
+
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+func StreamGreeting(qw422016 *qt422016.Writer, name string, count int) {
+	qw422016.N().S(`
+	Hello, `)
+	qw422016.E().S(name)
+	qw422016.N().S(`! You have `)
+	qw422016.N().D(count)
+	qw422016.N().S(` new messages.
+	`)
+	qw422016.N().S("<b>raw</b>")
+	qw422016.N().S(`
+	`)
+	qw422016.E().Q("quoted")
+	qw422016.N().S(` `)
+	qw422016.E().J("json")
+	qw422016.N().S(` `)
+	qw422016.N().U("a b")
+	qw422016.N().S(`
+	`)
+	qw422016.N().FPrec(3.14159, 2)
+	qw422016.N().S(` `)
+	qw422016.E().V([]int{1, 2})
+	qw422016.N().S(` `)
+	qw422016.E().Z([]byte("bytes"))
+	qw422016.N().S(`
+`)
+}
+
+func WriteGreeting(qq422016 qtio422016.Writer, name string, count int) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	StreamGreeting(qw422016, name, count)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func Greeting(name string, count int) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	WriteGreeting(qb422016, name, count)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -0,0 +1,89 @@
+// Code generated by qtc from "control.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+package corpus
+
+import "strings"
+
+// Control flow constructs.
+//
+
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+func StreamList(qw422016 *qt422016.Writer, items []string) {
+	qw422016.N().S(`
+	`)
+	if len(items) == 0 {
+		qw422016.N().S(`
+		<p>No items</p>
+	`)
+	} else if len(items) == 1 {
+		qw422016.N().S(`
+		<p>One item: `)
+		qw422016.E().S(items[0])
+		qw422016.N().S(`</p>
+	`)
+	} else {
+		qw422016.N().S(`
+		<ul>
+		`)
+		for i, item := range items {
+			qw422016.N().S(`
+			`)
+			if i > 10 {
+				break
+			}
+			qw422016.N().S(`
+			<li>`)
+			qw422016.N().D(i)
+			qw422016.N().S(`: `)
+			qw422016.E().S(strings.ToUpper(item))
+			qw422016.N().S(`</li>
+		`)
+		}
+		qw422016.N().S(`
+		</ul>
+	`)
+	}
+	qw422016.N().S(`
+	`)
+	switch len(items) {
+	case 0:
+		qw422016.N().S(`
+		empty
+	`)
+	case 1, 2:
+		qw422016.N().S(`
+		few
+	`)
+	default:
+		qw422016.N().S(`
+		many
+	`)
+	}
+	qw422016.N().S(`
+`)
+}
+
+func WriteList(qq422016 qtio422016.Writer, items []string) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	StreamList(qw422016, items)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func List(items []string) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	WriteList(qb422016, items)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -0,0 +1,57 @@
+// Code generated by qtc from "welcome.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+package mail
+
+// Plain text e-mail with a custom package name.
+//
+
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+func StreamWelcome(qw422016 *qt422016.Writer, user string) {
+	qw422016.N().S(`
+Welcome `)
+	qw422016.E().S(user)
+	qw422016.N().S(`,
+`)
+	qw422016.N().S(` `)
+	qw422016.N().S(`thanks for signing up.`)
+	qw422016.N().S(`
+`)
+	qw422016.N().S(`
+`)
+	qw422016.N().S(`Basic template covering plain output tags.
+
+{% func Greeting(name string, count int) %}
+	Hello, {%s name %}! You have {%d count %} new messages.
+	{%s= "<b>raw</b>" %}
+	{%q "quoted" %} {%j "json" %} {%u "a b" %}
+	{%f.2 3.14159 %} {%v []int{1, 2} %} {%z []byte("bytes") %}
+{% endfunc %}
+`)
+	qw422016.N().S(`
+`)
+}
+
+func WriteWelcome(qq422016 qtio422016.Writer, user string) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	StreamWelcome(qw422016, user)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func Welcome(user string) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	WriteWelcome(qb422016, user)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
@@ -0,0 +1,110 @@
+// Code generated by qtc from "page.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+// Page layout built from an interface.
+//
+
+package layout
+
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+type Page interface {
+	Title() string
+	StreamTitle(qw422016 *qt422016.Writer)
+	WriteTitle(qq422016 qtio422016.Writer)
+	Body() string
+	StreamBody(qw422016 *qt422016.Writer)
+	WriteBody(qq422016 qtio422016.Writer)
+}
+
+func StreamPageTemplate(qw422016 *qt422016.Writer, p Page) {
+	qw422016.N().S(`
+<html>
+	<head><title>`)
+	p.StreamTitle(qw422016)
+	qw422016.N().S(`</title></head>
+	<body>
+		`)
+	p.StreamBody(qw422016)
+	qw422016.N().S(`
+	</body>
+</html>
+`)
+}
+
+func WritePageTemplate(qq422016 qtio422016.Writer, p Page) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	StreamPageTemplate(qw422016, p)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func PageTemplate(p Page) string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	WritePageTemplate(qb422016, p)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+type BasePage struct {
+	Name string
+}
+
+func (p *BasePage) StreamTitle(qw422016 *qt422016.Writer) {
+	qw422016.E().S(p.Name)
+}
+
+func (p *BasePage) WriteTitle(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	p.StreamTitle(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (p *BasePage) Title() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	p.WriteTitle(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
+
+func (p *BasePage) StreamBody(qw422016 *qt422016.Writer) {
+	qw422016.N().S(`
+	`)
+	qw422016.N().S(`<div>`)
+	qw422016.E().S(p.Name)
+	qw422016.N().S(`</div>`)
+	qw422016.N().S(`
+	`)
+	qw422016.N().S(` <span>   spaced   </span> `)
+	qw422016.N().S(`
+	`)
+	qw422016.N().S(`{% not a tag %}`)
+	qw422016.N().S(`
+	`)
+	qw422016.N().S(`
+`)
+}
+
+func (p *BasePage) WriteBody(qq422016 qtio422016.Writer) {
+	qw422016 := qt422016.AcquireWriter(qq422016)
+	p.StreamBody(qw422016)
+	qt422016.ReleaseWriter(qw422016)
+}
+
+func (p *BasePage) Body() string {
+	qb422016 := qt422016.AcquireByteBuffer()
+	p.WriteBody(qb422016)
+	qs422016 := string(qb422016.B)
+	qt422016.ReleaseByteBuffer(qb422016)
+	return qs422016
+}
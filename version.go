@@ -0,0 +1,346 @@
+package qtcwrap
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionPattern matches semantic versions such as "v1.8.0" or
+// "1.8.0-rc.1+build" anywhere in a string.
+var versionPattern = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?`)
+
+// Version is a semantic version of qtc or quicktemplate.
+type Version struct {
+	// Major, Minor and Patch are the numeric version components.
+	Major, Minor, Patch int
+
+	// Prerelease holds the pre-release part without the leading dash, such
+	// as "rc.1" or the timestamp and revision of a Go pseudo-version.
+	Prerelease string
+}
+
+// ParseVersion extracts the first semantic version found in s.
+//
+// The leading "v" is optional and build metadata is ignored, so the raw
+// output of GetQtcVersion, go.mod require lines and plain versions are all
+// accepted.
+//
+// Example:
+//
+//	version, err := ParseVersion("github.com/valyala/quicktemplate v1.8.0")
+//	if err != nil {
+//	    fmt.Printf("Unexpected version: %v\n", err)
+//	    return
+//	}
+//	fmt.Println(version) // v1.8.0
+func ParseVersion(s string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, fmt.Errorf("no semantic version found in %q", s)
+	}
+
+	var version Version
+	for i, field := range []*int{&version.Major, &version.Minor, &version.Patch} {
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %w", match[0], err)
+		}
+		*field = n
+	}
+	version.Prerelease = match[4]
+	return version, nil
+}
+
+// String returns the version in the "v1.2.3" form used by Go modules.
+func (v Version) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or +1 depending on whether v is lower than, equal
+// to or greater than other.
+//
+// A pre-release is lower than the release it precedes. Pre-releases of the
+// same version are compared by their dot-separated identifiers as semantic
+// versioning specifies, so "rc.2" is lower than "rc.10".
+func (v Version) Compare(other Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	default:
+		return comparePrerelease(v.Prerelease, other.Prerelease)
+	}
+}
+
+// comparePrerelease compares two pre-release parts identifier by
+// identifier. Numeric identifiers are compared numerically and are lower
+// than alphanumeric ones, which are compared as strings; when all shared
+// identifiers are equal, the part with fewer identifiers is lower.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, y := as[i], bs[i]
+		xNumeric, yNumeric := isNumericIdentifier(x), isNumericIdentifier(y)
+		var c int
+		switch {
+		case xNumeric && yNumeric:
+			// Without leading zeros, a longer number is a greater one.
+			if c = len(x) - len(y); c == 0 {
+				c = strings.Compare(x, y)
+			}
+		case xNumeric:
+			c = -1
+		case yNumeric:
+			c = 1
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c < 0 {
+			return -1
+		}
+		if c > 0 {
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// isNumericIdentifier reports whether a pre-release identifier consists of
+// digits only.
+func isNumericIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckQtcVersion checks the compiler selected by config against its
+// version constraints.
+//
+// MinQtcVersion and MaxQtcVersion bound the compiler version, both
+// inclusively. With MatchModuleVersion, the compiler version must equal the
+// github.com/valyala/quicktemplate version required by the go.mod file
+// governing the templates, since code generated by one version may not
+// work with the runtime library of another.
+//
+// For the exec backend the version of the qtc binary is checked; for the
+// embedded backend the quicktemplate version built into the running program.
+// Nothing is checked when no constraint is configured.
+//
+// Example:
+//
+//	config := Config{Dir: "templates", MinQtcVersion: "v1.7.0", MatchModuleVersion: true}
+//	if err := CheckQtcVersion(config); err != nil {
+//	    fmt.Printf("Incompatible qtc: %v\n", err)
+//	}
+func CheckQtcVersion(config Config) error {
+	if config.MinQtcVersion == "" && config.MaxQtcVersion == "" && !config.MatchModuleVersion {
+		return nil
+	}
+
+	version, err := backendVersion(config)
+	if err != nil {
+		return err
+	}
+
+	if config.MinQtcVersion != "" {
+		minVersion, err := ParseVersion(config.MinQtcVersion)
+		if err != nil {
+			return fmt.Errorf("invalid minimum qtc version: %w", err)
+		}
+		if version.Compare(minVersion) < 0 {
+			return fmt.Errorf("qtc %s is older than the minimum version %s", version, minVersion)
+		}
+	}
+
+	if config.MaxQtcVersion != "" {
+		maxVersion, err := ParseVersion(config.MaxQtcVersion)
+		if err != nil {
+			return fmt.Errorf("invalid maximum qtc version: %w", err)
+		}
+		if version.Compare(maxVersion) > 0 {
+			return fmt.Errorf("qtc %s is newer than the maximum version %s", version, maxVersion)
+		}
+	}
+
+	if config.MatchModuleVersion {
+		return checkModuleVersion(config, version)
+	}
+	return nil
+}
+
+// checkModuleVersion compares the compiler version with the quicktemplate
+// version required by the module of the templates.
+func checkModuleVersion(config Config, version Version) error {
+	modFile, required, err := requiredQuicktemplateVersion(templateRoot(config))
+	if err != nil {
+		return err
+	}
+
+	if version.Compare(required) != 0 {
+		return fmt.Errorf(
+			"qtc %s does not match %s %s required in %s; install a matching compiler with: go install %s/qtc@%s",
+			version, quicktemplateModule, required, modFile, quicktemplateModule, required,
+		)
+	}
+	return nil
+}
+
+// backendVersion returns the parsed version of the configured compiler.
+func backendVersion(config Config) (Version, error) {
+	raw := embeddedVersion()
+	if config.Backend != EmbeddedBackend {
+		var err error
+		if raw, err = qtcVersion(qtcBinary(config)); err != nil {
+			return Version{}, err
+		}
+	}
+
+	version, err := ParseVersion(raw)
+	if err != nil {
+		return Version{}, fmt.Errorf("cannot determine compiler version: %w", err)
+	}
+	return version, nil
+}
+
+// qtcBuildVersion returns the quicktemplate version the qtc binary at path
+// was built from, as recorded in its build information.
+func qtcBuildVersion(path string) (string, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read build information of %s: %w", path, err)
+	}
+
+	if info.Main.Path == quicktemplateModule {
+		return info.Main.Version, nil
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == quicktemplateModule {
+			if dep.Replace != nil {
+				return dep.Replace.Version, nil
+			}
+			return dep.Version, nil
+		}
+	}
+	return "", fmt.Errorf("%s was not built from %s", path, quicktemplateModule)
+}
+
+// requiredQuicktemplateVersion finds the go.mod file governing dir and
+// returns its path and the quicktemplate version it requires. A replace
+// directive pointing at another version takes precedence.
+func requiredQuicktemplateVersion(dir string) (string, Version, error) {
+	modFile, err := findGoMod(dir)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	lines, err := readDirectiveLines(modFile)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	var required, replaced string
+	block := ""
+	for _, line := range lines {
+		switch {
+		case line == ")":
+			block = ""
+			continue
+		case strings.HasSuffix(line, "("):
+			block = strings.TrimSpace(strings.TrimSuffix(line, "("))
+			continue
+		}
+
+		verb := block
+		if verb == "" {
+			var ok bool
+			if verb, line, ok = strings.Cut(line, " "); !ok {
+				continue
+			}
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != quicktemplateModule {
+			continue
+		}
+		switch verb {
+		case "require":
+			required = fields[1]
+		case "replace":
+			// replace path [version] => path [version]
+			if i := strings.Index(line, "=>"); i >= 0 {
+				target := strings.Fields(line[i+2:])
+				if len(target) == 2 {
+					replaced = target[1]
+				}
+			}
+		}
+	}
+
+	if replaced != "" {
+		required = replaced
+	}
+	if required == "" {
+		return "", Version{}, fmt.Errorf("%s does not require %s", modFile, quicktemplateModule)
+	}
+
+	version, err := ParseVersion(required)
+	if err != nil {
+		return "", Version{}, fmt.Errorf("%s: %w", modFile, err)
+	}
+	return modFile, version, nil
+}
+
+// findGoMod returns the go.mod file of the module containing dir.
+func findGoMod(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s: %w", dir, err)
+	}
+
+	for current := abs; ; {
+		modFile := filepath.Join(current, goModFile)
+		if _, err := os.Stat(modFile); err == nil {
+			return modFile, nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", fmt.Errorf("no %s found for %s", goModFile, dir)
+		}
+		current = parent
+	}
+}
@@ -0,0 +1,180 @@
+package qtcwrap
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	// Version test constants.
+	embeddedQtVersion = "v1.8.0"
+	olderQtVersion    = "v1.7.0"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Version
+		valid    bool
+	}{
+		{"v1.8.0", Version{1, 8, 0, ""}, true},
+		{"1.8.0", Version{1, 8, 0, ""}, true},
+		{"qtc version v1.10.2\n", Version{1, 10, 2, ""}, true},
+		{"github.com/valyala/quicktemplate v1.8.0 // indirect", Version{1, 8, 0, ""}, true},
+		{"v1.9.0-rc.1+meta", Version{1, 9, 0, "rc.1"}, true},
+		{"v0.0.0-20240101000000-abcdef123456", Version{0, 0, 0, "20240101000000-abcdef123456"}, true},
+		{"(devel)", Version{}, false},
+		{"", Version{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			version, err := ParseVersion(tt.input)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Expected valid=%t, got error %v", tt.valid, err)
+			}
+			if version != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, version)
+			}
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v1.8.0", "v1.8.0", 0},
+		{"v1.8.0", "v1.10.0", -1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.8.1", "v1.8.0", 1},
+		{"v1.8.0-rc.1", "v1.8.0", -1},
+		{"v1.8.0-rc.2", "v1.8.0-rc.1", 1},
+		{"v1.8.0-rc.2", "v1.8.0-rc.10", -1},
+		{"v1.8.0-rc.10", "v1.8.0-rc.9", 1},
+		{"v1.8.0-1", "v1.8.0-alpha", -1},
+		{"v1.8.0-alpha", "v1.8.0-alpha.1", -1},
+		{"v1.8.0-alpha.beta", "v1.8.0-alpha.1", 1},
+		{"v1.8.0-rc.1", "v1.8.0-rc.1", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			a, _ := ParseVersion(tt.a)
+			b, _ := ParseVersion(tt.b)
+			if got := a.Compare(b); got != tt.expected {
+				t.Errorf("Compare(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+			}
+		})
+	}
+
+	if got := (Version{1, 8, 0, "rc.1"}).String(); got != "v1.8.0-rc.1" {
+		t.Errorf("Unexpected version string %q", got)
+	}
+}
+
+func TestRequiredQuicktemplateVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		goMod    string
+		expected string
+		errMsg   string
+	}{
+		{"Single", "module m\n\nrequire github.com/valyala/quicktemplate v1.7.0\n", olderQtVersion, ""},
+		{"Block", testModuleGoMod, embeddedQtVersion, ""},
+		{"Replaced", testModuleGoMod + "\nreplace github.com/valyala/quicktemplate => github.com/fork/quicktemplate v1.7.0\n", olderQtVersion, ""},
+		{"LocalReplace", testModuleGoMod + "\nreplace (\n\tgithub.com/valyala/quicktemplate => ../quicktemplate\n)\n", embeddedQtVersion, ""},
+		{"NotRequired", "module m\n", "", "does not require"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := createTempTestDir(t)
+			defer cleanupTempDir(t, root)
+			writeTestTemplate(t, root, goModFile, tt.goMod)
+			writeTestTemplate(t, root, "views/page.qtpl", helloTemplate)
+
+			_, version, err := requiredQuicktemplateVersion(filepath.Join(root, viewsDir))
+			if tt.errMsg != "" {
+				assertValidationError(t, err, tt.errMsg, true)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if version.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, version)
+			}
+		})
+	}
+}
+
+func TestCheckQtcVersion(t *testing.T) {
+	if embeddedVersion() != embeddedQtVersion {
+		t.Skipf("Test binary was built with quicktemplate %s", embeddedVersion())
+	}
+
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+	writeTestTemplate(t, root, goModFile, testModuleGoMod)
+	writeTestTemplate(t, root, "older/go.mod", "module older\n\nrequire github.com/valyala/quicktemplate v1.7.0\n")
+
+	tests := []struct {
+		name   string
+		config Config
+		errMsg string
+	}{
+		{"NoConstraints", Config{Dir: root}, ""},
+		{"WithinBounds", Config{Dir: root, MinQtcVersion: olderQtVersion, MaxQtcVersion: embeddedQtVersion}, ""},
+		{"TooOld", Config{Dir: root, MinQtcVersion: "v1.9.0"}, "older than the minimum version v1.9.0"},
+		{"TooNew", Config{Dir: root, MaxQtcVersion: olderQtVersion}, "newer than the maximum version v1.7.0"},
+		{"InvalidBound", Config{Dir: root, MinQtcVersion: "latest"}, "invalid minimum qtc version"},
+		{"ModuleMatches", Config{Dir: root, MatchModuleVersion: true}, ""},
+		{"ModuleMismatch", Config{Dir: filepath.Join(root, "older"), MatchModuleVersion: true}, "does not match github.com/valyala/quicktemplate v1.7.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Backend = EmbeddedBackend
+			err := CheckQtcVersion(tt.config)
+			assertValidationError(t, err, tt.errMsg, tt.errMsg != "")
+		})
+	}
+
+	t.Run("CompileRejectsMismatch", func(t *testing.T) {
+		template := writeTestTemplate(t, root, "older/page.qtpl", helloTemplate)
+		_, err := Compile(Config{File: template, Backend: EmbeddedBackend, MatchModuleVersion: true})
+		assertValidationError(t, err, "does not match", true)
+	})
+}
+
+func TestQtcBuildVersion(t *testing.T) {
+	t.Run("NotAGoBinary", func(t *testing.T) {
+		dir := createTempTestDir(t)
+		defer cleanupTempDir(t, dir)
+
+		_, err := qtcBuildVersion(writeTestTemplate(t, dir, "qtc", "#!/bin/sh\n"))
+		assertValidationError(t, err, "cannot read build information", true)
+	})
+
+	t.Run("Qtc", func(t *testing.T) {
+		requireQtc(t)
+		path, err := exec.LookPath("qtc")
+		if err != nil {
+			t.Fatalf("LookPath failed: %v", err)
+		}
+		if version, err := qtcBuildVersion(path); err != nil || version == "" {
+			t.Errorf("Expected qtc build version, got %q: %v", version, err)
+		}
+	})
+}
+
+func TestValidateVersionRange(t *testing.T) {
+	err := ValidateConfig(Config{Dir: ".", MinQtcVersion: embeddedQtVersion, MaxQtcVersion: olderQtVersion})
+	assertValidationError(t, err, "greater than maximum version", true)
+
+	err = ValidateConfig(Config{Dir: ".", MaxQtcVersion: "next"})
+	assertValidationError(t, err, "invalid maximum qtc version", true)
+}
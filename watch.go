@@ -0,0 +1,111 @@
+package qtcwrap
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is the polling interval used by Watch when none is
+// given.
+const DefaultWatchInterval = 500 * time.Millisecond
+
+// fileState records what Watch compares to detect template changes.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch compiles the templates selected by config and recompiles them
+// whenever a template is added, removed or modified, until ctx is done.
+//
+// Templates are polled every interval, or every DefaultWatchInterval if
+// interval is not positive. onCompile is called after every compilation
+// with its result; compilation errors do not stop watching. Watch returns
+// nil once ctx is done, or an error if the templates cannot be listed.
+//
+// Example:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	err := Watch(ctx, Config{Dir: "templates"}, 0, func(result *Result, err error) {
+//	    if err != nil {
+//	        fmt.Printf("Compilation failed: %v\n", err)
+//	        return
+//	    }
+//	    fmt.Printf("Compiled %d templates\n", len(result.Templates))
+//	})
+func Watch(ctx context.Context, config Config, interval time.Duration, onCompile func(*Result, error)) error {
+	return NewCompiler(config).Watch(ctx, interval, onCompile)
+}
+
+// watch implements Watch: it lists the templates with list, compiles them
+// with compile and compiles again whenever the list or a template changes.
+func watch(ctx context.Context, interval time.Duration, list func() ([]string, error), compile func() (*Result, error), onCompile func(*Result, error)) error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	snapshot, err := templateSnapshot(list)
+	if err != nil {
+		return err
+	}
+	onCompile(compile())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current, err := templateSnapshot(list)
+		if err != nil {
+			return err
+		}
+		if sameSnapshot(snapshot, current) {
+			continue
+		}
+		snapshot = current
+		onCompile(compile())
+	}
+}
+
+// templateSnapshot records the state of the templates listed by list.
+// Templates that disappear while the snapshot is taken are left out.
+func templateSnapshot(list func() ([]string, error)) (map[string]fileState, error) {
+	templates, err := list()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]fileState, len(templates))
+	for _, template := range templates {
+		info, err := os.Stat(template)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshot[template] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return snapshot, nil
+}
+
+// sameSnapshot reports whether two snapshots describe the same templates.
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, state := range a {
+		other, ok := b[path]
+		if !ok || !other.modTime.Equal(state.modTime) || other.size != state.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package qtcwrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	root := createTempTestDir(t)
+	defer cleanupTempDir(t, root)
+
+	template := writeTestTemplate(t, root, testQtplFile, helloTemplate)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	compiled := make(chan *Result, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, Config{Dir: root, Backend: EmbeddedBackend}, 10*time.Millisecond, func(result *Result, err error) {
+			if err != nil {
+				t.Errorf("Unexpected compilation error: %v", err)
+			}
+			compiled <- result
+		})
+	}()
+
+	waitCompiled := func() *Result {
+		select {
+		case result := <-compiled:
+			return result
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for compilation")
+			return nil
+		}
+	}
+
+	if result := waitCompiled(); len(result.Templates) != 1 {
+		t.Fatalf("Expected initial compilation of 1 template, got %+v", result)
+	}
+
+	later := time.Now().Add(time.Second)
+	writeTestTemplate(t, root, testQtplFile, helloTemplate+"\n")
+	if err := os.Chtimes(template, later, later); err != nil {
+		t.Fatalf("Failed to touch template: %v", err)
+	}
+	waitCompiled()
+
+	writeTestTemplate(t, root, filepath.Join(viewsDir, "page.qtpl"), helloTemplate)
+	if result := waitCompiled(); len(result.Templates) != 2 {
+		t.Errorf("Expected new template to be compiled, got %+v", result)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected Watch to stop cleanly, got %v", err)
+	}
+}
+
+func TestSameSnapshot(t *testing.T) {
+	now := time.Now()
+	a := map[string]fileState{"a.qtpl": {modTime: now, size: 1}}
+
+	tests := []struct {
+		name     string
+		other    map[string]fileState
+		expected bool
+	}{
+		{"Same", map[string]fileState{"a.qtpl": {modTime: now, size: 1}}, true},
+		{"Modified", map[string]fileState{"a.qtpl": {modTime: now.Add(time.Second), size: 1}}, false},
+		{"Resized", map[string]fileState{"a.qtpl": {modTime: now, size: 2}}, false},
+		{"Renamed", map[string]fileState{"b.qtpl": {modTime: now, size: 1}}, false},
+		{"Added", map[string]fileState{"a.qtpl": {modTime: now, size: 1}, "b.qtpl": {}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameSnapshot(a, tt.other); got != tt.expected {
+				t.Errorf("Expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}